@@ -102,6 +102,63 @@ func ConnectDB() *mongo.Database {
 		log.Printf("Không thể tạo index cho messages: %v", err)
 	}
 
+	// Cache link preview: unique theo url, TTL theo expires_at
+	_, err = db.Collection("linkPreviews").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "url", Value: 1}},
+			Options: options.Index().SetName("url_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Printf("Không thể tạo index cho linkPreviews: %v", err)
+	}
+
+	// Bookmark: mỗi user lưu một tin nhắn một lần; liệt kê theo _id giảm dần
+	_, err = db.Collection("bookmarks").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "messageID", Value: 1}},
+		Options: options.Index().SetName("user_message_unique").SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Không thể tạo index cho bookmarks: %v", err)
+	}
+
+	// Emoji tuỳ chỉnh: shortcode không trùng trong cùng phạm vi (dùng chung hoặc cùng kênh)
+	_, err = db.Collection("customEmojis").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "shortcode", Value: 1}, {Key: "channelID", Value: 1}},
+		Options: options.Index().SetName("shortcode_channel_unique").SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Không thể tạo index cho customEmojis: %v", err)
+	}
+
+	// Sticker: tra cứu theo ID sticker khi gửi tin nhắn
+	_, err = db.Collection("stickerPacks").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "stickers.id", Value: 1}},
+		Options: options.Index().SetName("stickers_id"),
+	})
+	if err != nil {
+		log.Printf("Không thể tạo index cho stickerPacks: %v", err)
+	}
+
+	// Upload chia chunk: đếm lượt upload dang dở theo user, dọn lượt quá hạn
+	_, err = db.Collection("uploadSessions").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}},
+			Options: options.Index().SetName("user_status"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("expiresAt_idx"),
+		},
+	})
+	if err != nil {
+		log.Printf("Không thể tạo index cho uploadSessions: %v", err)
+	}
+
 	return db
 }
 
@@ -120,6 +177,32 @@ func ensureMessageIndexes(db *mongo.Database) error {
 		Keys:    bson.D{{Key: "hiddenBy", Value: 1}},
 		Options: options.Index().SetName("hiddenBy_idx"),
 	})
+	if err != nil {
+		return err
+	}
+
+	_, err = coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "mentions", Value: 1}, {Key: "timestamp", Value: -1}},
+		Options: options.Index().SetName("mentions_timestamp_idx"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Tìm kiếm tin nhắn: text index trên bản nội dung đã bỏ dấu (searchText), không stemming
+	_, err = coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "searchText", Value: "text"}},
+		Options: options.Index().SetName("searchText_text").SetDefaultLanguage("none"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Tin nhắn tự hủy: sweeper quét theo expiresAt (không dùng TTL index vì cần xoá file + broadcast)
+	_, err = coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt_idx").SetSparse(true),
+	})
 	return err
 }
 
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strconv"
+)
+
+type BookmarkController struct {
+	BookmarkService *services.BookmarkService
+}
+
+func NewBookmarkController(bs *services.BookmarkService) *BookmarkController {
+	return &BookmarkController{BookmarkService: bs}
+}
+
+func bookmarkIDs(ctx *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	messageID, err := primitive.ObjectIDFromHex(ctx.Param("messageID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, messageID, true
+}
+
+// Lưu tin nhắn (gọi lại để sửa ghi chú): body {"note": "..."} (tuỳ chọn)
+func (bc *BookmarkController) AddBookmarkHandler(ctx *gin.Context) {
+	userID, messageID, ok := bookmarkIDs(ctx)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Note string `json:"note"`
+	}
+	_ = ctx.ShouldBindJSON(&body)
+
+	bookmark, err := bc.BookmarkService.AddBookmark(userID, messageID, body.Note)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, bookmark)
+}
+
+// Bỏ lưu tin nhắn
+func (bc *BookmarkController) RemoveBookmarkHandler(ctx *gin.Context) {
+	userID, messageID, ok := bookmarkIDs(ctx)
+	if !ok {
+		return
+	}
+
+	if err := bc.BookmarkService.RemoveBookmark(userID, messageID); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Đã bỏ lưu tin nhắn"})
+}
+
+// Danh sách tin nhắn đã lưu: ?cursor=<nextCursor trang trước>&limit=
+func (bc *BookmarkController) GetBookmarksHandler(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var cursor *primitive.ObjectID
+	if c := ctx.Query("cursor"); c != "" {
+		oid, err := primitive.ObjectIDFromHex(c)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		cursor = &oid
+	}
+	limit, _ := strconv.ParseInt(ctx.DefaultQuery("limit", "50"), 10, 64)
+
+	items, next, err := bc.BookmarkService.GetBookmarks(userID, cursor, limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"bookmarks": items, "nextCursor": next})
+}
@@ -7,6 +7,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 	"net/http"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -75,8 +76,13 @@ func (cc *ChannelController) AddMemberHandler(ctx *gin.Context) {
 		return
 	}
 
-	// Thêm thành viên
-	if err := cc.ChannelService.AddMember(channel, memberID); err != nil {
+	// Thêm thành viên (người thêm lấy từ JWT middleware)
+	adderID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adder ID"})
+		return
+	}
+	if err := cc.ChannelService.AddMember(channel, adderID, memberID); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -230,6 +236,198 @@ func (cc *ChannelController) ToggleApprovalHandler(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"message": "Approval setting updated successfully"})
 }
 
+// Bật/tắt tin nhắn tự hủy — PUT /api/channels/:channelID/message-ttl
+func (cc *ChannelController) SetMessageTTLHandler(ctx *gin.Context) {
+	requesterID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid requester ID"})
+		return
+	}
+
+	channelID, err := primitive.ObjectIDFromHex(ctx.Param("channelID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel id"})
+		return
+	}
+
+	// ttlSeconds = 0 để tắt
+	var req struct {
+		TTLSeconds int64 `json:"ttlSeconds"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.TTLSeconds < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	channel, err := cc.ChannelService.GetChannel(channelID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	_, err = cc.ChannelService.SetMessageTTL(channel, requesterID, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// tin nhắn hệ thống đã được ChannelService broadcast
+	cc.WebRTCController.BroadcastMessage(channel.ID, map[string]interface{}{
+		"type":       "channel_message_ttl",
+		"channelId":  channel.ID.Hex(),
+		"ttlSeconds": req.TTLSeconds,
+		"by":         requesterID.Hex(),
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Message TTL updated successfully", "ttlSeconds": req.TTLSeconds})
+}
+
+// Cấu hình cửa sổ thu hồi / chỉnh sửa — PUT /api/channels/:channelID/message-windows
+func (cc *ChannelController) SetMessageWindowsHandler(ctx *gin.Context) {
+	requesterID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid requester ID"})
+		return
+	}
+
+	channelID, err := primitive.ObjectIDFromHex(ctx.Param("channelID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel id"})
+		return
+	}
+
+	// bỏ trống = giữ nguyên, 0 = dùng mặc định server
+	var req struct {
+		RecallWindowSeconds *int64 `json:"recallWindowSeconds"`
+		EditWindowSeconds   *int64 `json:"editWindowSeconds"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	var recall, edit *time.Duration
+	if req.RecallWindowSeconds != nil {
+		d := time.Duration(*req.RecallWindowSeconds) * time.Second
+		recall = &d
+	}
+	if req.EditWindowSeconds != nil {
+		d := time.Duration(*req.EditWindowSeconds) * time.Second
+		edit = &d
+	}
+
+	channel, err := cc.ChannelService.GetChannel(channelID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	if err := cc.ChannelService.SetMessageWindows(channel, requesterID, recall, edit); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// trả về giá trị hiệu lực (đã tính mặc định server)
+	windows := map[string]interface{}{
+		"type":                "channel_message_windows",
+		"channelId":           channel.ID.Hex(),
+		"recallWindowSeconds": int64(cc.ChannelService.RecallWindow(channel) / time.Second),
+		"editWindowSeconds":   int64(cc.ChannelService.EditWindow(channel) / time.Second),
+		"by":                  requesterID.Hex(),
+	}
+	cc.WebRTCController.BroadcastMessage(channel.ID, windows)
+
+	ctx.JSON(http.StatusOK, windows)
+}
+
+// Bật/tắt chế độ mỗi người một reaction
+func (cc *ChannelController) SetReactionModeHandler(ctx *gin.Context) {
+	requesterID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid requester ID"})
+		return
+	}
+
+	channelID, err := primitive.ObjectIDFromHex(ctx.Param("channelID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel id"})
+		return
+	}
+
+	var req struct {
+		SingleReaction *bool `json:"singleReaction"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.SingleReaction == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "singleReaction required"})
+		return
+	}
+
+	channel, err := cc.ChannelService.GetChannel(channelID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	if err := cc.ChannelService.SetReactionMode(channel, requesterID, *req.SingleReaction); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	mode := map[string]interface{}{
+		"type":           "channel_reaction_mode",
+		"channelId":      channel.ID.Hex(),
+		"singleReaction": *req.SingleReaction,
+		"by":             requesterID.Hex(),
+	}
+	cc.WebRTCController.BroadcastMessage(channel.ID, mode)
+
+	ctx.JSON(http.StatusOK, mode)
+}
+
+// Lưu bản nháp của user trong kênh: body {"content": "...", "replyTo": "<messageID>"}
+func (cc *ChannelController) SaveDraftHandler(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid requester ID"})
+		return
+	}
+
+	channelID, err := primitive.ObjectIDFromHex(ctx.Param("channelID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel id"})
+		return
+	}
+
+	var req struct {
+		Content string  `json:"content"`
+		ReplyTo *string `json:"replyTo"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	var replyTo *primitive.ObjectID
+	if req.ReplyTo != nil && *req.ReplyTo != "" {
+		oid, err := primitive.ObjectIDFromHex(*req.ReplyTo)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid replyTo"})
+			return
+		}
+		replyTo = &oid
+	}
+
+	uc, err := cc.ChannelService.UserChannelService.SaveDraft(userID, channelID, req.Content, replyTo)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// đồng bộ sang các thiết bị khác của user
+	payload := services.DraftPayload(channelID, uc.Draft)
+	cc.WebRTCController.NotifyUser(userID.Hex(), payload)
+
+	ctx.JSON(http.StatusOK, payload)
+}
+
 // Thành viên rời khỏi nhóm
 func (cc *ChannelController) LeaveChannelHandler(ctx *gin.Context) {
 	channelIdStr := ctx.Param("channelID")
@@ -268,18 +466,12 @@ func (cc *ChannelController) LeaveChannelHandler(ctx *gin.Context) {
 		return
 	}
 
-	// Rời nhóm (nếu là leader mà không gửi newLeaderID -> service sẽ báo lỗi)
+	// Rời nhóm (nếu là leader mà không gửi newLeaderID -> service sẽ báo lỗi; service tự update DB)
 	if err := cc.ChannelService.LeaveChannel(channel, memberID, newLeaderID); err != nil {
 		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Lưu thay đổi vào DB
-	if err := cc.ChannelService.UpdateChannel(channel); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update channel"})
-		return
-	}
-
 	ctx.JSON(http.StatusOK, gin.H{"message": "Leave channel successfully"})
 }
 
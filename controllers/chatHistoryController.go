@@ -9,11 +9,12 @@ import (
 
 type ChatHistoryController struct {
 	ChatHistoryService *services.ChatHistoryService
+	UserChannelService *services.UserChannelService
 }
 
 // NewChatHistoryController tạo một instance mới của ChatHistoryController
-func NewChatHistoryController(service *services.ChatHistoryService) *ChatHistoryController {
-	return &ChatHistoryController{ChatHistoryService: service}
+func NewChatHistoryController(service *services.ChatHistoryService, ucs *services.UserChannelService) *ChatHistoryController {
+	return &ChatHistoryController{ChatHistoryService: service, UserChannelService: ucs}
 }
 
 func (chc *ChatHistoryController) GetChatHistory(ctx *gin.Context) {
@@ -45,7 +46,9 @@ func (chc *ChatHistoryController) GetChatHistoryByUserID(ctx *gin.Context) {
 		return
 	}
 
-	channels, err := chc.ChatHistoryService.GetChatHistoryByUserID(id)
+	// ?archived=true để xem các hội thoại đã lưu trữ
+	archived := ctx.Query("archived") == "true"
+	channels, err := chc.ChatHistoryService.GetChatHistoryByUserID(id, &archived)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -54,6 +57,29 @@ func (chc *ChatHistoryController) GetChatHistoryByUserID(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"channels": channels})
 }
 
+// Xoá hội thoại phía mình: tin nhắn trước thời điểm này không còn hiển thị với user, thành viên khác không bị ảnh hưởng
+func (chc *ChatHistoryController) ClearChatHistoryForMe(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	channelID, err := primitive.ObjectIDFromHex(ctx.Param("channelID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel ID"})
+		return
+	}
+
+	uc, err := chc.UserChannelService.ClearHistory(userID, channelID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Đã xoá hội thoại", "clearedAt": uc.ClearedAt})
+}
+
+// Xoá document chathistory dùng chung của kênh (admin)
 func (chc *ChatHistoryController) DeleteChatHistory(ctx *gin.Context) {
 	channelID := ctx.Param("channelID")
 	id, err := primitive.ObjectIDFromHex(channelID)
@@ -1,22 +1,40 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	"chat-app-backend/models"
 	"chat-app-backend/services"
+	"chat-app-backend/storage"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type FileController struct {
-	FileService *services.FileService
+	FileService   *services.FileService
+	AccessService *services.FileAccessService
 }
 
-func NewFileController(fs *services.FileService) *FileController {
-	return &FileController{FileService: fs}
+func NewFileController(fs *services.FileService, fas *services.FileAccessService) *FileController {
+	return &FileController{FileService: fs, AccessService: fas}
 }
 
-// POST /uploads  (form-data: file)
+// POST /uploads  (form-data: file), cần đăng nhập
 func (fc *FileController) Upload(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
 	// Giới hạn dung lượng request (25MB)
 	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, 25<<20)
 
@@ -36,7 +54,15 @@ func (fc *FileController) Upload(ctx *gin.Context) {
 	// Lưu ý: FileService.SaveUpload sẽ tự Close() f, nên không Close ở đây.
 
 	// Lưu file + tạo record DB
-	saved, err := fc.FileService.SaveUpload(f, fh)
+	saved, err := fc.FileService.SaveUpload(userID, f, fh)
+	if errors.Is(err, services.ErrStorageQuotaExceeded) || errors.Is(err, services.ErrFileTooLargeToScan) {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrFileTypeNotAllowed) {
+		ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -44,10 +70,259 @@ func (fc *FileController) Upload(ctx *gin.Context) {
 
 	// Trả kết quả
 	ctx.JSON(http.StatusOK, gin.H{
-		"id":       saved.ID,
-		"url":      saved.URL,
-		"size":     saved.FileSize,
-		"fileType": saved.FileType,
-		// "mime":   ... // nếu muốn trả thêm, có thể detect ở FileService và thêm field
+		"id":         saved.ID,
+		"url":        saved.URL,
+		"size":       saved.FileSize,
+		"fileType":   saved.FileType,
+		"mime":       saved.Mime,
+		"duration":   saved.Duration, // audio (giây), 0 nếu không đọc được
+		"waveform":   saved.Waveform, // audio: dạng sóng 0-100
+		"width":      saved.Width,    // ảnh: kích thước sau khi xoay theo EXIF
+		"height":     saved.Height,
+		"thumbnails": saved.Thumbnails, // ảnh: [{url, width, height}] tăng dần
 	})
 }
+
+// GET /api/files/:fileID/download?thumb=0  (Bearer token hoặc URL đã ký exp/sig), hỗ trợ Range để tua audio/video
+func (fc *FileController) Download(ctx *gin.Context) {
+	fileID, err := primitive.ObjectIDFromHex(ctx.Param("fileID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return
+	}
+	file, err := fc.AccessService.GetFile(fileID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !fc.authorize(ctx, file) {
+		return
+	}
+	thumb := -1
+	if t := ctx.Query("thumb"); t != "" {
+		if thumb, err = strconv.Atoi(t); err != nil || thumb < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid thumbnail index"})
+			return
+		}
+	}
+	fc.serveFile(ctx, file, thumb)
+}
+
+// GET /uploads/:name (local) và GET /files/*key (bucket private): URL cũ lưu trong DB, vẫn phải qua kiểm tra quyền
+func (fc *FileController) ServeByKey(ctx *gin.Context) {
+	key := strings.TrimPrefix(ctx.Param("key"), "/")
+	if key == "" {
+		key = ctx.Param("name")
+	}
+	if key == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy file"})
+		return
+	}
+
+	files, err := fc.AccessService.FindByStorageKey(fc.FileService.Provider.Name(), key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// file không có bản ghi (ảnh mặc định đặt sẵn trong thư mục upload...) thì phục vụ công khai
+		if opener, ok := fc.FileService.Provider.(storage.Opener); ok {
+			serveObject(ctx, opener, key, "", key)
+			return
+		}
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy file"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// nhiều người upload cùng nội dung dùng chung key: được xem bản ghi nào thì phục vụ bản ghi đó
+	file := fc.authorizeAny(ctx, files)
+	if file == nil {
+		return
+	}
+	fc.serveFile(ctx, file, services.ThumbnailIndex(file, key))
+}
+
+// GET /api/files/:fileID/signed-url → URL download có hạn cho <img>/<audio>
+func (fc *FileController) SignedURL(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	fileID, err := primitive.ObjectIDFromHex(ctx.Param("fileID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return
+	}
+	file, err := fc.AccessService.GetFile(fileID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err := fc.AccessService.CanAccess(file, &userID); err != nil {
+		ctx.JSON(accessStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	url, expiresAt, err := services.SignedDownloadURL(file.ID, services.SignedURLTTL())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"url": url, "expiresAt": expiresAt})
+}
+
+// POST /api/files/signed-urls  body: {"urls": ["<url file hoặc thumbnail>", ...]}
+// → {"urls": {"<url>": "<url đã ký>"}, "expiresAt": ...}; URL không tìm thấy hoặc không có quyền thì bỏ qua
+func (fc *FileController) SignedURLs(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var req struct {
+		URLs []string `json:"urls" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.URLs) > services.MaxSignedURLBatch {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Tối đa %d URL mỗi lần", services.MaxSignedURLBatch)})
+		return
+	}
+
+	ttl := services.SignedURLTTL()
+	signed := make(map[string]string, len(req.URLs))
+	var expiresAt time.Time
+	for _, u := range req.URLs {
+		if _, done := signed[u]; done {
+			continue
+		}
+		files, err := fc.AccessService.FindByURL(u)
+		if err != nil {
+			continue
+		}
+		file, err := fc.AccessService.FirstAccessible(files, &userID)
+		if err != nil {
+			continue
+		}
+		url, exp, err := services.SignedDownloadURL(file.ID, ttl)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if thumb := services.ThumbnailIndex(file, u); thumb >= 0 {
+			url += "&thumb=" + strconv.Itoa(thumb)
+		}
+		signed[u], expiresAt = url, exp
+	}
+	ctx.JSON(http.StatusOK, gin.H{"urls": signed, "expiresAt": expiresAt})
+}
+
+// authorize: URL đã ký hợp lệ, hoặc người dùng (nếu có token) được quyền xem file; không thì trả lỗi và false
+func (fc *FileController) authorize(ctx *gin.Context, file *models.File) bool {
+	if services.VerifyFileSignature(file.ID, ctx.Query("exp"), ctx.Query("sig")) {
+		return true
+	}
+	var userID *primitive.ObjectID
+	if id, err := primitive.ObjectIDFromHex(ctx.GetString("user_id")); err == nil {
+		userID = &id
+	}
+	if err := fc.AccessService.CanAccess(file, userID); err != nil {
+		status := accessStatus(err)
+		if status == http.StatusForbidden && userID == nil {
+			status = http.StatusUnauthorized
+		}
+		ctx.JSON(status, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// authorizeAny như authorize nhưng cho nhiều bản ghi dùng chung một nội dung; trả bản ghi được xem hoặc nil (đã trả lỗi)
+func (fc *FileController) authorizeAny(ctx *gin.Context, files []models.File) *models.File {
+	for i := range files {
+		if services.VerifyFileSignature(files[i].ID, ctx.Query("exp"), ctx.Query("sig")) {
+			return &files[i]
+		}
+	}
+	var userID *primitive.ObjectID
+	if id, err := primitive.ObjectIDFromHex(ctx.GetString("user_id")); err == nil {
+		userID = &id
+	}
+	file, err := fc.AccessService.FirstAccessible(files, userID)
+	if err != nil {
+		status := accessStatus(err)
+		if status == http.StatusForbidden && userID == nil {
+			status = http.StatusUnauthorized
+		}
+		ctx.JSON(status, gin.H{"error": err.Error()})
+		return nil
+	}
+	return file
+}
+
+func accessStatus(err error) int {
+	if errors.Is(err, services.ErrFileAccessDenied) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// serveFile trả nội dung file (hoặc thumbnail) sau khi đã kiểm tra quyền:
+// provider đọc được trực tiếp (local) thì stream kèm Range, bucket private thì redirect sang presigned URL,
+// còn lại (Cloudinary, bản ghi của provider khác) redirect về URL gốc
+func (fc *FileController) serveFile(ctx *gin.Context, file *models.File, thumb int) {
+	key, url, err := fc.FileService.ObjectOf(file, thumb)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy file"})
+		return
+	}
+	if key != "" {
+		if opener, ok := fc.FileService.Provider.(storage.Opener); ok {
+			contentType, name := file.Mime, file.FileName
+			if thumb >= 0 {
+				contentType, name = "", key
+			}
+			serveObject(ctx, opener, key, contentType, name)
+			return
+		}
+		if presigner, ok := fc.FileService.Provider.(storage.Presigner); ok {
+			if url, err = presigner.PresignGet(key, 0); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			// cache ngắn hơn thời hạn presigned URL để trình duyệt không giữ URL đã hết hạn
+			ctx.Header("Cache-Control", "private, max-age=300")
+			ctx.Redirect(http.StatusFound, url)
+			return
+		}
+	}
+	if url == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy file"})
+		return
+	}
+	ctx.Redirect(http.StatusFound, url)
+}
+
+// serveObject stream object qua http.ServeContent (Range, If-Modified-Since); contentType rỗng thì đoán theo tên file.
+// File không phải ảnh/video/audio luôn trả dạng attachment để trình duyệt không mở (HTML/SVG cũ vẫn có thể còn trên storage).
+func serveObject(ctx *gin.Context, opener storage.Opener, key, contentType, name string) {
+	r, modTime, err := opener.Open(key)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy file"})
+		return
+	}
+	defer r.Close()
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType != "" {
+		ctx.Header("Content-Type", contentType)
+	}
+	if !storage.IsInlineMedia(contentType) {
+		ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)}))
+	}
+	ctx.Header("Cache-Control", "private, max-age=3600")
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(ctx.Writer, ctx.Request, path.Base(name), modTime, r)
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type MediaController struct {
+	MediaService *services.MediaService
+}
+
+func NewMediaController(ms *services.MediaService) *MediaController {
+	return &MediaController{MediaService: ms}
+}
+
+// Thư viện media của kênh — GET /api/channels/:channelID/media?type=Image|Video|Audio|Document|Link&before=&beforeId=&limit=
+// before (RFC3339) và beforeId lấy từ nextBefore, nextBeforeId của trang trước
+func (mc *MediaController) ListChannelMediaHandler(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	channelID, err := primitive.ObjectIDFromHex(ctx.Param("channelID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel id"})
+		return
+	}
+
+	var before time.Time
+	if raw := ctx.Query("before"); raw != "" {
+		before, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before timestamp (RFC3339)"})
+			return
+		}
+	}
+	var beforeID *primitive.ObjectID
+	if raw := ctx.Query("beforeId"); raw != "" {
+		id, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid beforeId"})
+			return
+		}
+		beforeID = &id
+	}
+	limit, _ := strconv.ParseInt(ctx.Query("limit"), 10, 64)
+
+	// Chỉ thành viên được xem
+	channel, err := mc.MediaService.ChannelService.GetChannel(channelID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+	if !mc.MediaService.ChannelService.IsMember(channel, userID) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of the channel"})
+		return
+	}
+
+	page, err := mc.MediaService.ListChannelMedia(channelID, userID, ctx.Query("type"), before, beforeID, limit)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, page)
+}
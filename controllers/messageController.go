@@ -15,8 +15,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Định nghĩa upgrader cho WebSocket
@@ -107,9 +109,10 @@ func (mc *MessageController) HandleWebSocket(ctx *gin.Context) {
 	// Lưu kết nối với userID
 	mc.Mutex.Lock()
 	mc.Clients[conn] = userID
-	mc.WebRTCController.Connections[userID] = conn
 	log.Printf("Stored connection for userID %s: %p", userID, conn)
 	mc.Mutex.Unlock()
+	mc.WebRTCController.AddConnection(userID, conn)
+	defer mc.WebRTCController.RemoveConnection(userID, conn)
 
 	for {
 		// Đọc tin nhắn từ WebSocket
@@ -144,6 +147,12 @@ func (mc *MessageController) HandleWebSocket(ctx *gin.Context) {
 			continue
 		}
 
+		// Người gửi luôn là user của token; senderId client gửi lên chỉ được chấp nhận khi trùng
+		if incomingMessage.SenderID != "" && incomingMessage.SenderID != userID {
+			log.Printf("SenderID %s không khớp với userID %s, bỏ qua tin nhắn", incomingMessage.SenderID, userID)
+			continue
+		}
+		incomingMessage.SenderID = userID
 		senderID, err := primitive.ObjectIDFromHex(incomingMessage.SenderID)
 		if err != nil {
 			log.Printf("Lỗi chuyển đổi SenderID: %v", err)
@@ -224,12 +233,70 @@ func (mc *MessageController) HandleWebSocket(ctx *gin.Context) {
 			"channelId":    message.ChannelID.Hex(),
 			"replyTo":      replyPreview,
 			"attachments":  message.Attachments,
+			"expiresAt":    message.ExpiresAt,
+			"mentions":     message.Mentions,
+			"mentionAll":   message.MentionAll,
+		}
+
+		// File đính kèm đang chờ quét: chỉ báo cho người gửi, broadcast khi quét xong (MessageService.ReleaseWithheld)
+		if message.Withheld {
+			response["withheld"] = true
+			mc.WebRTCController.NotifyUser(incomingMessage.SenderID, response)
+			continue
 		}
 
 		// Broadcast đến các thành viên kênh
 		log.Printf("[HandleWebSocket] Response: %+v", response)
 		mc.WebRTCController.BroadcastMessage(channelID, response)
+
+		// Unfurl link ở nền, không chặn vòng đọc WebSocket
+		go mc.attachLinkPreview(*message)
+	}
+}
+
+// attachLinkPreview tạo preview cho link trong tin nhắn rồi broadcast "message_updated"
+func (mc *MessageController) attachLinkPreview(message models.Message) {
+	preview, err := mc.MessageService.GenerateLinkPreview(&message)
+	if err != nil {
+		log.Printf("[attachLinkPreview] message %s: %v", message.ID.Hex(), err)
+		return
+	}
+	if preview == nil {
+		return
+	}
+	mc.WebRTCController.BroadcastMessage(message.ChannelID, map[string]interface{}{
+		"type":        "message_updated",
+		"id":          message.ID.Hex(),
+		"channelId":   message.ChannelID.Hex(),
+		"linkPreview": preview,
+	})
+}
+
+// Danh sách tin nhắn nhắc tới user hiện tại — GET /api/users/me/mentions?before=&limit=
+func (mc *MessageController) GetMyMentionsHandler(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var before time.Time
+	if raw := ctx.Query("before"); raw != "" {
+		before, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before timestamp (RFC3339)"})
+			return
+		}
 	}
+	limit, _ := strconv.ParseInt(ctx.Query("limit"), 10, 64)
+
+	mentions, err := mc.MessageService.GetMentions(userID, before, limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"mentions": mentions})
 }
 
 // Thu hồi tin nhắn — POST /api/messages/:messageID/recall
@@ -252,21 +319,24 @@ func (mc *MessageController) RecallMessageHandler(ctx *gin.Context) {
 		return
 	}
 
-	chID, err := mc.MessageService.RecallMessage(msgID, requesterID, services.DefaultRecallWindow)
+	msg, removerName, err := mc.MessageService.RecallMessage(msgID, requesterID)
 	if err != nil {
 		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Broadcast tới cả kênh: message đã bị thu hồi
-	mc.WebRTCController.BroadcastMessage(chID, gin.H{
-		"type":      "message_recalled",
-		"channelId": chID.Hex(),
-		"messageId": msgID.Hex(),
-		"by":        requesterID.Hex(),
+	// Broadcast tới cả kênh: message đã bị thu hồi (tự thu hồi hoặc bị Leader/Deputy gỡ)
+	mc.WebRTCController.BroadcastMessage(msg.ChannelID, gin.H{
+		"type":       "message_recalled",
+		"channelId":  msg.ChannelID.Hex(),
+		"messageId":  msgID.Hex(),
+		"by":         requesterID.Hex(),
+		"byName":     removerName,
+		"recallKind": msg.RecallKind,
+		"recalledAt": msg.RecalledAt,
 	})
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Recalled successfully"})
+	ctx.JSON(http.StatusOK, gin.H{"message": "Recalled successfully", "recallKind": msg.RecallKind})
 }
 
 // Ẩn tin nhắn cho riêng người gọi — DELETE /api/messages/:messageID/hide
@@ -360,8 +430,11 @@ func (mc *MessageController) EditMessage(ctx *gin.Context) {
 		"timestamp":    msg.Timestamp, // ✅ thêm timestamp
 		"recalled":     msg.Recalled,
 		"status":       msg.Status,
+		"mentions":     msg.Mentions,
+		"mentionAll":   msg.MentionAll,
 	}
 	mc.WebRTCController.BroadcastMessage(msg.ChannelID, resp)
+	go mc.attachLinkPreview(*msg)
 
 	ctx.JSON(http.StatusOK, msg)
 }
@@ -420,3 +493,28 @@ func (mc *MessageController) ToggleReaction(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, msg)
 }
+
+// Danh sách người đã thả reaction: ?emoji=&offset=&limit=
+func (mc *MessageController) GetReactionUsersHandler(ctx *gin.Context) {
+	msgID, err := primitive.ObjectIDFromHex(ctx.Param("messageID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	offset, _ := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+
+	result, err := mc.MessageService.GetReactionUsers(msgID, userID, ctx.Query("emoji"), offset, limit)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
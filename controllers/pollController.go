@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"chat-app-backend/models"
+	"chat-app-backend/services"
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+type PollController struct {
+	PollService      *services.PollService
+	WebRTCController *WebRTCController
+}
+
+func NewPollController(ps *services.PollService, wc *WebRTCController) *PollController {
+	return &PollController{
+		PollService:      ps,
+		WebRTCController: wc,
+	}
+}
+
+// Tạo bình chọn trong kênh
+func (pc *PollController) CreatePollHandler(ctx *gin.Context) {
+	channelID, err := primitive.ObjectIDFromHex(ctx.Param("channelID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel ID"})
+		return
+	}
+	userID, ok := pollRequester(ctx)
+	if !ok {
+		return
+	}
+
+	var input services.PollInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, err := pc.PollService.CreatePoll(channelID, userID, input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sender struct {
+		Name   string `bson:"name"`
+		Avatar string `bson:"avatar"`
+	}
+	_ = pc.PollService.DB.Collection("users").FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&sender)
+
+	pc.WebRTCController.BroadcastMessage(channelID, map[string]interface{}{
+		"type":         "message_new",
+		"id":           message.ID.Hex(),
+		"content":      message.Content,
+		"timestamp":    message.Timestamp,
+		"messageType":  message.MessageType,
+		"senderId":     userID.Hex(),
+		"senderName":   sender.Name,
+		"senderAvatar": services.FullAvatarURL(sender.Avatar),
+		"status":       message.Status,
+		"recalled":     message.Recalled,
+		"channelId":    channelID.Hex(),
+		"expiresAt":    message.ExpiresAt,
+		"poll":         services.PollView(message.Poll, primitive.NilObjectID),
+	})
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"id":   message.ID.Hex(),
+		"poll": services.PollView(message.Poll, userID),
+	})
+}
+
+// Bỏ phiếu: body {"optionIds": ["..."]}
+func (pc *PollController) VoteHandler(ctx *gin.Context) {
+	messageID, err := primitive.ObjectIDFromHex(ctx.Param("messageID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+	userID, ok := pollRequester(ctx)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		OptionIDs []string `json:"optionIds"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil || len(body.OptionIDs) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "optionIds required"})
+		return
+	}
+
+	msg, err := pc.PollService.Vote(messageID, userID, body.OptionIDs)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pc.broadcastPoll(msg)
+	ctx.JSON(http.StatusOK, gin.H{"poll": services.PollView(msg.Poll, userID)})
+}
+
+// Rút phiếu: ?optionId= (bỏ trống = rút mọi phiếu)
+func (pc *PollController) RetractVoteHandler(ctx *gin.Context) {
+	messageID, err := primitive.ObjectIDFromHex(ctx.Param("messageID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+	userID, ok := pollRequester(ctx)
+	if !ok {
+		return
+	}
+
+	msg, err := pc.PollService.Retract(messageID, userID, ctx.Query("optionId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pc.broadcastPoll(msg)
+	ctx.JSON(http.StatusOK, gin.H{"poll": services.PollView(msg.Poll, userID)})
+}
+
+// Đóng bình chọn
+func (pc *PollController) ClosePollHandler(ctx *gin.Context) {
+	messageID, err := primitive.ObjectIDFromHex(ctx.Param("messageID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+	userID, ok := pollRequester(ctx)
+	if !ok {
+		return
+	}
+
+	msg, err := pc.PollService.Close(messageID, userID)
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	pc.broadcastPoll(msg)
+	ctx.JSON(http.StatusOK, gin.H{"poll": services.PollView(msg.Poll, userID)})
+}
+
+// broadcastPoll gửi tally mới cho cả kênh (không kèm myVotes; voters bị ẩn nếu anonymous)
+func (pc *PollController) broadcastPoll(msg *models.Message) {
+	pc.WebRTCController.BroadcastMessage(msg.ChannelID, map[string]interface{}{
+		"type":      "poll_updated",
+		"messageId": msg.ID.Hex(),
+		"channelId": msg.ChannelID.Hex(),
+		"poll":      services.PollView(msg.Poll, primitive.NilObjectID),
+	})
+}
+
+func pollRequester(ctx *gin.Context) (primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return primitive.NilObjectID, false
+	}
+	return userID, true
+}
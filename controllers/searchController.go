@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"chat-app-backend/models"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type SearchController struct {
+	SearchService *services.SearchService
+}
+
+func NewSearchController(ss *services.SearchService) *SearchController {
+	return &SearchController{SearchService: ss}
+}
+
+// Tìm tin nhắn: ?q=&channelId=&from=&before=&after=&type=&offset=&limit= (before/after dạng RFC3339)
+func (sc *SearchController) SearchMessagesHandler(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	params := services.SearchParams{
+		Query: ctx.Query("q"),
+		Type:  models.MessageType(ctx.Query("type")),
+	}
+	params.Offset, _ = strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	params.Limit, _ = strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+
+	for key, dst := range map[string]**primitive.ObjectID{"channelId": &params.ChannelID, "from": &params.From} {
+		if v := ctx.Query(key); v != "" {
+			oid, err := primitive.ObjectIDFromHex(v)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + key})
+				return
+			}
+			*dst = &oid
+		}
+	}
+	for key, dst := range map[string]**time.Time{"before": &params.Before, "after": &params.After} {
+		if v := ctx.Query(key); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + key + " (RFC3339)"})
+				return
+			}
+			*dst = &t
+		}
+	}
+
+	result, err := sc.SearchService.SearchMessages(userID, params)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
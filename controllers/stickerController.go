@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+type StickerController struct {
+	StickerService *services.StickerService
+}
+
+func NewStickerController(ss *services.StickerService) *StickerController {
+	return &StickerController{StickerService: ss}
+}
+
+// stickerUser lấy user từ token và ObjectID từ các path param cần thiết
+func stickerUser(ctx *gin.Context, params ...string) (primitive.ObjectID, []primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return primitive.NilObjectID, nil, false
+	}
+	ids := make([]primitive.ObjectID, 0, len(params))
+	for _, p := range params {
+		id, err := primitive.ObjectIDFromHex(ctx.Param(p))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + p})
+			return primitive.NilObjectID, nil, false
+		}
+		ids = append(ids, id)
+	}
+	return userID, ids, true
+}
+
+// optionalChannelID đọc channelId (query hoặc form), rỗng = phạm vi dùng chung
+func optionalChannelID(ctx *gin.Context, raw string) (*primitive.ObjectID, bool) {
+	if raw == "" {
+		return nil, true
+	}
+	id, err := primitive.ObjectIDFromHex(raw)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid channelId"})
+		return nil, false
+	}
+	return &id, true
+}
+
+// GET /api/stickers/packs?channelId=... : bộ dùng chung + bộ của kênh
+func (sc *StickerController) ListPacksHandler(ctx *gin.Context) {
+	userID, _, ok := stickerUser(ctx)
+	if !ok {
+		return
+	}
+	channelID, ok := optionalChannelID(ctx, ctx.Query("channelId"))
+	if !ok {
+		return
+	}
+	packs, err := sc.StickerService.ListPacks(userID, channelID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"packs": packs})
+}
+
+// POST /api/stickers/packs  body {"name", "channelId"?, "order"?}
+func (sc *StickerController) CreatePackHandler(ctx *gin.Context) {
+	userID, _, ok := stickerUser(ctx)
+	if !ok {
+		return
+	}
+	var body struct {
+		Name      string `json:"name"`
+		ChannelID string `json:"channelId"`
+		Order     int    `json:"order"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	channelID, ok := optionalChannelID(ctx, body.ChannelID)
+	if !ok {
+		return
+	}
+	pack, err := sc.StickerService.CreatePack(userID, body.Name, channelID, body.Order)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusCreated, pack)
+}
+
+// PUT /api/stickers/packs/:packID  body {"name"?, "order"?}
+func (sc *StickerController) UpdatePackHandler(ctx *gin.Context) {
+	userID, ids, ok := stickerUser(ctx, "packID")
+	if !ok {
+		return
+	}
+	var body struct {
+		Name  *string `json:"name"`
+		Order *int    `json:"order"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	pack, err := sc.StickerService.UpdatePack(ids[0], userID, body.Name, body.Order)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, pack)
+}
+
+// DELETE /api/stickers/packs/:packID
+func (sc *StickerController) DeletePackHandler(ctx *gin.Context) {
+	userID, ids, ok := stickerUser(ctx, "packID")
+	if !ok {
+		return
+	}
+	if err := sc.StickerService.DeletePack(ids[0], userID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Đã xoá bộ sticker"})
+}
+
+// POST /api/stickers/packs/:packID/stickers  (form-data: file, emoji?)
+func (sc *StickerController) AddStickerHandler(ctx *gin.Context) {
+	userID, ids, ok := stickerUser(ctx, "packID")
+	if !ok {
+		return
+	}
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, services.StickerMaxFileSize+(1<<20))
+	fh, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Thiếu file hoặc file không hợp lệ"})
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Không thể mở file upload"})
+		return
+	}
+	pack, err := sc.StickerService.AddSticker(ids[0], userID, f, fh, ctx.PostForm("emoji"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, pack)
+}
+
+// DELETE /api/stickers/packs/:packID/stickers/:stickerID
+func (sc *StickerController) RemoveStickerHandler(ctx *gin.Context) {
+	userID, ids, ok := stickerUser(ctx, "packID", "stickerID")
+	if !ok {
+		return
+	}
+	pack, err := sc.StickerService.RemoveSticker(ids[0], ids[1], userID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, pack)
+}
+
+// GET /api/users/me/sticker-packs
+func (sc *StickerController) GetLibraryHandler(ctx *gin.Context) {
+	userID, _, ok := stickerUser(ctx)
+	if !ok {
+		return
+	}
+	packs, err := sc.StickerService.GetLibrary(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"packs": packs})
+}
+
+// PUT /api/users/me/sticker-packs/:packID
+func (sc *StickerController) AddToLibraryHandler(ctx *gin.Context) {
+	userID, ids, ok := stickerUser(ctx, "packID")
+	if !ok {
+		return
+	}
+	if err := sc.StickerService.AddToLibrary(userID, ids[0]); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Đã thêm bộ sticker"})
+}
+
+// DELETE /api/users/me/sticker-packs/:packID
+func (sc *StickerController) RemoveFromLibraryHandler(ctx *gin.Context) {
+	userID, ids, ok := stickerUser(ctx, "packID")
+	if !ok {
+		return
+	}
+	if err := sc.StickerService.RemoveFromLibrary(userID, ids[0]); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Đã gỡ bộ sticker"})
+}
+
+// GET /api/emojis?channelId=...
+func (sc *StickerController) ListEmojisHandler(ctx *gin.Context) {
+	userID, _, ok := stickerUser(ctx)
+	if !ok {
+		return
+	}
+	channelID, ok := optionalChannelID(ctx, ctx.Query("channelId"))
+	if !ok {
+		return
+	}
+	emojis, err := sc.StickerService.ListEmojis(userID, channelID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"emojis": emojis})
+}
+
+// POST /api/emojis  (form-data: file, shortcode, channelId?)
+func (sc *StickerController) CreateEmojiHandler(ctx *gin.Context) {
+	userID, _, ok := stickerUser(ctx)
+	if !ok {
+		return
+	}
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, services.CustomEmojiMaxFileSize+(1<<20))
+	fh, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Thiếu file hoặc file không hợp lệ"})
+		return
+	}
+	channelID, ok := optionalChannelID(ctx, ctx.PostForm("channelId"))
+	if !ok {
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Không thể mở file upload"})
+		return
+	}
+	emoji, err := sc.StickerService.CreateEmoji(userID, ctx.PostForm("shortcode"), channelID, f, fh)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusCreated, emoji)
+}
+
+// DELETE /api/emojis/:emojiID
+func (sc *StickerController) DeleteEmojiHandler(ctx *gin.Context) {
+	userID, ids, ok := stickerUser(ctx, "emojiID")
+	if !ok {
+		return
+	}
+	if err := sc.StickerService.DeleteEmoji(ids[0], userID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Đã xoá emoji"})
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"net/http"
+
+	"chat-app-backend/models"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type StorageController struct {
+	QuotaService *services.StorageQuotaService
+}
+
+func NewStorageController(qs *services.StorageQuotaService) *StorageController {
+	return &StorageController{QuotaService: qs}
+}
+
+// GET /api/users/me/storage → {used, limit, remaining, byType: {Image, Video, Audio, Document}}; limit 0 = không giới hạn
+func (sc *StorageController) GetMyStorageHandler(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	limit, err := sc.QuotaService.UserLimit(userID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	usage, err := sc.QuotaService.Usage(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	byType := make(map[models.FileType]int64, len(services.FileTypes))
+	for _, t := range services.FileTypes {
+		byType[t] = usage.ByType[t]
+	}
+	resp := gin.H{"used": usage.Used, "limit": limit, "byType": byType}
+	if limit > 0 {
+		resp["remaining"] = max(limit-usage.Used, 0)
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// body {"quota": <byte>} đặt quota riêng, {"quota": null} quay về mặc định; 0 = không giới hạn
+type storageQuotaRequest struct {
+	Quota *int64 `json:"quota"`
+}
+
+// PUT /api/admin/users/:userID/storage-quota
+func (sc *StorageController) SetUserQuotaHandler(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.Param("userID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid userID"})
+		return
+	}
+	var body storageQuotaRequest
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := sc.QuotaService.SetUserLimit(userID, body.Quota); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Storage quota updated"})
+}
+
+// PUT /api/admin/channels/:channelID/storage-quota
+func (sc *StorageController) SetChannelQuotaHandler(ctx *gin.Context) {
+	channelID, err := primitive.ObjectIDFromHex(ctx.Param("channelID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid channelID"})
+		return
+	}
+	var body storageQuotaRequest
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := sc.QuotaService.SetChannelLimit(channelID, body.Quota); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Storage quota updated"})
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"chat-app-backend/models"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UploadSessionController struct {
+	UploadService *services.UploadSessionService
+}
+
+func NewUploadSessionController(us *services.UploadSessionService) *UploadSessionController {
+	return &UploadSessionController{UploadService: us}
+}
+
+// uploadSessionIDs lấy user từ token và uploadID từ path
+func uploadSessionIDs(ctx *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	sessionID, err := primitive.ObjectIDFromHex(ctx.Param("uploadID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid uploadID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, sessionID, true
+}
+
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUploadNotActive), errors.Is(err, services.ErrUploadIncomplete):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrUploadQuotaExceeded), errors.Is(err, services.ErrStorageQuotaExceeded),
+		errors.Is(err, services.ErrFileTooLargeToScan):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrFileTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
+
+// uploadSessionResponse: trạng thái lượt upload kèm các khoảng byte đã nhận và chunk còn thiếu (để resume)
+func uploadSessionResponse(session *models.UploadSession) gin.H {
+	return gin.H{
+		"id":             session.ID,
+		"fileName":       session.FileName,
+		"size":           session.Size,
+		"chunkSize":      session.ChunkSize,
+		"totalChunks":    session.TotalChunks,
+		"status":         session.Status,
+		"receivedChunks": session.Received,
+		"receivedRanges": services.ReceivedRanges(session),
+		"missingChunks":  services.MissingChunks(session),
+		"fileId":         session.FileID,
+		"expiresAt":      session.ExpiresAt,
+	}
+}
+
+// POST /api/uploads  body {"fileName", "size", "sha256"}
+func (uc *UploadSessionController) InitiateHandler(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var body struct {
+		FileName string `json:"fileName"`
+		Size     int64  `json:"size"`
+		SHA256   string `json:"sha256"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	session, err := uc.UploadService.Initiate(userID, body.FileName, body.Size, body.SHA256)
+	if err != nil {
+		ctx.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusCreated, uploadSessionResponse(session))
+}
+
+// GET /api/uploads/:uploadID → chunk đã nhận / còn thiếu, dùng để resume sau khi mất kết nối
+func (uc *UploadSessionController) GetHandler(ctx *gin.Context) {
+	userID, sessionID, ok := uploadSessionIDs(ctx)
+	if !ok {
+		return
+	}
+	session, err := uc.UploadService.GetSession(userID, sessionID)
+	if err != nil {
+		ctx.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, uploadSessionResponse(session))
+}
+
+// PUT /api/uploads/:uploadID/chunks/:index  body: dữ liệu nhị phân của chunk, header X-Chunk-SHA256
+func (uc *UploadSessionController) PutChunkHandler(ctx *gin.Context) {
+	userID, sessionID, ok := uploadSessionIDs(ctx)
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(ctx.Param("index"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid chunk index"})
+		return
+	}
+	// chặn body lớn hơn một chunk; service kiểm tra kích thước chính xác
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, uc.UploadService.ChunkSize+1)
+
+	session, err := uc.UploadService.PutChunk(userID, sessionID, index, ctx.Request.Body, ctx.GetHeader("X-Chunk-SHA256"))
+	if err != nil {
+		ctx.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, uploadSessionResponse(session))
+}
+
+// POST /api/uploads/:uploadID/complete → ghép chunk, kiểm tra SHA-256 cả file và tạo file như POST /uploads
+func (uc *UploadSessionController) CompleteHandler(ctx *gin.Context) {
+	userID, sessionID, ok := uploadSessionIDs(ctx)
+	if !ok {
+		return
+	}
+	saved, err := uc.UploadService.Complete(userID, sessionID)
+	if err != nil {
+		resp := gin.H{"error": err.Error()}
+		if errors.Is(err, services.ErrUploadIncomplete) {
+			if session, getErr := uc.UploadService.GetSession(userID, sessionID); getErr == nil {
+				resp["missingChunks"] = services.MissingChunks(session)
+			}
+		}
+		ctx.JSON(uploadErrorStatus(err), resp)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":         saved.ID,
+		"url":        saved.URL,
+		"size":       saved.FileSize,
+		"fileType":   saved.FileType,
+		"mime":       saved.Mime,
+		"duration":   saved.Duration,
+		"waveform":   saved.Waveform,
+		"width":      saved.Width,
+		"height":     saved.Height,
+		"thumbnails": saved.Thumbnails,
+	})
+}
+
+// DELETE /api/uploads/:uploadID → huỷ lượt upload
+func (uc *UploadSessionController) AbortHandler(ctx *gin.Context) {
+	userID, sessionID, ok := uploadSessionIDs(ctx)
+	if !ok {
+		return
+	}
+	if err := uc.UploadService.Abort(userID, sessionID); err != nil {
+		ctx.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Upload cancelled"})
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"chat-app-backend/models"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"time"
+)
+
+// UserChannelController xử lý cài đặt riêng của từng user với một hội thoại (tắt thông báo, lưu trữ, ghim)
+type UserChannelController struct {
+	UserChannelService *services.UserChannelService
+}
+
+func NewUserChannelController(ucs *services.UserChannelService) *UserChannelController {
+	return &UserChannelController{UserChannelService: ucs}
+}
+
+func userChannelIDs(ctx *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	channelID, err := primitive.ObjectIDFromHex(ctx.Param("channelID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel id"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, channelID, true
+}
+
+func userChannelSettings(uc *models.UserChannel) gin.H {
+	return gin.H{
+		"channelID":  uc.ChannelID,
+		"muted":      uc.IsMuted(),
+		"mutedUntil": uc.MutedUntil,
+		"archived":   uc.Archived,
+		"pinned":     uc.Pinned,
+	}
+}
+
+// Tắt thông báo: body {"durationSeconds": n}; n > 0 = trong n giây, -1 = vô thời hạn, 0 = bật lại
+func (ucc *UserChannelController) MuteHandler(ctx *gin.Context) {
+	userID, channelID, ok := userChannelIDs(ctx)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DurationSeconds *int64 `json:"durationSeconds"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.DurationSeconds == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "durationSeconds required"})
+		return
+	}
+
+	uc, err := ucc.UserChannelService.SetMute(userID, channelID, time.Duration(*req.DurationSeconds)*time.Second)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, userChannelSettings(uc))
+}
+
+// Lưu trữ hội thoại: body {"archived": true|false}
+func (ucc *UserChannelController) ArchiveHandler(ctx *gin.Context) {
+	userID, channelID, ok := userChannelIDs(ctx)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Archived *bool `json:"archived"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Archived == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "archived required"})
+		return
+	}
+
+	uc, err := ucc.UserChannelService.SetArchived(userID, channelID, *req.Archived)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, userChannelSettings(uc))
+}
+
+// Ghim hội thoại: body {"pinned": true|false}
+func (ucc *UserChannelController) PinHandler(ctx *gin.Context) {
+	userID, channelID, ok := userChannelIDs(ctx)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Pinned *bool `json:"pinned"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Pinned == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "pinned required"})
+		return
+	}
+
+	uc, err := ucc.UserChannelService.SetPinned(userID, channelID, *req.Pinned)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, userChannelSettings(uc))
+}
@@ -494,7 +494,7 @@ func (uc *UserController) UpdateAvatarHandler(c *gin.Context) {
 		return
 	}
 
-	saved, err := fs.SaveUpload(f, file)
+	saved, err := fs.SaveUpload(objID, f, file)
 	if err != nil {
 		log.Println("[UpdateAvatarHandler] Lỗi khi upload:", err)
 		c.JSON(500, gin.H{"error": "Không thể upload file"})
@@ -541,7 +541,7 @@ func (uc *UserController) UpdateCoverPhotoHandler(c *gin.Context) {
 		return
 	}
 
-	saved, err := fs.SaveUpload(f, file)
+	saved, err := fs.SaveUpload(objID, f, file)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Không thể upload file"})
 		return
@@ -2,6 +2,7 @@
 package controllers
 
 import (
+	"chat-app-backend/models"
 	"chat-app-backend/services"
 	"github.com/gorilla/websocket"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,7 +12,7 @@ import (
 )
 
 type WebRTCController struct {
-	Connections    map[string]*websocket.Conn
+	Connections    map[string]map[*websocket.Conn]bool // mỗi user có thể mở nhiều kết nối (nhiều thiết bị/tab)
 	MessageService *services.MessageService
 	ChannelService *services.ChannelService
 	mu             sync.Mutex
@@ -20,7 +21,7 @@ type WebRTCController struct {
 // Khởi tạo controller
 func NewWebRTCController(ms *services.MessageService, cs *services.ChannelService) *WebRTCController {
 	return &WebRTCController{
-		Connections:    make(map[string]*websocket.Conn),
+		Connections:    make(map[string]map[*websocket.Conn]bool),
 		MessageService: ms,
 		ChannelService: cs,
 	}
@@ -32,28 +33,57 @@ var upgraderWebRTC = websocket.Upgrader{
 	},
 }
 
-// Gửi thông báo đến một user cụ thể
-func (wc *WebRTCController) NotifyUser(userID string, message interface{}) {
+// AddConnection ghi nhận thêm một kết nối của user
+func (wc *WebRTCController) AddConnection(userID string, conn *websocket.Conn) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if wc.Connections[userID] == nil {
+		wc.Connections[userID] = make(map[*websocket.Conn]bool)
+	}
+	wc.Connections[userID][conn] = true
+}
+
+// RemoveConnection bỏ kết nối đã đóng của user
+func (wc *WebRTCController) RemoveConnection(userID string, conn *websocket.Conn) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	delete(wc.Connections[userID], conn)
+	if len(wc.Connections[userID]) == 0 {
+		delete(wc.Connections, userID)
+	}
+}
+
+// userConns sao chép danh sách kết nối của user để ghi ngoài khoá
+func (wc *WebRTCController) userConns(userID string) []*websocket.Conn {
 	wc.mu.Lock()
-	conn, ok := wc.Connections[userID]
-	wc.mu.Unlock()
+	defer wc.mu.Unlock()
+	conns := make([]*websocket.Conn, 0, len(wc.Connections[userID]))
+	for conn := range wc.Connections[userID] {
+		conns = append(conns, conn)
+	}
+	return conns
+}
 
-	if ok {
-		err := conn.WriteJSON(message)
-		if err != nil {
+// Gửi thông báo đến mọi kết nối của một user
+func (wc *WebRTCController) NotifyUser(userID string, message interface{}) {
+	for _, conn := range wc.userConns(userID) {
+		if err := conn.WriteJSON(message); err != nil {
 			log.Printf("Error sending message to user %s: %v\n", userID, err)
 		}
 	}
 }
 
+// BroadcastMessage gửi sự kiện tới các thành viên kênh đang kết nối.
+// Sự kiện "message_new" gửi tới thành viên đang tắt thông báo kênh được gắn "muted": true để client không phát âm báo/thông báo.
 func (wc *WebRTCController) BroadcastMessage(channelID primitive.ObjectID, message interface{}) {
 	log.Printf("[BroadcastMessage] Vị trí 1")
 	channel, err := wc.ChannelService.GetChannel(channelID)
-	log.Printf("[BroadcastMessage] Lấy kênh: %s", channel)
+	log.Printf("[BroadcastMessage] Lấy kênh: %v", channel)
 	if err != nil {
 		log.Printf("Error getting channel: %v\n", err)
 		return
 	}
+	muted := wc.mutedMembers(channel, message)
 
 	wc.mu.Lock()
 	log.Printf("[BroadcastMessage] Vị trí 2")
@@ -61,9 +91,17 @@ func (wc *WebRTCController) BroadcastMessage(channelID primitive.ObjectID, messa
 	log.Printf("[BroadcastMessage] Vị trí 3, Connections: %v", wc.Connections)
 	for _, member := range channel.Members {
 		log.Printf("[BroadcastMessage] Vị trí 4, memberID: %s, Connections keys: %v", member.MemberID.Hex(), wc.Connections)
-		if conn, ok := wc.Connections[member.MemberID.Hex()]; ok {
-			log.Printf("[BroadcastMessage] Vị trí 5")
-			err := conn.WriteJSON(message)
+		conns := wc.Connections[member.MemberID.Hex()]
+		if len(conns) == 0 {
+			continue
+		}
+		log.Printf("[BroadcastMessage] Vị trí 5")
+		payload := message
+		if muted[member.MemberID] {
+			payload = withMuted(message.(map[string]interface{}))
+		}
+		for conn := range conns {
+			err := conn.WriteJSON(payload)
 			log.Printf("[BroadcastMessage]Broadcasting message to user %s: %+v\n", member.MemberID.Hex(), err)
 			if err != nil {
 				log.Printf("Error sending message to user %s: %v\n", member.MemberID.Hex(), err)
@@ -71,3 +109,31 @@ func (wc *WebRTCController) BroadcastMessage(channelID primitive.ObjectID, messa
 		}
 	}
 }
+
+// mutedMembers trả các thành viên đang tắt thông báo kênh nếu message là sự kiện "message_new", còn lại nil
+func (wc *WebRTCController) mutedMembers(channel *models.Channel, message interface{}) map[primitive.ObjectID]bool {
+	event, ok := message.(map[string]interface{})
+	if !ok || event["type"] != "message_new" || wc.MessageService == nil {
+		return nil
+	}
+	memberIDs := make([]primitive.ObjectID, 0, len(channel.Members))
+	for _, member := range channel.Members {
+		memberIDs = append(memberIDs, member.MemberID)
+	}
+	muted, err := wc.MessageService.UserChannelService.MutedUserIDs(channel.ID, memberIDs)
+	if err != nil {
+		log.Printf("[BroadcastMessage] MutedUserIDs error: %v", err)
+		return nil
+	}
+	return muted
+}
+
+// withMuted sao chép sự kiện và đánh dấu muted cho người nhận đang tắt thông báo
+func withMuted(event map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(event)+1)
+	for k, v := range event {
+		out[k] = v
+	}
+	out["muted"] = true
+	return out
+}
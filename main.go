@@ -7,6 +7,7 @@ import (
 	"chat-app-backend/services"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"log"
 	"os"
 	"time"
@@ -17,16 +18,40 @@ func main() {
 	config.InitDB()
 	cfg := config.LoadConfig()
 
+	// Lệnh quản trị: `server reindex [channelID]` dựng lại search index rồi thoát
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		runReindex(os.Args[2:])
+		return
+	}
+
 	// --- Services ---
 	messageService := services.NewMessageService()
 	channelService := services.NewChannelService()
+	pollService := services.NewPollService(messageService)
 
 	// --- WebRTCController ---
 	webrtcController := controllers.NewWebRTCController(messageService, channelService)
+	channelService.Notifier = webrtcController // broadcast tin nhắn hệ thống của kênh
+	messageService.Notifier = webrtcController // báo draft_updated khi gửi tin xoá bản nháp
 
 	// --- Controllers ---
 	messageController := controllers.NewMessageController(messageService, channelService, webrtcController)
 	channelController := controllers.NewChannelController(channelService, webrtcController)
+	pollController := controllers.NewPollController(pollService, webrtcController)
+
+	// --- Background jobs ---
+	messageService.StartExpirySweeper(webrtcController, time.Minute) // dọn tin nhắn tự hủy
+	go services.NewSearchService().Warmup()                          // dựng search index cho tin nhắn cũ
+	if fileService, err := services.GetDefaultFileService(); err == nil {
+		fileService.StartGarbageCollector(6 * time.Hour)                            // dọn file không còn được dùng (FILE_GC_DAYS)
+		services.NewUploadSessionService(fileService).StartExpirySweeper(time.Hour) // dọn upload chia chunk bỏ dở
+
+		// quét mã độc xong thì nhả các tin nhắn đang chờ file đính kèm
+		fileService.OnScanComplete = messageService.ReleaseWithheld
+		fileService.StartScanRetrier(5 * time.Minute) // quét lại file còn chờ khi scanner từng lỗi
+	} else {
+		log.Printf("File GC disabled: %v", err)
+	}
 
 	router := gin.New()
 	router.Use(gin.Logger(), gin.Recovery())
@@ -37,19 +62,16 @@ func main() {
 			"http://127.0.0.1:3000",
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Chunk-SHA256"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	// --- Router (gom routes trong index.go) ---
-	routes.SetupRouter(router, messageController, channelController)
+	routes.SetupRouter(router, messageController, channelController, pollController)
 
-	// Chỉ serve folder /uploads khi STORAGE_PROVIDER=local (để test local)
-	if os.Getenv("STORAGE_PROVIDER") == "" || os.Getenv("STORAGE_PROVIDER") == "local" {
-		router.Static("/uploads", "./uploads")
-	}
+	// /uploads (local) được phục vụ qua FileController để kiểm tra quyền, xem routes/fileRoutes.go
 	router.MaxMultipartMemory = 32 << 20 // 32MB
 
 	// Run server
@@ -62,3 +84,25 @@ func main() {
 		log.Fatalf("Không thể khởi động server: %v", err)
 	}
 }
+
+func runReindex(args []string) {
+	searchService := services.NewSearchService()
+	if !searchService.Index.Persistent() {
+		log.Fatal("SEARCH_BACKEND=memory được dựng lại mỗi lần khởi động server, không cần reindex")
+	}
+
+	var channelID *primitive.ObjectID
+	if len(args) > 0 {
+		oid, err := primitive.ObjectIDFromHex(args[0])
+		if err != nil {
+			log.Fatalf("channelID không hợp lệ: %s", args[0])
+		}
+		channelID = &oid
+	}
+
+	count, err := searchService.Reindex(channelID)
+	if err != nil {
+		log.Fatalf("Reindex thất bại sau %d tin nhắn: %v", count, err)
+	}
+	log.Printf("Reindex xong: %d tin nhắn", count)
+}
@@ -0,0 +1,91 @@
+// Package media đọc metadata của file media (thời lượng, dạng sóng) mà không cần thư viện ngoài.
+package media
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"time"
+)
+
+// Số cột dạng sóng trả về cho client
+const WaveformPeaks = 64
+
+// maxAudioDuration chặn thời lượng đọc từ header hỏng hoặc cố ý sai (granule position rất lớn)
+const maxAudioDuration = 24 * time.Hour
+
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+// AudioInfo là metadata của file âm thanh; Waveform gồm tối đa WaveformPeaks giá trị 0-100
+type AudioInfo struct {
+	Format   string
+	Duration time.Duration
+	Waveform []int
+}
+
+// AnalyzeAudio nhận dạng định dạng theo magic bytes (WAV, Ogg Opus/Vorbis) và đọc metadata.
+// Reader được đọc tuần tự từ vị trí hiện tại; caller tự Seek lại nếu cần dùng tiếp.
+func AnalyzeAudio(r io.Reader) (*AudioInfo, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	magic, err := br.Peek(12)
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	switch {
+	case string(magic[0:4]) == "RIFF" && string(magic[8:12]) == "WAVE":
+		return analyzeWAV(br)
+	case string(magic[0:4]) == "OggS":
+		return analyzeOgg(br)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// samplesDuration đổi số mẫu theo tần số ra thời lượng; tính theo giây bằng số thực để không tràn int64,
+// kết quả nằm trong [0, maxAudioDuration]
+func samplesDuration(samples, rate int64) time.Duration {
+	if samples <= 0 || rate <= 0 {
+		return 0
+	}
+	seconds := float64(samples) / float64(rate)
+	if seconds >= maxAudioDuration.Seconds() {
+		return maxAudioDuration
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// peakBuckets gom các giá trị liên tiếp thành n cột, mỗi cột lấy giá trị lớn nhất
+type peakBuckets struct {
+	total int
+	peaks []float64
+}
+
+func newPeakBuckets(total int) *peakBuckets {
+	n := min(WaveformPeaks, total)
+	return &peakBuckets{total: total, peaks: make([]float64, max(n, 0))}
+}
+
+func (pb *peakBuckets) add(i int, v float64) {
+	if len(pb.peaks) == 0 || i < 0 || i >= pb.total {
+		return
+	}
+	b := i * len(pb.peaks) / pb.total
+	if v > pb.peaks[b] {
+		pb.peaks[b] = v
+	}
+}
+
+// result chuẩn hoá theo cột cao nhất về thang 0-100
+func (pb *peakBuckets) result() []int {
+	top := 0.0
+	for _, p := range pb.peaks {
+		top = max(top, p)
+	}
+	out := make([]int, len(pb.peaks))
+	if top == 0 {
+		return out
+	}
+	for i, p := range pb.peaks {
+		out[i] = int(p/top*100 + 0.5)
+	}
+	return out
+}
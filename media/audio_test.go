@@ -0,0 +1,164 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// wavFile dựng file WAV từ các chunk (id + nội dung); sizes ghi đè kích thước khai báo của chunk theo id
+func wavFile(chunks [][2]string, sizes map[string]uint32) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range chunks {
+		b.WriteString(c[0])
+		size, ok := sizes[c[0]]
+		if !ok {
+			size = uint32(len(c[1]))
+		}
+		_ = binary.Write(&b, binary.LittleEndian, size)
+		b.WriteString(c[1])
+	}
+	return b.Bytes()
+}
+
+// wavFmt là fmt chunk PCM
+func wavFmt(channels uint16, rate uint32, bits uint16) string {
+	var b bytes.Buffer
+	align := channels * bits / 8
+	for _, v := range []any{uint16(wavFormatPCM), channels, rate, rate * uint32(align), align, bits} {
+		_ = binary.Write(&b, binary.LittleEndian, v)
+	}
+	return b.String()
+}
+
+// oggPage dựng một page Ogg chứa các packet (mỗi packet kết thúc bằng segment < 255)
+func oggPage(serial uint32, granule uint64, packets ...[]byte) []byte {
+	var lacing, body []byte
+	for _, p := range packets {
+		n := len(p)
+		for ; n >= 255; n -= 255 {
+			lacing = append(lacing, 255)
+		}
+		lacing = append(lacing, byte(n))
+		body = append(body, p...)
+	}
+	hdr := make([]byte, oggHeaderSize)
+	copy(hdr, "OggS")
+	binary.LittleEndian.PutUint64(hdr[6:14], granule)
+	binary.LittleEndian.PutUint32(hdr[14:18], serial)
+	hdr[26] = byte(len(lacing))
+	return append(append(hdr, lacing...), body...)
+}
+
+func opusHead(preSkip uint16) []byte {
+	p := make([]byte, 19)
+	copy(p, "OpusHead")
+	p[8], p[9] = 1, 1
+	binary.LittleEndian.PutUint16(p[10:12], preSkip)
+	return p
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestAnalyzeAudio(t *testing.T) {
+	second := string(make([]byte, 8000*2)) // 1 giây PCM 16-bit mono 8kHz
+	opusPages := func(granule uint64) []byte {
+		return concat(
+			oggPage(1, 0, opusHead(312)),
+			oggPage(1, 0, []byte("OpusTags")),
+			oggPage(1, granule, []byte{1, 2, 3}, []byte{4, 5}),
+		)
+	}
+	// packet đầu không kết thúc (toàn segment 255): không được gom hết vào bộ nhớ
+	var unterminated []byte
+	for i := 0; i < 50; i++ {
+		page := oggPage(1, 0)
+		page[26] = 255
+		page = append(page, bytes.Repeat([]byte{255}, 255)...)
+		page = append(page, make([]byte, 255*255)...)
+		unterminated = append(unterminated, page...)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		format   string
+		duration time.Duration
+		wantErr  error // nil = chỉ cần có lỗi khi format rỗng
+	}{
+		{name: "empty", data: nil, wantErr: ErrUnsupportedFormat},
+		{name: "mp3 id3", data: []byte("ID3\x04\x00\x00\x00\x00\x00\x00\xff\xfb\x90\x00"), wantErr: ErrUnsupportedFormat},
+		{name: "mp3 frame sync", data: []byte("\xff\xfb\x90\x64\x00\x00\x00\x00\x00\x00\x00\x00"), wantErr: ErrUnsupportedFormat},
+		{name: "mp3 truncated", data: []byte("\xff\xfb"), wantErr: ErrUnsupportedFormat},
+
+		{name: "wav ok", data: wavFile([][2]string{{"fmt ", wavFmt(1, 8000, 16)}, {"data", second}}, nil),
+			format: "wav", duration: time.Second},
+		{name: "wav header only", data: []byte("RIFF\x00\x00\x00\x00WAVE")},
+		{name: "wav fmt too small", data: wavFile([][2]string{{"fmt ", "abcd"}}, nil)},
+		{name: "wav fmt huge size", data: wavFile([][2]string{{"fmt ", wavFmt(1, 8000, 16)}},
+			map[string]uint32{"fmt ": math.MaxUint32})},
+		{name: "wav data before fmt", data: wavFile([][2]string{{"data", second}}, nil)},
+		{name: "wav zero rate", data: wavFile([][2]string{{"fmt ", wavFmt(1, 0, 16)}, {"data", second}}, nil)},
+		{name: "wav 12-bit", data: wavFile([][2]string{{"fmt ", wavFmt(1, 8000, 12)}, {"data", second}}, nil),
+			wantErr: ErrUnsupportedFormat},
+		{name: "wav truncated data", data: wavFile([][2]string{{"fmt ", wavFmt(1, 8000, 16)}, {"data", second[:8000]}},
+			map[string]uint32{"data": 8000 * 2}), format: "wav", duration: 500 * time.Millisecond},
+
+		{name: "opus ok", data: opusPages(48000 + 312), format: "opus", duration: time.Second},
+		{name: "opus granule overflow", data: opusPages(math.MaxInt64), format: "opus", duration: maxAudioDuration},
+		{name: "opus granule negative", data: opusPages(math.MaxUint64 - 5), format: "opus", duration: 0},
+		{name: "opus granule below pre-skip", data: opusPages(100), format: "opus", duration: 0},
+		{name: "ogg lost sync", data: concat(oggPage(1, 0, opusHead(0)), []byte("garbage-garbage-garbage-garbage"))},
+		{name: "ogg unknown codec", data: oggPage(1, 0, []byte("FLAC-or-something-else")), wantErr: ErrUnsupportedFormat},
+		{name: "ogg truncated header", data: []byte("OggS\x00\x00\x00\x00\x00\x00\x00\x00"), wantErr: ErrUnsupportedFormat},
+		{name: "vorbis zero rate", data: oggPage(1, 0, append([]byte("\x01vorbis"), make([]byte, 23)...))},
+		{name: "ogg unterminated first packet", data: unterminated, wantErr: ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := AnalyzeAudio(bytes.NewReader(tt.data))
+			if tt.format == "" {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", info)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AnalyzeAudio: %v", err)
+			}
+			if info.Format != tt.format || info.Duration != tt.duration {
+				t.Fatalf("got %s %v, want %s %v", info.Format, info.Duration, tt.format, tt.duration)
+			}
+			if len(info.Waveform) > WaveformPeaks {
+				t.Fatalf("waveform has %d peaks, max %d", len(info.Waveform), WaveformPeaks)
+			}
+		})
+	}
+}
+
+func TestSamplesDuration(t *testing.T) {
+	tests := []struct {
+		samples, rate int64
+		want          time.Duration
+	}{
+		{48000, 48000, time.Second},
+		{1, 0, 0},
+		{-10, 48000, 0},
+		{math.MaxInt64, 1, maxAudioDuration},
+		{math.MaxInt64, math.MaxInt64, time.Second},
+	}
+	for _, tt := range tests {
+		if got := samplesDuration(tt.samples, tt.rate); got != tt.want {
+			t.Errorf("samplesDuration(%d, %d) = %v, want %v", tt.samples, tt.rate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"sort"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Giới hạn xử lý ảnh
+const (
+	MaxImagePixels       = 40_000_000 // chặn ảnh "bom giải nén"
+	jpegQuality          = 90         // khi phải mã hoá lại ảnh gốc (xoay theo EXIF)
+	thumbnailJPEGQuality = 80
+)
+
+// ThumbnailSizes là cạnh dài tối đa của các thumbnail; ảnh nhỏ hơn kích thước nào thì không tạo kích thước đó
+var ThumbnailSizes = []int{320, 1280}
+
+var ErrImageTooLarge = errors.New("image dimensions too large")
+
+type Thumbnail struct {
+	MaxEdge int
+	Width   int
+	Height  int
+	Mime    string
+	Data    []byte
+}
+
+// ImageInfo: Data là ảnh gốc đã bỏ metadata (EXIF, GPS, XMP...), Width/Height theo hướng hiển thị
+type ImageInfo struct {
+	Format     string
+	Mime       string
+	Width      int
+	Height     int
+	Data       []byte
+	Thumbnails []Thumbnail // theo kích thước tăng dần
+}
+
+// ProcessImage đọc kích thước, bỏ metadata và tạo thumbnail cho JPEG/PNG/GIF/WebP.
+// Metadata được bỏ mà không mã hoá lại ảnh; chỉ mã hoá lại khi ảnh JPEG có EXIF xoay
+// (để hướng hiển thị không đổi sau khi bỏ EXIF) hoặc khi không tách được metadata.
+func ProcessImage(data []byte) (*ImageInfo, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	info := &ImageInfo{Format: format, Mime: "image/" + format, Width: cfg.Width, Height: cfg.Height, Data: data}
+	orientation := 1
+	var stripped []byte
+	var stripErr error
+	switch format {
+	case "jpeg":
+		stripped, orientation, stripErr = stripJPEG(data)
+	case "png":
+		stripped, stripErr = stripPNG(data)
+	case "webp":
+		stripped, stripErr = stripWebP(data)
+	}
+	if stripErr == nil && stripped != nil {
+		info.Data = stripped
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(info.Data))
+	if err != nil {
+		if stripErr != nil {
+			return nil, stripErr
+		}
+		// ví dụ WebP động: vẫn nhận ảnh đã bỏ metadata nhưng không có thumbnail
+		return info, nil
+	}
+
+	if stripErr != nil || orientation != 1 {
+		img = applyOrientation(img, orientation)
+		if info.Data, info.Mime, err = encodeImage(img, format, jpegQuality); err != nil {
+			return nil, err
+		}
+		info.Width, info.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+
+	if info.Thumbnails, err = makeThumbnails(img); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// encodeImage mã hoá lại ảnh, trả kèm MIME; WebP (không có encoder) lưu dạng PNG
+func encodeImage(img image.Image, format string, quality int) ([]byte, string, error) {
+	var buf bytes.Buffer
+	var err error
+	mime := "image/png"
+	switch format {
+	case "jpeg":
+		mime = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "gif":
+		mime = "image/gif"
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), mime, err
+}
+
+func makeThumbnails(img image.Image) ([]Thumbnail, error) {
+	sizes := append([]int(nil), ThumbnailSizes...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+
+	// ảnh có trong suốt thì giữ PNG, còn lại dùng JPEG cho nhẹ
+	format := "jpeg"
+	if o, ok := img.(interface{ Opaque() bool }); ok && !o.Opaque() {
+		format = "png"
+	}
+
+	// tạo từ lớn tới nhỏ, thumbnail nhỏ thu từ thumbnail lớn để đỡ tốn CPU
+	var thumbs []Thumbnail
+	src := img
+	for _, edge := range sizes {
+		w, h := src.Bounds().Dx(), src.Bounds().Dy()
+		if max(w, h) <= edge {
+			continue
+		}
+		tw, th := edge, max(h*edge/w, 1)
+		if h > w {
+			tw, th = max(w*edge/h, 1), edge
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), xdraw.Src, nil)
+
+		data, mime, err := encodeImage(dst, format, thumbnailJPEGQuality)
+		if err != nil {
+			return nil, err
+		}
+		thumbs = append(thumbs, Thumbnail{MaxEdge: edge, Width: tw, Height: th, Mime: mime, Data: data})
+		src = dst
+	}
+
+	for i, j := 0, len(thumbs)-1; i < j; i, j = i+1, j-1 {
+		thumbs[i], thumbs[j] = thumbs[j], thumbs[i]
+	}
+	return thumbs, nil
+}
+
+// applyOrientation xoay/lật ảnh theo giá trị EXIF Orientation (1-8)
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,254 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// gpsSecret nằm trong khối EXIF của ảnh test; không được còn trong ảnh đã xử lý
+const gpsSecret = "GPS 21.0285N 105.8542E"
+
+// exifBlock dựng payload APP1 "Exif\0\0" + TIFF với IFD0 gồm Orientation và con trỏ GPS IFD
+func exifBlock(order binary.ByteOrder, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	_ = binary.Write(&tiff, order, uint16(42))
+	_ = binary.Write(&tiff, order, uint32(8)) // IFD0 ngay sau header
+
+	const entries = 2
+	gpsOffset := uint32(8 + 2 + entries*12 + 4)
+	_ = binary.Write(&tiff, order, uint16(entries))
+	// Orientation: SHORT, 1 giá trị, nằm trong 2 byte đầu của ô value
+	for _, v := range []any{uint16(0x0112), uint16(3), uint32(1), orientation, uint16(0)} {
+		_ = binary.Write(&tiff, order, v)
+	}
+	// GPSInfo IFD pointer: LONG
+	for _, v := range []any{uint16(0x8825), uint16(4), uint32(1), gpsOffset} {
+		_ = binary.Write(&tiff, order, v)
+	}
+	_ = binary.Write(&tiff, order, uint32(0)) // không có IFD tiếp theo
+	tiff.WriteString(gpsSecret)
+
+	return append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+}
+
+// segment dựng một segment JPEG có độ dài
+func segment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// quadrantImage: góc trên-trái đỏ, còn lại xanh dương, để kiểm tra hướng xoay
+func quadrantImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{B: 255, A: 255}
+			if x < w/2 && y < h/2 {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// jpegWithMetadata mã hoá ảnh rồi chèn APP1 (EXIF), APP13 (IPTC) và COM ngay sau SOI
+func jpegWithMetadata(t *testing.T, img image.Image, exif []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	data := buf.Bytes()
+	out := append([]byte(nil), data[:2]...)
+	out = append(out, segment(0xE1, exif)...)
+	out = append(out, segment(0xED, []byte("Photoshop 3.0\x00IPTC "+gpsSecret))...)
+	out = append(out, segment(0xFE, []byte("comment "+gpsSecret))...)
+	return append(out, data[2:]...)
+}
+
+func assertNoMetadata(t *testing.T, data []byte) {
+	t.Helper()
+	for _, leak := range []string{"Exif\x00\x00", gpsSecret, "IPTC"} {
+		if bytes.Contains(data, []byte(leak)) {
+			t.Fatalf("output still contains %q", leak)
+		}
+	}
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xC000 && g < 0x4000 && b < 0x4000
+}
+
+func TestStripJPEGRemovesEXIF(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := jpegWithMetadata(t, quadrantImage(64, 32), exifBlock(order, 6))
+		stripped, orientation, err := stripJPEG(data)
+		if err != nil {
+			t.Fatalf("stripJPEG: %v", err)
+		}
+		if orientation != 6 {
+			t.Fatalf("%v: orientation = %d, want 6", order, orientation)
+		}
+		assertNoMetadata(t, stripped)
+		if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+			t.Fatalf("stripped JPEG does not decode: %v", err)
+		}
+	}
+
+	for _, bad := range [][]byte{nil, []byte("\xff\xd8"), []byte("\xff\xd8\x00\x00"), []byte("\xff\xd8\xff\xe1\xff\xff")} {
+		if _, _, err := stripJPEG(bad); err == nil {
+			t.Fatalf("stripJPEG(%q) must fail", bad)
+		}
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"little endian", exifBlock(binary.LittleEndian, 3)[6:], 3},
+		{"big endian", exifBlock(binary.BigEndian, 8)[6:], 8},
+		{"out of range", exifBlock(binary.LittleEndian, 9)[6:], 1},
+		{"truncated", exifBlock(binary.LittleEndian, 6)[6:12], 1},
+		{"bad byte order", []byte("XX\x00\x2a\x00\x00\x00\x08"), 1},
+	}
+	for _, tt := range tests {
+		if got := exifOrientation(tt.tiff); got != tt.want {
+			t.Errorf("%s: exifOrientation = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcessImageJPEG(t *testing.T) {
+	tests := []struct {
+		orientation   uint16
+		width, height int
+		redX, redY    int // điểm nằm trong ô đỏ sau khi xoay
+	}{
+		{orientation: 1, width: 80, height: 40, redX: 10, redY: 10},
+		{orientation: 3, width: 80, height: 40, redX: 70, redY: 30}, // xoay 180°
+		{orientation: 6, width: 40, height: 80, redX: 30, redY: 10}, // xoay 90° theo chiều kim đồng hồ
+		{orientation: 8, width: 40, height: 80, redX: 10, redY: 70}, // xoay 90° ngược chiều
+	}
+	for _, tt := range tests {
+		data := jpegWithMetadata(t, quadrantImage(80, 40), exifBlock(binary.LittleEndian, tt.orientation))
+		info, err := ProcessImage(data)
+		if err != nil {
+			t.Fatalf("orientation %d: ProcessImage: %v", tt.orientation, err)
+		}
+		assertNoMetadata(t, info.Data)
+		if info.Width != tt.width || info.Height != tt.height || info.Mime != "image/jpeg" {
+			t.Fatalf("orientation %d: got %s %dx%d, want %dx%d", tt.orientation, info.Mime, info.Width, info.Height, tt.width, tt.height)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(info.Data))
+		if err != nil {
+			t.Fatalf("orientation %d: decode output: %v", tt.orientation, err)
+		}
+		if b := img.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+			t.Fatalf("orientation %d: decoded %v", tt.orientation, b)
+		}
+		if !isRed(img.At(tt.redX, tt.redY)) {
+			t.Fatalf("orientation %d: pixel (%d,%d) = %v, want red", tt.orientation, tt.redX, tt.redY, img.At(tt.redX, tt.redY))
+		}
+	}
+}
+
+// pngChunk dựng một chunk PNG kèm CRC
+func pngChunk(kind string, payload []byte) []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, uint32(len(payload)))
+	b.WriteString(kind)
+	b.Write(payload)
+	_ = binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(kind), payload...)))
+	return b.Bytes()
+}
+
+func TestProcessImagePNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, quadrantImage(40, 20)); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	data := buf.Bytes()
+	// chèn tEXt và eXIf ngay sau IHDR (8 byte chữ ký + 25 byte IHDR)
+	withMeta := append([]byte(nil), data[:33]...)
+	withMeta = append(withMeta, pngChunk("tEXt", []byte("Comment\x00"+gpsSecret))...)
+	withMeta = append(withMeta, pngChunk("eXIf", exifBlock(binary.BigEndian, 1)[6:])...)
+	withMeta = append(withMeta, data[33:]...)
+
+	info, err := ProcessImage(withMeta)
+	if err != nil {
+		t.Fatalf("ProcessImage: %v", err)
+	}
+	assertNoMetadata(t, info.Data)
+	if info.Mime != "image/png" || info.Width != 40 || info.Height != 20 {
+		t.Fatalf("got %s %dx%d", info.Mime, info.Width, info.Height)
+	}
+}
+
+func TestProcessImageTooLarge(t *testing.T) {
+	// chỉ cần header: kích thước khai báo vượt MaxImagePixels thì từ chối trước khi giải mã
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], 10_000)
+	binary.BigEndian.PutUint32(ihdr[4:8], MaxImagePixels/10_000+1)
+	ihdr[8], ihdr[9] = 8, 2 // 8 bit, RGB
+	data := append([]byte("\x89PNG\r\n\x1a\n"), pngChunk("IHDR", ihdr)...)
+	data = append(data, pngChunk("IEND", nil)...)
+
+	if _, err := ProcessImage(data); !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("err = %v, want ErrImageTooLarge", err)
+	}
+	if _, err := ProcessImage([]byte("not an image")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("err = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestMakeThumbnails(t *testing.T) {
+	tests := []struct {
+		name   string
+		img    image.Image
+		sizes  [][2]int // theo thứ tự tăng dần
+		format string
+	}{
+		{"landscape", quadrantImage(2000, 1000), [][2]int{{320, 160}, {1280, 640}}, "image/jpeg"},
+		{"portrait", quadrantImage(1000, 2000), [][2]int{{160, 320}, {640, 1280}}, "image/jpeg"},
+		{"between sizes", quadrantImage(500, 300), [][2]int{{320, 192}}, "image/jpeg"},
+		{"small", quadrantImage(320, 200), nil, ""},
+		{"transparent", image.NewNRGBA(image.Rect(0, 0, 400, 400)), [][2]int{{320, 320}}, "image/png"},
+	}
+	for _, tt := range tests {
+		thumbs, err := makeThumbnails(tt.img)
+		if err != nil {
+			t.Fatalf("%s: makeThumbnails: %v", tt.name, err)
+		}
+		if len(thumbs) != len(tt.sizes) {
+			t.Fatalf("%s: %d thumbnails, want %d", tt.name, len(thumbs), len(tt.sizes))
+		}
+		for i, th := range thumbs {
+			if th.Width != tt.sizes[i][0] || th.Height != tt.sizes[i][1] || th.Mime != tt.format {
+				t.Fatalf("%s: thumbnail %d = %s %dx%d, want %s %dx%d", tt.name, i, th.Mime, th.Width, th.Height,
+					tt.format, tt.sizes[i][0], tt.sizes[i][1])
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(th.Data))
+			if err != nil || cfg.Width != th.Width || cfg.Height != th.Height {
+				t.Fatalf("%s: thumbnail %d decodes as %+v, %v", tt.name, i, cfg, err)
+			}
+		}
+	}
+}
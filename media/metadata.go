@@ -0,0 +1,170 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("malformed image")
+
+// stripJPEG bỏ các segment chứa metadata (EXIF/XMP ở APP1, IPTC ở APP13, comment) mà không giải mã lại ảnh.
+// Giữ APP0 (JFIF), APP2 (ICC profile) và APP14 (Adobe, cần cho màu CMYK). Trả kèm orientation trong EXIF (1 nếu không có).
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	orientation := 1
+
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, 0, errMalformed
+		}
+		// bỏ các byte 0xFF đệm
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, 0, errMalformed
+		}
+		marker := data[i+1]
+
+		// marker không có độ dài
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		if marker == 0xD9 {
+			out.Write(data[i : i+2])
+			return out.Bytes(), orientation, nil
+		}
+		if i+4 > len(data) {
+			return nil, 0, errMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			return nil, 0, errMalformed
+		}
+
+		switch {
+		case marker == 0xDA:
+			// Start of Scan: phần còn lại là dữ liệu ảnh nén, giữ nguyên
+			out.Write(data[i:])
+			return out.Bytes(), orientation, nil
+		case marker == 0xE1:
+			if payload := data[i+4 : end]; bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				orientation = exifOrientation(payload[6:])
+			}
+		case marker == 0xED, marker == 0xFE:
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return nil, 0, errMalformed
+}
+
+// exifOrientation đọc tag Orientation (0x0112) trong IFD0 của khối TIFF
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(bo.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(bo.Uint16(tiff[ifd : ifd+2]))
+	for e := 0; e < count; e++ {
+		off := ifd + 2 + e*12
+		if off+12 > len(tiff) {
+			break
+		}
+		if bo.Uint16(tiff[off:off+2]) == 0x0112 {
+			if o := int(bo.Uint16(tiff[off+8 : off+10])); o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// stripPNG bỏ các chunk metadata: eXIf, tEXt, iTXt, zTXt, tIME
+func stripPNG(data []byte) ([]byte, error) {
+	const sig = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(sig)) {
+		return nil, errMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.WriteString(sig)
+
+	i := len(sig)
+	for i+12 <= len(data) {
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:i+4]))
+		if end > len(data) || end < i {
+			return nil, errMalformed
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "iTXt", "zTXt", "tIME":
+		default:
+			out.Write(data[i:end])
+		}
+		if string(data[i+4:i+8]) == "IEND" {
+			return out.Bytes(), nil
+		}
+		i = end
+	}
+	return nil, errMalformed
+}
+
+// stripWebP bỏ chunk EXIF và XMP trong container RIFF, xoá cờ tương ứng ở VP8X và tính lại kích thước RIFF
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	i := 12
+	for i+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := i + 8 + size + size%2 // chunk lẻ được đệm 1 byte
+		if end > len(data) || end < i {
+			// một số encoder không ghi byte đệm cho chunk cuối
+			if end == len(data)+1 && size%2 == 1 {
+				end = len(data)
+			} else {
+				return nil, errMalformed
+			}
+		}
+		switch fourcc := string(data[i : i+4]); fourcc {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04 // cờ EXIF, XMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:8], uint32(len(result)-8))
+	return result, nil
+}
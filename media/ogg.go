@@ -0,0 +1,137 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	oggHeaderSize   = 27
+	oggIDHeaderMax  = 64    // packet nhận dạng codec chỉ cần 30 byte đầu
+	opusGranuleRate = 48000 // granule của Opus luôn tính theo 48kHz
+)
+
+// analyzeOgg đọc các page của luồng logic đầu tiên (Opus hoặc Vorbis).
+// Thời lượng lấy từ granule position của page cuối. Không giải mã âm thanh nên dạng sóng
+// được ước lượng từ kích thước từng packet: codec VBR dùng ít bit cho đoạn im lặng.
+func analyzeOgg(br *bufio.Reader) (*AudioInfo, error) {
+	var (
+		serial      uint32
+		codec       string
+		headers     int // số packet header của codec, không tính vào dạng sóng
+		sampleRate  int64
+		preSkip     int64
+		lastGranule int64 = -1
+		packetIdx   int
+		packetSize  int
+		firstPacket []byte
+		sizes       []int
+	)
+
+	hdr := make([]byte, oggHeaderSize)
+	first := true
+	for {
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			if first {
+				return nil, ErrUnsupportedFormat
+			}
+			break // hết file (hoặc page cuối bị cắt)
+		}
+		if string(hdr[0:4]) != "OggS" {
+			return nil, errors.New("ogg: lost page sync")
+		}
+		granule := int64(binary.LittleEndian.Uint64(hdr[6:14]))
+		pageSerial := binary.LittleEndian.Uint32(hdr[14:18])
+		lacing := make([]byte, hdr[26])
+		if _, err := io.ReadFull(br, lacing); err != nil {
+			break
+		}
+		bodySize := 0
+		for _, l := range lacing {
+			bodySize += int(l)
+		}
+		body := make([]byte, bodySize)
+		if _, err := io.ReadFull(br, body); err != nil {
+			break
+		}
+
+		if first {
+			serial = pageSerial
+			first = false
+		}
+		if pageSerial != serial {
+			continue // bỏ qua các luồng logic khác (ví dụ video)
+		}
+		if granule >= 0 {
+			lastGranule = granule
+		}
+
+		offset := 0
+		for _, l := range lacing {
+			if packetIdx == 0 && len(firstPacket) < oggIDHeaderMax {
+				firstPacket = append(firstPacket, body[offset:offset+int(l)]...)
+			}
+			offset += int(l)
+			packetSize += int(l)
+			if l == 255 {
+				continue // packet tiếp tục ở segment sau
+			}
+
+			if packetIdx == 0 {
+				var err error
+				codec, headers, sampleRate, preSkip, err = parseOggIDHeader(firstPacket)
+				if err != nil {
+					return nil, err
+				}
+			} else if packetIdx >= headers {
+				sizes = append(sizes, packetSize)
+			}
+			packetIdx++
+			packetSize = 0
+		}
+	}
+
+	if codec == "" {
+		return nil, ErrUnsupportedFormat
+	}
+	info := &AudioInfo{Format: codec, Waveform: packetSizeWaveform(sizes)}
+	if lastGranule > preSkip {
+		info.Duration = samplesDuration(lastGranule-preSkip, sampleRate)
+	}
+	return info, nil
+}
+
+// parseOggIDHeader đọc packet nhận dạng codec; trả về tên codec, số packet header,
+// tần số của granule và số mẫu pre-skip (Opus)
+func parseOggIDHeader(p []byte) (string, int, int64, int64, error) {
+	switch {
+	case len(p) >= 19 && bytes.HasPrefix(p, []byte("OpusHead")):
+		return "opus", 2, opusGranuleRate, int64(binary.LittleEndian.Uint16(p[10:12])), nil
+	case len(p) >= 30 && bytes.HasPrefix(p, []byte("\x01vorbis")):
+		rate := int64(binary.LittleEndian.Uint32(p[12:16]))
+		if rate == 0 {
+			return "", 0, 0, 0, errors.New("ogg: invalid vorbis sample rate")
+		}
+		return "vorbis", 3, rate, 0, nil
+	}
+	return "", 0, 0, 0, ErrUnsupportedFormat
+}
+
+// packetSizeWaveform coi packet nhỏ nhất là mức im lặng và chia cột theo thứ tự packet
+func packetSizeWaveform(sizes []int) []int {
+	if len(sizes) == 0 {
+		return []int{}
+	}
+	floor := sizes[0]
+	for _, s := range sizes {
+		floor = min(floor, s)
+	}
+	pb := newPeakBuckets(len(sizes))
+	for i, s := range sizes {
+		pb.add(i, float64(s-floor))
+	}
+	return pb.result()
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// AdminMiddleware - chỉ cho phép user có role quản trị viên (dùng sau AuthMiddleware)
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token không chứa thông tin người dùng hợp lệ"})
+			c.Abort()
+			return
+		}
+
+		var user models.User
+		if err := config.DB.Collection("users").FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Không tìm thấy người dùng"})
+			c.Abort()
+			return
+		}
+		if user.Role != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Chỉ quản trị viên mới có quyền thực hiện"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
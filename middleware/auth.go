@@ -145,3 +145,30 @@ func CurrentUserMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// OptionalAuthMiddleware - gán user_id nếu có Bearer token hợp lệ, không có hoặc sai thì vẫn cho qua
+// (dùng cho route vừa nhận token vừa nhận URL đã ký, ví dụ download file)
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		secret := os.Getenv("JWT_SECRET")
+		if tokenString == "" || secret == "" {
+			c.Next()
+			return
+		}
+		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New("phương pháp ký không hợp lệ")
+			}
+			return []byte(secret), nil
+		})
+		if err == nil && token.Valid {
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				if userID, ok := claims["user_id"].(string); ok && userID != "" {
+					c.Set("user_id", userID)
+				}
+			}
+		}
+		c.Next()
+	}
+}
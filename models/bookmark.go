@@ -0,0 +1,17 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Bookmark là tin nhắn được người dùng lưu lại (kèm ghi chú tuỳ chọn)
+type Bookmark struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"userID" bson:"userID"`
+	MessageID primitive.ObjectID `json:"messageID" bson:"messageID"`
+	ChannelID primitive.ObjectID `json:"channelID" bson:"channelID"`
+	Note      string             `json:"note,omitempty" bson:"note,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
@@ -48,4 +48,5 @@ type Channel struct {
 	BlockMembers []primitive.ObjectID   `json:"blockMembers" bson:"blockMembers"`
 	ExtraData    map[string]interface{} `json:"extraData" bson:"extraData,omitempty"`
 	Avatar       string                 `json:"avatar" bson:"avatar"`
+	StorageQuota *int64                 `json:"storageQuota,omitempty" bson:"storageQuota,omitempty"` // byte; nil = theo CHANNEL_STORAGE_QUOTA, 0 = không giới hạn
 }
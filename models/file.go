@@ -14,12 +14,68 @@ const (
 	FileTypeDocument FileType = "Document"
 )
 
+// ScanStatus là trạng thái quét mã độc của file; rỗng = file có từ trước khi bật quét (coi như sạch)
+type ScanStatus string
+
+const (
+	ScanStatusPending  ScanStatus = "pending" // đang chờ quét: chỉ người upload xem được, tin nhắn chứa file bị giữ lại
+	ScanStatusClean    ScanStatus = "clean"
+	ScanStatusInfected ScanStatus = "infected" // đã xoá khỏi storage, không ai tải được
+	ScanStatusError    ScanStatus = "error"    // quét lỗi quá số lần cho phép: như pending nhưng tin nhắn chứa file bị từ chối
+)
+
+// Thumbnail là bản thu nhỏ của ảnh, lưu cùng provider với ảnh gốc
+type Thumbnail struct {
+	URL    string `json:"url" bson:"url"`
+	Key    string `json:"-" bson:"key,omitempty"` // key trên storage, dùng để xoá
+	Width  int32  `json:"width" bson:"width"`
+	Height int32  `json:"height" bson:"height"`
+}
+
 // File là cấu trúc đại diện cho tệp liên quan đến tin nhắn
 type File struct {
-	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`      // ID tự động của MongoDB
-	FileName   string             `json:"fileName" bson:"fileName"`     // Tên tệp
-	FileType   FileType           `json:"fileType" bson:"fileType"`     // Loại tệp
-	FileSize   int64              `json:"fileSize" bson:"fileSize"`     // Kích thước tệp (tính bằng byte)
-	UploadTime time.Time          `json:"uploadTime" bson:"uploadTime"` // Thời gian tải tệp lên
-	URL        string             `json:"url" bson:"url"`               // Đường dẫn tải về hoặc xem tệp
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`                    // ID tự động của MongoDB
+	FileName   string              `json:"fileName" bson:"fileName"`                   // Tên tệp
+	FileType   FileType            `json:"fileType" bson:"fileType"`                   // Loại tệp
+	FileSize   int64               `json:"fileSize" bson:"fileSize"`                   // Kích thước tệp (tính bằng byte)
+	UploadTime time.Time           `json:"uploadTime" bson:"uploadTime"`               // Thời gian tải tệp lên
+	URL        string              `json:"url" bson:"url"`                             // Đường dẫn tải về hoặc xem tệp
+	OwnerID    *primitive.ObjectID `json:"ownerId,omitempty" bson:"ownerId,omitempty"` // người upload
+	Provider   string              `json:"-" bson:"provider,omitempty"`                // storage lưu file ("local", "cloudinary")
+	StorageKey string              `json:"-" bson:"storageKey,omitempty"`              // key trên provider, dùng để xoá
+	SHA256     string              `json:"sha256,omitempty" bson:"sha256,omitempty"`   // checksum nội dung gốc; có giá trị thì object dùng chung qua Blob
+	// UnreferencedSince: lần đầu GC thấy file không còn được dùng (nil = đang được dùng hoặc chưa quét)
+	UnreferencedSince *time.Time  `json:"-" bson:"unreferencedSince,omitempty"`
+	Mime              string      `json:"mime,omitempty" bson:"mime,omitempty"`         // MIME type phát hiện khi upload
+	Duration          int32       `json:"duration,omitempty" bson:"duration,omitempty"` // audio: thời lượng (giây)
+	Waveform          []int       `json:"waveform,omitempty" bson:"waveform,omitempty"` // audio: dạng sóng 0-100
+	Width             int32       `json:"width,omitempty" bson:"width,omitempty"`       // ảnh: kích thước theo hướng hiển thị
+	Height            int32       `json:"height,omitempty" bson:"height,omitempty"`
+	Thumbnails        []Thumbnail `json:"thumbnails,omitempty" bson:"thumbnails,omitempty"` // ảnh: tăng dần theo kích thước
+	ScanStatus        ScanStatus  `json:"scanStatus,omitempty" bson:"scanStatus,omitempty"`
+	ScanSignature     string      `json:"-" bson:"scanSignature,omitempty"` // tên mẫu mã độc khi infected
+	ScannedAt         *time.Time  `json:"-" bson:"scannedAt,omitempty"`
+}
+
+// Blob là một object đã lưu trên storage, dùng chung cho mọi bản ghi File có cùng nội dung (SHA-256).
+// RefCount là số bản ghi File đang trỏ tới; về 0 thì object mới bị xoá.
+type Blob struct {
+	ID        string    `json:"id" bson:"_id"` // "<provider>:<sha256>"
+	SHA256    string    `json:"sha256" bson:"sha256"`
+	Provider  string    `json:"provider" bson:"provider"`
+	RefCount  int       `json:"refCount" bson:"refCount"`
+	Object    File      `json:"object" bson:"object"` // thông tin object (URL, key, MIME, kích thước, thumbnail...) để tạo bản ghi File mới
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// Quét lại khi scanner lỗi: file tạm giữ nội dung gốc, số lần lỗi và lần thử tiếp theo
+	ScanSpool    string     `json:"-" bson:"scanSpool,omitempty"`
+	ScanFailures int        `json:"-" bson:"scanFailures,omitempty"`
+	ScanRetryAt  *time.Time `json:"-" bson:"scanRetryAt,omitempty"`
+}
+
+// StorageUsage là tổng dung lượng file của một user, cập nhật khi upload thành công và khi file bị xoá/GC
+type StorageUsage struct {
+	UserID    primitive.ObjectID `json:"userId" bson:"_id"`
+	Used      int64              `json:"used" bson:"used"`
+	ByType    map[FileType]int64 `json:"byType" bson:"byType"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
 }
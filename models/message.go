@@ -7,6 +7,8 @@ import (
 
 type MessageType string
 type MessageStatus string
+type RecallKind string
+type SystemAction string
 
 const (
 	MessageTypeText     MessageType = "Text"
@@ -20,10 +22,25 @@ const (
 
 	MessageTypeFile MessageType = "File"
 
+	// Tin nhắn hệ thống (do server sinh ra, ví dụ khi đổi cài đặt kênh)
+	MessageTypeSystem MessageType = "System"
+	// Bình chọn (tạo qua API polls, không gửi qua WebSocket)
+	MessageTypePoll MessageType = "Poll"
+
 	MessageStatusSending  MessageStatus = "Đang gửi"
 	MessageStatusSent     MessageStatus = "Đã gửi"
 	MessageStatusReceived MessageStatus = "Đã nhận"
 	MessageStatusSeen     MessageStatus = "Đã xem"
+
+	RecallKindSelf      RecallKind = "self"      // người gửi tự thu hồi
+	RecallKindModerator RecallKind = "moderator" // Leader/Deputy gỡ cho mọi người
+
+	SystemActionMemberAdded       SystemAction = "member_added"
+	SystemActionMemberRemoved     SystemAction = "member_removed"
+	SystemActionMemberBlocked     SystemAction = "member_blocked"
+	SystemActionMemberLeft        SystemAction = "member_left"
+	SystemActionLeaderChanged     SystemAction = "leader_changed"
+	SystemActionMessageTTLChanged SystemAction = "message_ttl_changed"
 )
 
 type LastMessagePreview struct {
@@ -34,12 +51,14 @@ type LastMessagePreview struct {
 }
 
 type Attachment struct {
-	URL      string `bson:"url" json:"url"`
-	Mime     string `bson:"mime" json:"mime"`
-	Size     int64  `bson:"size,omitempty" json:"size,omitempty"`
-	Width    int32  `bson:"width,omitempty" json:"width,omitempty"`
-	Height   int32  `bson:"height,omitempty" json:"height,omitempty"`
-	Duration int32  `bson:"duration,omitempty" json:"duration,omitempty"` // audio/video (giây)
+	URL       string `bson:"url" json:"url"`
+	Mime      string `bson:"mime" json:"mime"`
+	Size      int64  `bson:"size,omitempty" json:"size,omitempty"`
+	Width     int32  `bson:"width,omitempty" json:"width,omitempty"`
+	Height    int32  `bson:"height,omitempty" json:"height,omitempty"`
+	Duration  int32  `bson:"duration,omitempty" json:"duration,omitempty"`   // audio/video (giây)
+	Waveform  []int  `bson:"waveform,omitempty" json:"waveform,omitempty"`   // tin nhắn thoại: dạng sóng 0-100
+	Thumbnail string `bson:"thumbnail,omitempty" json:"thumbnail,omitempty"` // ảnh: URL thumbnail nhỏ nhất cho timeline
 }
 
 type ReadReceipt struct {
@@ -57,6 +76,46 @@ type Reaction struct {
 	UserIDs []primitive.ObjectID `bson:"userIDs" json:"userIDs"`
 }
 
+// LinkPreview là metadata OpenGraph của link đầu tiên trong tin nhắn (server unfurl)
+type LinkPreview struct {
+	URL         string `bson:"url" json:"url"`
+	Title       string `bson:"title,omitempty" json:"title,omitempty"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	Image       string `bson:"image,omitempty" json:"image,omitempty"`
+	SiteName    string `bson:"siteName,omitempty" json:"siteName,omitempty"`
+}
+
+type PollOption struct {
+	ID     string               `bson:"id" json:"id"`
+	Text   string               `bson:"text" json:"text"`
+	Voters []primitive.ObjectID `bson:"voters" json:"-"` // không trả trực tiếp, xem PollView
+}
+
+// Poll là nội dung của tin nhắn bình chọn (MessageTypePoll)
+type Poll struct {
+	Question    string              `bson:"question" json:"question"`
+	Options     []PollOption        `bson:"options" json:"options"`
+	MultiChoice bool                `bson:"multiChoice" json:"multiChoice"`
+	Anonymous   bool                `bson:"anonymous" json:"anonymous"`
+	ClosesAt    *time.Time          `bson:"closesAt,omitempty" json:"closesAt,omitempty"`
+	Closed      bool                `bson:"closed" json:"closed"`
+	ClosedAt    *time.Time          `bson:"closedAt,omitempty" json:"closedAt,omitempty"`
+	ClosedBy    *primitive.ObjectID `bson:"closedBy,omitempty" json:"closedBy,omitempty"`
+}
+
+// IsClosed: đã đóng thủ công hoặc quá thời gian đóng
+func (p *Poll) IsClosed() bool {
+	return p.Closed || (p.ClosesAt != nil && !time.Now().Before(*p.ClosesAt))
+}
+
+// SystemEvent là payload có cấu trúc của tin nhắn hệ thống (MessageTypeSystem)
+type SystemEvent struct {
+	Action   SystemAction        `bson:"action" json:"action"`
+	ActorID  primitive.ObjectID  `bson:"actorId" json:"actorId"`
+	TargetID *primitive.ObjectID `bson:"targetId,omitempty" json:"targetId,omitempty"`
+	Value    int64               `bson:"value,omitempty" json:"value,omitempty"` // ví dụ: số giây TTL
+}
+
 type Message struct {
 	ID             primitive.ObjectID   `bson:"_id" json:"id"`
 	ChannelID      primitive.ObjectID   `bson:"channelID" json:"channelId"`
@@ -66,9 +125,13 @@ type Message struct {
 	SenderID       primitive.ObjectID   `bson:"senderId" json:"senderId"`
 	Status         MessageStatus        `bson:"status" json:"status"`
 	Recalled       bool                 `bson:"recalled" json:"recalled"`
+	RecalledBy     *primitive.ObjectID  `bson:"recalledBy,omitempty" json:"recalledBy,omitempty"`
+	RecallKind     RecallKind           `bson:"recallKind,omitempty" json:"recallKind,omitempty"`
+	RecalledAt     *time.Time           `bson:"recalledAt,omitempty" json:"recalledAt,omitempty"`
 	HiddenBy       []primitive.ObjectID `bson:"hiddenBy,omitempty" json:"-"`
 	URL            string               `json:"url" bson:"url"`
 	FileID         *primitive.ObjectID  `bson:"fileId" json:"fileId"`
+	StickerID      *primitive.ObjectID  `bson:"stickerId,omitempty" json:"stickerId,omitempty"`
 	ReplyTo        *primitive.ObjectID  `bson:"replyTo,omitempty" json:"replyTo,omitempty"`
 	ReplyToMessage *Message             `bson:"-" json:"replyToMessage,omitempty"`
 	Edited         bool                 `bson:"edited" json:"edited"`
@@ -78,4 +141,12 @@ type Message struct {
 	ReadBy         []ReadReceipt        `bson:"readBy,omitempty" json:"readBy,omitempty"`
 	DeliveredBy    []DeliveryReceipt    `bson:"deliveredBy,omitempty" json:"deliveredBy,omitempty"`
 	Attachments    []Attachment         `bson:"attachments,omitempty" json:"attachments,omitempty"`
+	ExpiresAt      *time.Time           `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"` // tin nhắn tự hủy
+	Withheld       bool                 `bson:"withheld,omitempty" json:"withheld,omitempty"`   // file đính kèm đang chờ quét: chỉ người gửi thấy
+	SystemEvent    *SystemEvent         `bson:"systemEvent,omitempty" json:"systemEvent,omitempty"`
+	Mentions       []primitive.ObjectID `bson:"mentions,omitempty" json:"mentions,omitempty"`
+	MentionAll     bool                 `bson:"mentionAll,omitempty" json:"mentionAll,omitempty"`
+	LinkPreview    *LinkPreview         `bson:"linkPreview,omitempty" json:"linkPreview,omitempty"`
+	Poll           *Poll                `bson:"poll,omitempty" json:"poll,omitempty"`
+	SearchText     string               `bson:"searchText,omitempty" json:"-"` // nội dung đã bỏ dấu, dùng cho text index
 }
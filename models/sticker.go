@@ -0,0 +1,42 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// StickerPack là bộ sticker; ChannelID nil = bộ dùng chung (admin quản lý), có ChannelID = bộ riêng của kênh (leader quản lý)
+type StickerPack struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Name      string              `json:"name" bson:"name"`
+	ChannelID *primitive.ObjectID `json:"channelId,omitempty" bson:"channelID,omitempty"`
+	Order     int                 `json:"order" bson:"order"` // thứ tự hiển thị, nhỏ trước
+	Stickers  []Sticker           `json:"stickers" bson:"stickers"`
+	CreatedBy primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// Sticker là một ảnh trong bộ, thứ tự theo vị trí trong mảng Stickers
+type Sticker struct {
+	ID     primitive.ObjectID `json:"id" bson:"id"`
+	FileID primitive.ObjectID `json:"fileId" bson:"fileID"`
+	URL    string             `json:"url" bson:"url"`
+	Emoji  string             `json:"emoji,omitempty" bson:"emoji,omitempty"` // emoji gợi ý, dùng để tìm sticker
+}
+
+// StickerLibrary là danh sách bộ sticker user đã thêm (theo thứ tự thêm)
+type StickerLibrary struct {
+	UserID  primitive.ObjectID   `json:"userId" bson:"_id"`
+	PackIDs []primitive.ObjectID `json:"packIds" bson:"packIDs"`
+}
+
+// CustomEmoji là emoji tuỳ chỉnh dùng bằng shortcode ":ten_emoji:" (reaction)
+type CustomEmoji struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Shortcode string              `json:"shortcode" bson:"shortcode"` // không kèm dấu ":"
+	ChannelID *primitive.ObjectID `json:"channelId,omitempty" bson:"channelID,omitempty"`
+	FileID    primitive.ObjectID  `json:"fileId" bson:"fileID"`
+	URL       string              `json:"url" bson:"url"`
+	CreatedBy primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+}
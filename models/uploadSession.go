@@ -0,0 +1,31 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type UploadStatus string
+
+const (
+	UploadStatusUploading  UploadStatus = "uploading"
+	UploadStatusAssembling UploadStatus = "assembling" // đang ghép chunk và upload lên storage
+	UploadStatusCompleted  UploadStatus = "completed"
+)
+
+// UploadSession là một lượt upload chia chunk (resumable); chunk lưu tạm trên đĩa của server tới khi complete
+type UploadSession struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID  `json:"userId" bson:"userId"`
+	FileName    string              `json:"fileName" bson:"fileName"`
+	Size        int64               `json:"size" bson:"size"`                     // tổng dung lượng (byte)
+	SHA256      string              `json:"sha256" bson:"sha256"`                 // checksum cả file (hex), kiểm tra khi complete
+	ChunkSize   int64               `json:"chunkSize" bson:"chunkSize"`           // mọi chunk đúng kích thước này, trừ chunk cuối
+	TotalChunks int                 `json:"totalChunks" bson:"totalChunks"`       // chunk đánh số từ 0
+	Received    []int               `json:"receivedChunks" bson:"receivedChunks"` // các chunk đã nhận và kiểm tra checksum
+	Status      UploadStatus        `json:"status" bson:"status"`
+	FileID      *primitive.ObjectID `json:"fileId,omitempty" bson:"fileId,omitempty"` // file đã tạo khi complete
+	CreatedAt   time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt" bson:"updatedAt"`
+	ExpiresAt   time.Time           `json:"expiresAt" bson:"expiresAt"` // gia hạn mỗi khi nhận chunk; quá hạn thì bị dọn
+}
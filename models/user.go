@@ -31,6 +31,7 @@ const (
 	RoleUser      Role = "Người dùng"
 	RoleTeamLead  Role = "Trưởng nhóm"
 	RoleSubLeader Role = "Phó nhóm"
+	RoleAdmin     Role = "Quản trị viên" // quản trị hệ thống
 
 	StatusOnline  Status = "Online"
 	StatusOffline Status = "Offline"
@@ -70,6 +71,7 @@ type User struct {
 	BlockType          BlockType          `json:"blockType" bson:"blockType"`
 	AccountCreatedDate time.Time          `json:"accountCreatedDate" bson:"accountCreatedDate"`
 	AdminLocked        bool               `json:"adminLocked" bson:"adminLocked"`
+	StorageQuota       *int64             `json:"storageQuota,omitempty" bson:"storageQuota,omitempty"` // byte; nil = theo USER_STORAGE_QUOTA, 0 = không giới hạn
 }
 
 var db *mongo.Database
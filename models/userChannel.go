@@ -11,4 +11,25 @@ type UserChannel struct {
 	ChannelID    primitive.ObjectID `json:"channelID" bson:"channelID"`
 	LastActive   time.Time          `json:"lastActive" bson:"lastActive"`
 	LastUnreadAt *time.Time         `json:"lastUnreadAt" bson:"lastUnreadAt,omitempty"`
+	MutedUntil   *time.Time         `json:"mutedUntil,omitempty" bson:"mutedUntil,omitempty"` // tắt thông báo tới thời điểm này
+	Archived     bool               `json:"archived" bson:"archived"`
+	Pinned       bool               `json:"pinned" bson:"pinned"`
+	PinnedAt     *time.Time         `json:"pinnedAt,omitempty" bson:"pinnedAt,omitempty"`
+	ClearedAt    *time.Time         `json:"clearedAt,omitempty" bson:"clearedAt,omitempty"` // "xoá hội thoại" phía user: ẩn tin nhắn trước mốc này
+	Draft        *Draft             `json:"draft,omitempty" bson:"draft,omitempty"`
+}
+
+// Draft là bản nháp tin nhắn của user trong kênh, đồng bộ giữa các thiết bị
+type Draft struct {
+	Content   string              `json:"content" bson:"content"`
+	ReplyTo   *primitive.ObjectID `json:"replyTo,omitempty" bson:"replyTo,omitempty"`
+	UpdatedAt time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// MutedForever là mốc mutedUntil khi tắt thông báo vô thời hạn
+var MutedForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// IsMuted: kênh đang bị tắt thông báo
+func (uc *UserChannel) IsMuted() bool {
+	return uc.MutedUntil != nil && uc.MutedUntil.After(time.Now())
 }
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"chat-app-backend/controllers"
+	"chat-app-backend/middleware"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+func SetupBookmarkRoutes(router *gin.Engine) {
+	bookmarkService := services.NewBookmarkService()
+	bookmarkController := controllers.NewBookmarkController(bookmarkService)
+
+	bookmarkRoutes := router.Group("/api/users/me/bookmarks", middleware.AuthMiddleware())
+	{
+		bookmarkRoutes.GET("", bookmarkController.GetBookmarksHandler)
+		bookmarkRoutes.PUT("/:messageID", bookmarkController.AddBookmarkHandler)
+		bookmarkRoutes.DELETE("/:messageID", bookmarkController.RemoveBookmarkHandler)
+	}
+}
@@ -16,6 +16,10 @@ func SetupChannelRoutes(router *gin.Engine, channelController *controllers.Chann
 		channelRoutes.GET("/:channelID/members", channelController.ListMembersHandler)
 		channelRoutes.GET("/:channelID/blocked-members", channelController.ListBlockedMembersHandler)
 		channelRoutes.PUT("/:channelID/approval", channelController.ToggleApprovalHandler)
+		channelRoutes.PUT("/:channelID/message-ttl", channelController.SetMessageTTLHandler)             // Tin nhắn tự hủy
+		channelRoutes.PUT("/:channelID/message-windows", channelController.SetMessageWindowsHandler)     // Cửa sổ thu hồi / chỉnh sửa
+		channelRoutes.PUT("/:channelID/reaction-mode", channelController.SetReactionModeHandler)         // Mỗi người một reaction
+		channelRoutes.PUT("/:channelID/draft", channelController.SaveDraftHandler)                       // Bản nháp
 		channelRoutes.POST("/:channelID/leave/:memberID", channelController.LeaveChannelHandler)         // Thành viên rời khỏi kênh
 		channelRoutes.DELETE("/:channelID/dissolve/:leaderID", channelController.DissolveChannelHandler) // Giải tán kênh
 		channelRoutes.POST("/:channelID/block/:memberID", channelController.BlockMemberHandler)          // Chặn thành viên
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"chat-app-backend/controllers"
+	"chat-app-backend/middleware"
 	"chat-app-backend/services"
 	"github.com/gin-gonic/gin"
 )
@@ -9,12 +10,18 @@ import (
 func SetupChatHistoryRoutes(router *gin.Engine) {
 	// Tạo service và controller
 	chatHistoryService := services.NewChatHistoryService()
-	chatHistoryController := controllers.NewChatHistoryController(chatHistoryService)
+	chatHistoryController := controllers.NewChatHistoryController(chatHistoryService, services.NewUserChannelService())
 
 	chatHistory := router.Group("/api/chatHistory")
 	{
 		chatHistory.GET("/:channelID/:userID", chatHistoryController.GetChatHistory)
 		chatHistory.GET("/user/:userID", chatHistoryController.GetChatHistoryByUserID)
-		chatHistory.DELETE("/:channelID", chatHistoryController.DeleteChatHistory)
+		chatHistory.DELETE("/:channelID", middleware.AuthMiddleware(), chatHistoryController.ClearChatHistoryForMe) // Xoá hội thoại phía mình
+	}
+
+	// Xoá hẳn chathistory của kênh cho mọi người: chỉ admin
+	admin := router.Group("/api/admin", middleware.AuthMiddleware(), middleware.AdminMiddleware())
+	{
+		admin.DELETE("/chatHistory/:channelID", chatHistoryController.DeleteChatHistory)
 	}
 }
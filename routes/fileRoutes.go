@@ -2,7 +2,9 @@ package routes
 
 import (
 	"chat-app-backend/controllers"
+	"chat-app-backend/middleware"
 	"chat-app-backend/services"
+	"chat-app-backend/storage"
 	"log"
 
 	"github.com/gin-gonic/gin"
@@ -14,8 +16,35 @@ func SetupFileRoutes(r *gin.Engine) {
 		// nếu provider không khởi được, log và panic/exit để dev biết
 		log.Fatalf("Không thể khởi FileService: %v", err)
 	}
-	fc := controllers.NewFileController(fs)
+	fc := controllers.NewFileController(fs, services.NewFileAccessService())
 
 	// Upload
-	r.POST("/uploads", fc.Upload)
+	r.POST("/uploads", middleware.AuthMiddleware(), fc.Upload)
+
+	// Download có kiểm tra quyền: Bearer token hoặc URL đã ký (dùng trong <img>/<audio>)
+	files := r.Group("/api/files")
+	{
+		files.GET("/:fileID/download", middleware.OptionalAuthMiddleware(), fc.Download)
+		files.GET("/:fileID/signed-url", middleware.AuthMiddleware(), fc.SignedURL)
+		files.POST("/signed-urls", middleware.AuthMiddleware(), fc.SignedURLs)
+	}
+
+	// Upload chia chunk (resumable) cho file lớn
+	uc := controllers.NewUploadSessionController(services.NewUploadSessionService(fs))
+	uploads := r.Group("/api/uploads", middleware.AuthMiddleware())
+	{
+		uploads.POST("", uc.InitiateHandler)
+		uploads.GET("/:uploadID", uc.GetHandler)
+		uploads.PUT("/:uploadID/chunks/:index", uc.PutChunkHandler)
+		uploads.POST("/:uploadID/complete", uc.CompleteHandler)
+		uploads.DELETE("/:uploadID", uc.AbortHandler)
+	}
+
+	// URL cũ lưu trong DB: local trỏ về /uploads/<tên file>, bucket private trỏ về /files/<key>
+	if _, ok := fs.Provider.(storage.Opener); ok {
+		r.GET("/uploads/:name", middleware.OptionalAuthMiddleware(), fc.ServeByKey)
+	}
+	if _, ok := fs.Provider.(storage.Presigner); ok {
+		r.GET("/files/*key", middleware.OptionalAuthMiddleware(), fc.ServeByKey)
+	}
 }
@@ -10,6 +10,7 @@ func SetupRouter(
 	router *gin.Engine,
 	messageController *controllers.MessageController,
 	channelController *controllers.ChannelController,
+	pollController *controllers.PollController,
 ) {
 
 	// Cấu hình routes cho người dùng
@@ -21,6 +22,12 @@ func SetupRouter(
 	// Cấu hình routes cho Channel
 	SetupChannelRoutes(router, channelController)
 
+	// Cấu hình routes cho cài đặt hội thoại của user
+	SetupUserChannelRoutes(router)
+
+	// Cấu hình routes cho bình chọn
+	SetupPollRoutes(router, pollController)
+
 	// Kiểm tra kết nối client - server
 	SetupPingRoute(router)
 
@@ -31,4 +38,19 @@ func SetupRouter(
 
 	// Cấu hình routes cho Friend
 	SetupFriendRoutes(router)
+
+	// Cấu hình routes cho tin nhắn đã lưu
+	SetupBookmarkRoutes(router)
+
+	// Cấu hình routes cho sticker và emoji tuỳ chỉnh
+	SetupStickerRoutes(router)
+
+	// Cấu hình routes cho tìm kiếm
+	SetupSearchRoutes(router)
+
+	// Cấu hình routes cho dung lượng lưu trữ và quota
+	SetupStorageRoutes(router)
+
+	// Cấu hình routes cho thư viện media của kênh
+	SetupMediaRoutes(router)
 }
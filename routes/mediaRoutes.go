@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"chat-app-backend/controllers"
+	"chat-app-backend/middleware"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+func SetupMediaRoutes(router *gin.Engine) {
+	mediaService := services.NewMediaService()
+	mediaController := controllers.NewMediaController(mediaService)
+
+	// Ảnh, video, file và link đã gửi trong kênh
+	router.GET("/api/channels/:channelID/media", middleware.AuthMiddleware(), mediaController.ListChannelMediaHandler)
+}
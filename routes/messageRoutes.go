@@ -16,4 +16,6 @@ func SetupMessageRoutes(router *gin.Engine, messageController *controllers.Messa
 	protected.DELETE("/messages/:messageID/hide", middleware.AuthMiddleware(), messageController.HideMessageHandler)
 	protected.PUT("/messages/:messageID/", messageController.EditMessage)
 	protected.POST("messages/:messageID/reaction", messageController.ToggleReaction)
+	protected.GET("/messages/:messageID/reactions", messageController.GetReactionUsersHandler)
+	protected.GET("/users/me/mentions", messageController.GetMyMentionsHandler)
 }
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"chat-app-backend/controllers"
+	"chat-app-backend/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func SetupPollRoutes(router *gin.Engine, pollController *controllers.PollController) {
+	protected := router.Group("/api", middleware.AuthMiddleware())
+	{
+		protected.POST("/channels/:channelID/polls", pollController.CreatePollHandler)
+		protected.POST("/messages/:messageID/poll/vote", pollController.VoteHandler)
+		protected.DELETE("/messages/:messageID/poll/vote", pollController.RetractVoteHandler) // ?optionId= để rút 1 lựa chọn
+		protected.POST("/messages/:messageID/poll/close", pollController.ClosePollHandler)
+	}
+}
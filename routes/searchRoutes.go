@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"chat-app-backend/controllers"
+	"chat-app-backend/middleware"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+func SetupSearchRoutes(router *gin.Engine) {
+	searchService := services.NewSearchService()
+	searchController := controllers.NewSearchController(searchService)
+
+	searchRoutes := router.Group("/api/search", middleware.AuthMiddleware())
+	{
+		searchRoutes.GET("/messages", searchController.SearchMessagesHandler)
+	}
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"chat-app-backend/controllers"
+	"chat-app-backend/middleware"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+func SetupStickerRoutes(router *gin.Engine) {
+	stickerService := services.NewStickerService()
+	stickerController := controllers.NewStickerController(stickerService)
+
+	// Bộ sticker: bộ dùng chung do admin quản lý, bộ của kênh do leader kênh quản lý (kiểm tra trong service)
+	packRoutes := router.Group("/api/stickers/packs", middleware.AuthMiddleware())
+	{
+		packRoutes.GET("", stickerController.ListPacksHandler)
+		packRoutes.POST("", stickerController.CreatePackHandler)
+		packRoutes.PUT("/:packID", stickerController.UpdatePackHandler)
+		packRoutes.DELETE("/:packID", stickerController.DeletePackHandler)
+		packRoutes.POST("/:packID/stickers", stickerController.AddStickerHandler)
+		packRoutes.DELETE("/:packID/stickers/:stickerID", stickerController.RemoveStickerHandler)
+	}
+
+	// Thư viện sticker của user
+	libraryRoutes := router.Group("/api/users/me/sticker-packs", middleware.AuthMiddleware())
+	{
+		libraryRoutes.GET("", stickerController.GetLibraryHandler)
+		libraryRoutes.PUT("/:packID", stickerController.AddToLibraryHandler)
+		libraryRoutes.DELETE("/:packID", stickerController.RemoveFromLibraryHandler)
+	}
+
+	// Emoji tuỳ chỉnh (dùng trong reaction bằng ":shortcode:")
+	emojiRoutes := router.Group("/api/emojis", middleware.AuthMiddleware())
+	{
+		emojiRoutes.GET("", stickerController.ListEmojisHandler)
+		emojiRoutes.POST("", stickerController.CreateEmojiHandler)
+		emojiRoutes.DELETE("/:emojiID", stickerController.DeleteEmojiHandler)
+	}
+}
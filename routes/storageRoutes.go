@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"chat-app-backend/controllers"
+	"chat-app-backend/middleware"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+func SetupStorageRoutes(router *gin.Engine) {
+	storageController := controllers.NewStorageController(services.NewStorageQuotaService())
+
+	// Dung lượng đã dùng / quota của user
+	router.GET("/api/users/me/storage", middleware.AuthMiddleware(), storageController.GetMyStorageHandler)
+
+	// Quota riêng cho user/kênh: chỉ admin
+	admin := router.Group("/api/admin", middleware.AuthMiddleware(), middleware.AdminMiddleware())
+	{
+		admin.PUT("/users/:userID/storage-quota", storageController.SetUserQuotaHandler)
+		admin.PUT("/channels/:channelID/storage-quota", storageController.SetChannelQuotaHandler)
+	}
+}
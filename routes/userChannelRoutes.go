@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"chat-app-backend/controllers"
+	"chat-app-backend/middleware"
+	"chat-app-backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// SetupUserChannelRoutes: cài đặt hội thoại riêng của user hiện tại
+func SetupUserChannelRoutes(router *gin.Engine) {
+	userChannelService := services.NewUserChannelService()
+	userChannelController := controllers.NewUserChannelController(userChannelService)
+
+	settings := router.Group("/api/channels", middleware.AuthMiddleware())
+	{
+		settings.PUT("/:channelID/mute", userChannelController.MuteHandler)       // Tắt thông báo
+		settings.PUT("/:channelID/archive", userChannelController.ArchiveHandler) // Lưu trữ
+		settings.PUT("/:channelID/pin", userChannelController.PinHandler)         // Ghim lên đầu
+	}
+}
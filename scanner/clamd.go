@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultClamdTimeout   = 2 * time.Minute
+	defaultClamdChunkSize = 64 << 10
+	// DefaultClamdMaxSize bằng StreamMaxLength mặc định của clamd (25M); clamd cấu hình khác thì đặt CLAMD_MAX_SIZE cho khớp
+	DefaultClamdMaxSize = 25 << 20
+)
+
+// ClamdScanner quét qua giao thức clamd (lệnh INSTREAM) trên TCP hoặc unix socket.
+// Mỗi lần quét mở một kết nối mới nên dùng được từ nhiều goroutine.
+type ClamdScanner struct {
+	Network   string // "tcp" hoặc "unix"
+	Address   string
+	Timeout   time.Duration // cho cả lần quét (gửi dữ liệu và chờ kết quả)
+	ChunkSize int
+	MaxSize   int64 // StreamMaxLength của clamd (byte); 0 = không kiểm tra trước
+}
+
+// NewClamdScanner nhận "host:port" hoặc "unix:/path/to/clamd.sock"
+func NewClamdScanner(address string) *ClamdScanner {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", path
+	}
+	return &ClamdScanner{
+		Network:   network,
+		Address:   address,
+		Timeout:   defaultClamdTimeout,
+		ChunkSize: defaultClamdChunkSize,
+		MaxSize:   DefaultClamdMaxSize,
+	}
+}
+
+func (c *ClamdScanner) Name() string {
+	return "clamd"
+}
+
+func (c *ClamdScanner) MaxScanSize() int64 {
+	return c.MaxSize
+}
+
+func (c *ClamdScanner) dial(ctx context.Context) (net.Conn, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("clamd: %w", err)
+	}
+	deadline := time.Time{}
+	if c.Timeout > 0 {
+		deadline = time.Now().Add(c.Timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	if !deadline.IsZero() {
+		_ = conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// Ping kiểm tra clamd còn sống (lệnh PING → PONG)
+func (c *ClamdScanner) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd: unexpected reply %q", reply)
+	}
+	return nil
+}
+
+// Scan gửi dữ liệu theo INSTREAM: "zINSTREAM\0", các chunk <độ dài 4 byte big-endian><dữ liệu>, kết thúc bằng chunk độ dài 0.
+// clamd trả "stream: OK", "stream: <tên mẫu> FOUND" hoặc "<thông báo> ERROR".
+func (c *ClamdScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := c.stream(conn, r); err != nil {
+		// clamd đóng kết nối giữa chừng khi vượt StreamMaxLength: vẫn đọc thông báo lỗi nếu có
+		if reply, replyErr := readReply(conn); replyErr == nil && reply != "" {
+			return parseReply(reply)
+		}
+		return nil, err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseReply(reply)
+}
+
+func (c *ClamdScanner) stream(conn net.Conn, r io.Reader) error {
+	w := bufio.NewWriter(conn)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultClamdChunkSize
+	}
+	buf := make([]byte, chunkSize)
+	var size [4]byte
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, err := w.Write(size[:]); err != nil {
+				return fmt.Errorf("clamd: %w", err)
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return fmt.Errorf("clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := w.Write(size[:]); err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	return nil
+}
+
+// readReply đọc một câu trả lời (lệnh dạng "z..." kết thúc bằng \0)
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("clamd: read reply: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+func parseReply(reply string) (*Result, error) {
+	body := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case body == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(body, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(body, " FOUND")}, nil
+	case strings.Contains(body, "size limit exceeded"):
+		// "INSTREAM size limit exceeded. ERROR": vượt StreamMaxLength, gửi lại cũng vậy
+		return nil, fmt.Errorf("clamd: %s: %w", strings.TrimSuffix(body, " ERROR"), ErrTooLarge)
+	case strings.HasSuffix(body, " ERROR"):
+		return nil, fmt.Errorf("clamd: %s", strings.TrimSuffix(body, " ERROR"))
+	}
+	return nil, fmt.Errorf("clamd: unexpected reply %q", reply)
+}
@@ -0,0 +1,180 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eicar là chuỗi test chuẩn mà mọi antivirus nhận là mã độc
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// startClamdStub chạy server giả lập clamd: đọc lệnh INSTREAM và các chunk, gọi reply với dữ liệu nhận được.
+// maxLength > 0 thì trả lỗi khi vượt giới hạn như StreamMaxLength của clamd.
+func startClamdStub(t *testing.T, maxLength int, reply func(data []byte) string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamdStub(conn, maxLength, reply)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveClamdStub(conn net.Conn, maxLength int, reply func(data []byte) string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch cmd {
+	case "zPING\x00":
+		_, _ = conn.Write([]byte("PONG\x00"))
+		return
+	case "zINSTREAM\x00":
+	default:
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var data bytes.Buffer
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n == 0 {
+			break
+		}
+		if _, err := io.CopyN(&data, r, int64(n)); err != nil {
+			return
+		}
+		if maxLength > 0 && data.Len() > maxLength {
+			_, _ = conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+	}
+	_, _ = conn.Write([]byte(reply(data.Bytes()) + "\x00"))
+}
+
+func eicarReply(data []byte) string {
+	if bytes.Contains(data, []byte(eicar)) {
+		return "stream: Win.Test.EICAR_HDB-1 FOUND"
+	}
+	return "stream: OK"
+}
+
+func TestClamdScanner(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength int
+		data      string
+		infected  bool
+		signature string
+		wantErr   string
+	}{
+		{name: "clean", data: "hello world", infected: false},
+		{name: "found", data: "prefix " + eicar, infected: true, signature: "Win.Test.EICAR_HDB-1"},
+		{name: "size limit error", maxLength: 8, data: strings.Repeat("a", 100), wantErr: "size limit exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClamdScanner(startClamdStub(t, tt.maxLength, eicarReply))
+			c.Timeout = 5 * time.Second
+			c.ChunkSize = 4 // nhiều chunk nhỏ để kiểm tra cách chia INSTREAM
+
+			result, err := c.Scan(context.Background(), strings.NewReader(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				if tt.maxLength > 0 && !errors.Is(err, ErrTooLarge) {
+					t.Fatalf("err = %v, want ErrTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if result.Infected != tt.infected || result.Signature != tt.signature {
+				t.Fatalf("result = %+v, want infected=%v signature=%q", result, tt.infected, tt.signature)
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnexpectedReply(t *testing.T) {
+	c := NewClamdScanner(startClamdStub(t, 0, func([]byte) string { return "garbage" }))
+	c.Timeout = 5 * time.Second
+	if _, err := c.Scan(context.Background(), strings.NewReader("x")); err == nil {
+		t.Fatal("expected error for unexpected reply")
+	}
+}
+
+func TestClamdScannerUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c := NewClamdScanner(addr)
+	c.Timeout = time.Second
+	if _, err := c.Scan(context.Background(), strings.NewReader("x")); err == nil {
+		t.Fatal("expected error when clamd is unreachable")
+	}
+}
+
+func TestClamdPing(t *testing.T) {
+	c := NewClamdScanner(startClamdStub(t, 0, eicarReply))
+	c.Timeout = 5 * time.Second
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply    string
+		infected bool
+		wantErr  bool
+	}{
+		{"stream: OK", false, false},
+		{"stream: Eicar-Signature FOUND", true, false},
+		{"Can't allocate memory ERROR", false, true},
+		{"INSTREAM size limit exceeded. ERROR", false, true},
+		{"", false, true},
+	}
+	for _, tt := range tests {
+		result, err := parseReply(tt.reply)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseReply(%q) err = %v, wantErr %v", tt.reply, err, tt.wantErr)
+		}
+		if tooLarge := strings.Contains(tt.reply, "size limit"); tooLarge != errors.Is(err, ErrTooLarge) {
+			t.Fatalf("parseReply(%q) err = %v, ErrTooLarge expected: %v", tt.reply, err, tooLarge)
+		}
+		if err == nil && result.Infected != tt.infected {
+			t.Fatalf("parseReply(%q) infected = %v, want %v", tt.reply, result.Infected, tt.infected)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrTooLarge: file vượt giới hạn kích thước của scanner (StreamMaxLength của clamd); quét lại cũng không được
+var ErrTooLarge = errors.New("file exceeds the scanner's size limit")
+
+// Result là kết quả quét một file
+type Result struct {
+	Infected  bool
+	Signature string // tên mẫu mã độc khi Infected
+}
+
+// Scanner là interface chung cho bộ quét mã độc/nội dung (clamd, dịch vụ ngoài...)
+type Scanner interface {
+	// Name là tên scanner, dùng khi ghi log
+	Name() string
+	// Scan đọc hết r và trả kết quả; lỗi nghĩa là chưa quét được (file vẫn ở trạng thái chờ)
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
+
+// SizeLimiter là scanner biết trước kích thước tối đa quét được, để từ chối file lớn hơn ngay khi upload
+type SizeLimiter interface {
+	// MaxScanSize trả số byte tối đa; 0 = không giới hạn
+	MaxScanSize() int64
+}
+
+// NewScannerFromEnv tạo scanner theo SCANNER ("clamd"); không cấu hình thì trả nil (không quét)
+func NewScannerFromEnv() (Scanner, error) {
+	switch kind := os.Getenv("SCANNER"); kind {
+	case "", "none":
+		return nil, nil
+	case "clamd":
+		address := os.Getenv("CLAMD_ADDRESS") // "host:port" hoặc "unix:/path/to/clamd.sock"
+		if address == "" {
+			address = "localhost:3310"
+		}
+		clamd := NewClamdScanner(address)
+		if raw := os.Getenv("CLAMD_TIMEOUT"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("CLAMD_TIMEOUT không hợp lệ: %q", raw)
+			}
+			clamd.Timeout = d
+		}
+		if raw := os.Getenv("CLAMD_MAX_SIZE"); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("CLAMD_MAX_SIZE không hợp lệ: %q", raw)
+			}
+			clamd.MaxSize = n
+		}
+		return clamd, nil
+	default:
+		return nil, fmt.Errorf("SCANNER không hỗ trợ: %q", kind)
+	}
+}
@@ -0,0 +1,19 @@
+package search
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+)
+
+func NewIndexFromEnv(db *mongo.Database) (SearchIndex, error) {
+	backend := os.Getenv("SEARCH_BACKEND") // "mongo" hoặc "memory"
+	switch backend {
+	case "", "mongo":
+		return NewMongoIndex(db), nil
+	case "memory":
+		return NewMemoryIndex(), nil
+	default:
+		return nil, fmt.Errorf("unknown SEARCH_BACKEND %q", backend)
+	}
+}
@@ -0,0 +1,54 @@
+package search
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Document là dữ liệu của một tin nhắn cần đánh index
+type Document struct {
+	MessageID   primitive.ObjectID
+	ChannelID   primitive.ObjectID
+	SenderID    primitive.ObjectID
+	MessageType string
+	Text        string // nội dung gốc, index tự fold (bỏ dấu, chữ thường)
+	Timestamp   time.Time
+	ExpiresAt   *time.Time
+	HiddenBy    []primitive.ObjectID
+}
+
+// Query là điều kiện tìm kiếm; Terms đã được fold, kết quả phải chứa đủ tất cả các từ
+type Query struct {
+	Terms      []string
+	ChannelIDs []primitive.ObjectID
+	ViewerID   primitive.ObjectID // bỏ tin nhắn viewer đã ẩn
+	SenderID   *primitive.ObjectID
+	Type       string
+	Before     *time.Time
+	After      *time.Time
+	ClearedAt  map[primitive.ObjectID]time.Time // mốc "xoá hội thoại" của viewer theo kênh: chỉ lấy tin sau mốc
+	Offset     int
+	Limit      int
+}
+
+// Hits là id tin nhắn khớp theo thứ tự xếp hạng, Total là tổng số kết quả (trước phân trang)
+type Hits struct {
+	IDs   []primitive.ObjectID
+	Total int64
+}
+
+// SearchIndex là interface chung cho backend tìm kiếm (Mongo hoặc index trong bộ nhớ)
+type SearchIndex interface {
+	// IndexMessage thêm hoặc cập nhật tin nhắn (gửi mới, chỉnh sửa)
+	IndexMessage(doc Document) error
+	// DeleteMessage gỡ tin nhắn khỏi index (thu hồi, hết hạn)
+	DeleteMessage(messageID primitive.ObjectID) error
+	// HideMessage ẩn tin nhắn khỏi kết quả của một user
+	HideMessage(messageID, userID primitive.ObjectID) error
+	// DeleteChannel gỡ toàn bộ tin nhắn của kênh (dùng trước khi reindex kênh)
+	DeleteChannel(channelID primitive.ObjectID) error
+	// Query trả id tin nhắn khớp
+	Query(q Query) (*Hits, error)
+	// Persistent = index lưu bền (không cần dựng lại khi khởi động)
+	Persistent() bool
+}
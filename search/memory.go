@@ -0,0 +1,183 @@
+package search
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryIndex là inverted index trong bộ nhớ, dùng cho test và triển khai nhỏ.
+// Không lưu bền: cần dựng lại (reindex) mỗi lần khởi động.
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[primitive.ObjectID]*memoryDoc
+	postings map[string]map[primitive.ObjectID]struct{} // từ → tập id tin nhắn
+}
+
+type memoryDoc struct {
+	Document
+	tokens []string
+	hidden map[primitive.ObjectID]struct{}
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     make(map[primitive.ObjectID]*memoryDoc),
+		postings: make(map[string]map[primitive.ObjectID]struct{}),
+	}
+}
+
+func (mi *MemoryIndex) IndexMessage(doc Document) error {
+	tokens := uniqueTokens(Tokenize(doc.Text))
+
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	mi.removeLocked(doc.MessageID)
+	if len(tokens) == 0 {
+		return nil
+	}
+	md := &memoryDoc{Document: doc, tokens: tokens, hidden: make(map[primitive.ObjectID]struct{})}
+	for _, uid := range doc.HiddenBy {
+		md.hidden[uid] = struct{}{}
+	}
+	mi.docs[doc.MessageID] = md
+	for _, t := range tokens {
+		if mi.postings[t] == nil {
+			mi.postings[t] = make(map[primitive.ObjectID]struct{})
+		}
+		mi.postings[t][doc.MessageID] = struct{}{}
+	}
+	return nil
+}
+
+func (mi *MemoryIndex) DeleteMessage(messageID primitive.ObjectID) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	mi.removeLocked(messageID)
+	return nil
+}
+
+func (mi *MemoryIndex) HideMessage(messageID, userID primitive.ObjectID) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	if md, ok := mi.docs[messageID]; ok {
+		md.hidden[userID] = struct{}{}
+	}
+	return nil
+}
+
+func (mi *MemoryIndex) DeleteChannel(channelID primitive.ObjectID) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	for id, md := range mi.docs {
+		if md.ChannelID == channelID {
+			mi.removeLocked(id)
+		}
+	}
+	return nil
+}
+
+// Query: mỗi từ khớp theo tiền tố (giống gõ dở "Hà N"), kết quả phải chứa đủ mọi từ; mới nhất trước
+func (mi *MemoryIndex) Query(q Query) (*Hits, error) {
+	mi.mu.RLock()
+	defer mi.mu.RUnlock()
+
+	var candidates map[primitive.ObjectID]struct{}
+	for _, term := range q.Terms {
+		matched := make(map[primitive.ObjectID]struct{})
+		for token, ids := range mi.postings {
+			if !strings.HasPrefix(token, term) {
+				continue
+			}
+			for id := range ids {
+				if candidates == nil {
+					matched[id] = struct{}{}
+				} else if _, ok := candidates[id]; ok {
+					matched[id] = struct{}{}
+				}
+			}
+		}
+		candidates = matched
+		if len(candidates) == 0 {
+			break
+		}
+	}
+
+	channels := make(map[primitive.ObjectID]struct{}, len(q.ChannelIDs))
+	for _, id := range q.ChannelIDs {
+		channels[id] = struct{}{}
+	}
+	now := time.Now()
+
+	var docs []*memoryDoc
+	for id := range candidates {
+		md := mi.docs[id]
+		if _, ok := channels[md.ChannelID]; !ok {
+			continue
+		}
+		if _, hidden := md.hidden[q.ViewerID]; hidden {
+			continue
+		}
+		if md.ExpiresAt != nil && !md.ExpiresAt.After(now) {
+			continue
+		}
+		if q.SenderID != nil && md.SenderID != *q.SenderID {
+			continue
+		}
+		if q.Type != "" && md.MessageType != q.Type {
+			continue
+		}
+		if q.Before != nil && !md.Timestamp.Before(*q.Before) {
+			continue
+		}
+		if q.After != nil && !md.Timestamp.After(*q.After) {
+			continue
+		}
+		if t, ok := q.ClearedAt[md.ChannelID]; ok && !md.Timestamp.After(t) {
+			continue
+		}
+		docs = append(docs, md)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Timestamp.After(docs[j].Timestamp) })
+
+	hits := &Hits{Total: int64(len(docs)), IDs: []primitive.ObjectID{}}
+	if q.Offset < len(docs) {
+		for _, md := range docs[q.Offset:min(q.Offset+q.Limit, len(docs))] {
+			hits.IDs = append(hits.IDs, md.MessageID)
+		}
+	}
+	return hits, nil
+}
+
+func (mi *MemoryIndex) Persistent() bool {
+	return false
+}
+
+func (mi *MemoryIndex) removeLocked(messageID primitive.ObjectID) {
+	md, ok := mi.docs[messageID]
+	if !ok {
+		return
+	}
+	for _, t := range md.tokens {
+		delete(mi.postings[t], messageID)
+		if len(mi.postings[t]) == 0 {
+			delete(mi.postings, t)
+		}
+	}
+	delete(mi.docs, messageID)
+}
+
+func uniqueTokens(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	out := tokens[:0]
+	for _, t := range tokens {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,40 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryIndexClearedAt(t *testing.T) {
+	idx := NewMemoryIndex()
+	chA, chB := primitive.NewObjectID(), primitive.NewObjectID()
+	base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	docs := []Document{
+		{MessageID: primitive.NewObjectID(), ChannelID: chA, Text: "hẹn gặp lúc 9h", Timestamp: base.Add(-time.Hour)},
+		{MessageID: primitive.NewObjectID(), ChannelID: chA, Text: "hẹn gặp lúc 10h", Timestamp: base},
+		{MessageID: primitive.NewObjectID(), ChannelID: chA, Text: "hẹn gặp lúc 11h", Timestamp: base.Add(time.Hour)},
+		{MessageID: primitive.NewObjectID(), ChannelID: chB, Text: "hẹn gặp ở quán", Timestamp: base.Add(-time.Hour)},
+	}
+	for _, d := range docs {
+		if err := idx.IndexMessage(d); err != nil {
+			t.Fatalf("IndexMessage: %v", err)
+		}
+	}
+
+	hits, err := idx.Query(Query{
+		Terms:      Tokenize("hen gap"),
+		ChannelIDs: []primitive.ObjectID{chA, chB},
+		ClearedAt:  map[primitive.ObjectID]time.Time{chA: base},
+		Limit:      10,
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	// kênh A chỉ còn tin sau mốc (không gồm tin đúng mốc), kênh B không bị ảnh hưởng
+	if hits.Total != 2 || len(hits.IDs) != 2 || hits.IDs[0] != docs[2].MessageID || hits.IDs[1] != docs[3].MessageID {
+		t.Fatalf("hits = %+v", hits)
+	}
+}
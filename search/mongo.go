@@ -0,0 +1,128 @@
+package search
+
+import (
+	"chat-app-backend/utils"
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// MongoIndex dùng text index "searchText_text" trên chính collection messages.
+// Trường searchText là nội dung đã bỏ dấu (text index của Mongo không gộp được "đ"/"d").
+type MongoIndex struct {
+	coll *mongo.Collection
+}
+
+func NewMongoIndex(db *mongo.Database) *MongoIndex {
+	return &MongoIndex{coll: db.Collection("messages")}
+}
+
+func (mi *MongoIndex) IndexMessage(doc Document) error {
+	text := utils.FoldText(doc.Text)
+	if text == "" {
+		return mi.DeleteMessage(doc.MessageID)
+	}
+	_, err := mi.coll.UpdateOne(context.Background(),
+		bson.M{"_id": doc.MessageID},
+		bson.M{"$set": bson.M{"searchText": text}},
+	)
+	return err
+}
+
+// DeleteMessage ghi searchText rỗng (không unset) để đánh dấu tin nhắn đã xử lý, Warmup không lấy lại mỗi lần khởi động
+func (mi *MongoIndex) DeleteMessage(messageID primitive.ObjectID) error {
+	_, err := mi.coll.UpdateOne(context.Background(),
+		bson.M{"_id": messageID},
+		bson.M{"$set": bson.M{"searchText": ""}},
+	)
+	return err
+}
+
+// HideMessage: hiddenBy đã nằm trong document tin nhắn, Query lọc trực tiếp
+func (mi *MongoIndex) HideMessage(messageID, userID primitive.ObjectID) error {
+	return nil
+}
+
+func (mi *MongoIndex) DeleteChannel(channelID primitive.ObjectID) error {
+	_, err := mi.coll.UpdateMany(context.Background(),
+		bson.M{"channelID": channelID},
+		bson.M{"$unset": bson.M{"searchText": ""}},
+	)
+	return err
+}
+
+func (mi *MongoIndex) Query(q Query) (*Hits, error) {
+	ctx := context.Background()
+
+	// đặt từng từ trong ngoặc kép để Mongo yêu cầu đủ tất cả các từ (mặc định là OR)
+	quoted := make([]string, len(q.Terms))
+	for i, t := range q.Terms {
+		quoted[i] = `"` + t + `"`
+	}
+	filter := bson.M{
+		"$text":     bson.M{"$search": strings.Join(quoted, " "), "$diacriticSensitive": false},
+		"channelID": bson.M{"$in": q.ChannelIDs},
+		"recalled":  bson.M{"$ne": true},
+		"hiddenBy":  bson.M{"$ne": q.ViewerID},
+		"$nor": []bson.M{
+			{"expiresAt": bson.M{"$lte": time.Now()}},
+			// tin nhắn đang giữ chờ quét file chỉ người gửi thấy
+			{"withheld": true, "senderId": bson.M{"$ne": q.ViewerID}},
+		},
+	}
+	for channelID, t := range q.ClearedAt {
+		filter["$nor"] = append(filter["$nor"].([]bson.M), bson.M{"channelID": channelID, "timestamp": bson.M{"$lte": t}})
+	}
+	if q.SenderID != nil {
+		filter["senderId"] = *q.SenderID
+	}
+	if q.Type != "" {
+		filter["messageType"] = q.Type
+	}
+	ts := bson.M{}
+	if q.Before != nil {
+		ts["$lt"] = *q.Before
+	}
+	if q.After != nil {
+		ts["$gt"] = *q.After
+	}
+	if len(ts) > 0 {
+		filter["timestamp"] = ts
+	}
+
+	total, err := mi.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	score := bson.M{"$meta": "textScore"}
+	cur, err := mi.coll.Find(ctx, filter, options.Find().
+		SetProjection(bson.M{"_id": 1, "score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "timestamp", Value: -1}}).
+		SetSkip(int64(q.Offset)).
+		SetLimit(int64(q.Limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	hits := &Hits{Total: total, IDs: make([]primitive.ObjectID, 0, len(rows))}
+	for _, r := range rows {
+		hits.IDs = append(hits.IDs, r.ID)
+	}
+	return hits, nil
+}
+
+func (mi *MongoIndex) Persistent() bool {
+	return true
+}
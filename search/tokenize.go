@@ -0,0 +1,14 @@
+package search
+
+import (
+	"chat-app-backend/utils"
+	"strings"
+	"unicode"
+)
+
+// Tokenize bỏ dấu, chuyển chữ thường rồi tách từ theo ký tự không phải chữ/số
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(utils.FoldText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Độ dài tối đa của ghi chú bookmark
+const BookmarkMaxNoteLen = 500
+
+type BookmarkService struct {
+	DB                 *mongo.Database
+	ChannelService     *ChannelService
+	ChatHistoryService *ChatHistoryService
+}
+
+func NewBookmarkService() *BookmarkService {
+	return &BookmarkService{
+		DB:                 config.DB,
+		ChannelService:     NewChannelService(),
+		ChatHistoryService: NewChatHistoryService(),
+	}
+}
+
+// AddBookmark lưu tin nhắn cho user; đã lưu rồi thì chỉ cập nhật ghi chú
+func (bs *BookmarkService) AddBookmark(userID, messageID primitive.ObjectID, note string) (*models.Bookmark, error) {
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > BookmarkMaxNoteLen {
+		return nil, fmt.Errorf("note must be at most %d characters", BookmarkMaxNoteLen)
+	}
+
+	var msg models.Message
+	if err := bs.DB.Collection("messages").FindOne(context.Background(), bson.M{"_id": messageID}).Decode(&msg); err != nil {
+		return nil, errors.New("Message not found")
+	}
+	if msg.Recalled {
+		return nil, errors.New("Message has been recalled")
+	}
+	if msg.ExpiresAt != nil && !msg.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("Message has expired")
+	}
+	for _, h := range msg.HiddenBy {
+		if h == userID {
+			return nil, errors.New("Message not found")
+		}
+	}
+	// tin nhắn đang giữ chờ quét file chỉ người gửi thấy
+	if msg.Withheld && msg.SenderID != userID {
+		return nil, errors.New("Message not found")
+	}
+	channel, err := bs.ChannelService.GetChannel(msg.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if !bs.ChannelService.IsMember(channel, userID) {
+		return nil, errors.New("You are not a member of the channel")
+	}
+	if clearedAt := bs.ChatHistoryService.clearedAt(msg.ChannelID, userID); clearedAt != nil && !msg.Timestamp.After(*clearedAt) {
+		return nil, errors.New("Message not found")
+	}
+
+	now := time.Now()
+	var bookmark models.Bookmark
+	err = bs.DB.Collection("bookmarks").FindOneAndUpdate(context.Background(),
+		bson.M{"userID": userID, "messageID": messageID},
+		bson.M{
+			"$set": bson.M{"note": note, "updatedAt": now},
+			"$setOnInsert": bson.M{
+				"userID":    userID,
+				"messageID": messageID,
+				"channelID": msg.ChannelID,
+				"createdAt": now,
+			},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&bookmark)
+	if err != nil {
+		return nil, err
+	}
+	return &bookmark, nil
+}
+
+// RemoveBookmark bỏ lưu tin nhắn
+func (bs *BookmarkService) RemoveBookmark(userID, messageID primitive.ObjectID) error {
+	res, err := bs.DB.Collection("bookmarks").DeleteOne(context.Background(), bson.M{"userID": userID, "messageID": messageID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errors.New("Bookmark not found")
+	}
+	return nil
+}
+
+// GetBookmarks liệt kê bookmark mới nhất trước, phân trang theo cursor (id bookmark cuối trang trước).
+// Bookmark của tin đã thu hồi / hết hạn / bị ẩn / đang chờ quét file (của người khác) / trước mốc "xoá hội thoại", hoặc của kênh user không còn là thành viên
+// bị ẩn khỏi kết quả (không xoá, nên sẽ hiện lại nếu user quay lại kênh).
+func (bs *BookmarkService) GetBookmarks(userID primitive.ObjectID, cursor *primitive.ObjectID, limit int64) ([]map[string]interface{}, string, error) {
+	ctx := context.Background()
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	cleared, err := bs.ChatHistoryService.clearedAtByChannel(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	match := bson.M{"userID": userID}
+	if cursor != nil {
+		match["_id"] = bson.M{"$lt": *cursor}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.M{"_id": -1}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "messages",
+			"localField":   "messageID",
+			"foreignField": "_id",
+			"as":           "message",
+		}}},
+		{{Key: "$unwind", Value: "$message"}},
+		{{Key: "$match", Value: bson.M{
+			"message.recalled": bson.M{"$ne": true},
+			"message.hiddenBy": bson.M{"$ne": userID},
+			"$nor": append([]bson.M{
+				{"message.expiresAt": bson.M{"$lte": time.Now()}},
+				// tin nhắn chờ quét file chỉ người gửi thấy
+				{"message.withheld": true, "message.senderId": bson.M{"$ne": userID}},
+			}, clearedAtNor(cleared, "message.channelID", "message.timestamp")...),
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "channels",
+			"localField":   "channelID",
+			"foreignField": "_id",
+			"as":           "channel",
+		}}},
+		{{Key: "$unwind", Value: "$channel"}},
+		{{Key: "$match", Value: bson.M{"channel.members.memberID": userID}}},
+		{{Key: "$limit", Value: limit + 1}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "users",
+			"localField":   "message.senderId",
+			"foreignField": "_id",
+			"as":           "sender",
+		}}},
+	}
+
+	cur, err := bs.DB.Collection("bookmarks").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cur.Close(ctx)
+
+	var rows []struct {
+		models.Bookmark `bson:",inline"`
+		Message         models.Message `bson:"message"`
+		Channel         models.Channel `bson:"channel"`
+		Sender          []models.User  `bson:"sender"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if int64(len(rows)) > limit {
+		rows = rows[:limit]
+		nextCursor = rows[len(rows)-1].ID.Hex()
+	}
+
+	out := make([]map[string]interface{}, 0, len(rows))
+	for _, r := range rows {
+		var sender models.User
+		if len(r.Sender) > 0 {
+			sender = r.Sender[0]
+		}
+		out = append(out, map[string]interface{}{
+			"id":           r.ID.Hex(),
+			"note":         r.Note,
+			"createdAt":    r.CreatedAt,
+			"messageId":    r.Message.ID.Hex(),
+			"content":      r.Message.Content,
+			"messageType":  r.Message.MessageType,
+			"timestamp":    r.Message.Timestamp,
+			"url":          r.Message.URL,
+			"attachments":  r.Message.Attachments,
+			"channelId":    r.Channel.ID.Hex(),
+			"channelName":  r.Channel.ChannelName,
+			"channelType":  r.Channel.ChannelType,
+			"senderId":     r.Message.SenderID.Hex(),
+			"senderName":   sender.Name,
+			"senderAvatar": FullAvatarURL(sender.Avatar),
+		})
+	}
+	return out, nextCursor, nil
+}
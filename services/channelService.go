@@ -2,6 +2,7 @@ package services
 
 import (
 	"chat-app-backend/config"
+	"chat-app-backend/interfaces"
 	"chat-app-backend/models"
 	"context"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"os"
 	"strings"
@@ -20,6 +22,8 @@ type ChannelService struct {
 	DB                 *mongo.Database
 	UserChannelService *UserChannelService
 	ChatHistoryService *ChatHistoryService
+	// Notifier dùng để broadcast tin nhắn hệ thống (gán trong main, có thể nil)
+	Notifier interfaces.WebRTCNotifier
 }
 
 func NewChannelService() *ChannelService {
@@ -207,9 +211,9 @@ func (cs *ChannelService) generateGroupChannelName(memberNames []string) string
 }
 
 // AddMember Thêm thành viên vào kênh
-func (cs *ChannelService) AddMember(channel *models.Channel, memberID primitive.ObjectID) error {
+func (cs *ChannelService) AddMember(channel *models.Channel, adderID, memberID primitive.ObjectID) error {
 	// Kiểm tra quyền
-	if err := cs.HasPermission(channel, "addMember", memberID); err != nil {
+	if err := cs.HasPermission(channel, "addMember", adderID); err != nil {
 		return err
 	}
 
@@ -239,7 +243,13 @@ func (cs *ChannelService) AddMember(channel *models.Channel, memberID primitive.
 	if err != nil {
 		return err
 	}
+	channel.Members = append(channel.Members, models.ChannelMember{MemberID: memberID, Role: models.RoleMember})
 
+	cs.postSystemEvent(channel.ID, models.SystemEvent{
+		Action:   models.SystemActionMemberAdded,
+		ActorID:  adderID,
+		TargetID: &memberID,
+	})
 	return nil
 }
 
@@ -269,6 +279,11 @@ func (cs *ChannelService) RemoveMember(channel *models.Channel, removerID, membe
 		return errors.New("failed to update channel after removing member")
 	}
 
+	cs.postSystemEvent(channel.ID, models.SystemEvent{
+		Action:   models.SystemActionMemberRemoved,
+		ActorID:  removerID,
+		TargetID: &memberID,
+	})
 	return nil
 }
 
@@ -279,19 +294,51 @@ func (cs *ChannelService) LeaveChannel(channel *models.Channel, memberID primiti
 		return errors.New("Leader is not set or has invalid type")
 	}
 
+	idx := -1
 	for i, member := range channel.Members {
 		if member.MemberID == memberID {
-			if memberID == leaderID {
-				if newLeaderID == nil {
-					return errors.New("Leader must assign a new leader before leaving")
-				}
-				channel.ExtraData["leader"] = *newLeaderID
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return errors.New("Member not found in the channel")
+	}
+
+	leaderChanged := false
+	if memberID == leaderID {
+		if newLeaderID == nil {
+			return errors.New("Leader must assign a new leader before leaving")
+		}
+		if *newLeaderID == memberID || !cs.IsMember(channel, *newLeaderID) {
+			return errors.New("New leader must be another member of the channel")
+		}
+		channel.ExtraData["leader"] = *newLeaderID
+		for i := range channel.Members {
+			if channel.Members[i].MemberID == *newLeaderID {
+				channel.Members[i].Role = models.RoleLeader
 			}
-			channel.Members = append(channel.Members[:i], channel.Members[i+1:]...)
-			return nil
 		}
+		leaderChanged = true
 	}
-	return errors.New("Member not found in the channel")
+	channel.Members = append(channel.Members[:idx], channel.Members[idx+1:]...)
+
+	if err := cs.UpdateChannel(channel); err != nil {
+		return errors.New("failed to update channel after leaving")
+	}
+
+	if leaderChanged {
+		cs.postSystemEvent(channel.ID, models.SystemEvent{
+			Action:   models.SystemActionLeaderChanged,
+			ActorID:  memberID,
+			TargetID: newLeaderID,
+		})
+	}
+	cs.postSystemEvent(channel.ID, models.SystemEvent{
+		Action:  models.SystemActionMemberLeft,
+		ActorID: memberID,
+	})
+	return nil
 }
 
 // Trưởng nhóm giải tán nhóm
@@ -350,6 +397,11 @@ func (cs *ChannelService) BlockMember(channel *models.Channel, blockerID, member
 		return errors.New("failed to update channel after blocking member")
 	}
 
+	cs.postSystemEvent(channel.ID, models.SystemEvent{
+		Action:   models.SystemActionMemberBlocked,
+		ActorID:  blockerID,
+		TargetID: &memberID,
+	})
 	return nil
 }
 
@@ -406,15 +458,254 @@ func (cs *ChannelService) ToggleApproval(channel *models.Channel, leaderID primi
 	return nil
 }
 
+// Giới hạn thời gian tự hủy tin nhắn
+const (
+	MinMessageTTL = time.Minute
+	MaxMessageTTL = 30 * 24 * time.Hour
+)
+
+// MessageTTL trả về thời gian tự hủy tin nhắn của kênh (0 = tắt)
+func (cs *ChannelService) MessageTTL(channel *models.Channel) time.Duration {
+	return time.Duration(extraInt64(channel.ExtraData, "messageTTL")) * time.Second
+}
+
+// SetMessageTTL bật/tắt tin nhắn tự hủy cho kênh và chèn tin nhắn hệ thống thông báo thay đổi.
+// ttl = 0 để tắt. Kênh nhóm: chỉ leader/deputy; kênh riêng: thành viên bất kỳ.
+func (cs *ChannelService) SetMessageTTL(channel *models.Channel, requesterID primitive.ObjectID, ttl time.Duration) (*models.Message, error) {
+	if !cs.IsMember(channel, requesterID) {
+		return nil, errors.New("Requester is not a member of the channel")
+	}
+	if channel.ChannelType == models.ChannelTypeGroup {
+		if err := cs.HasPermission(channel, "setMessageTTL", requesterID); err != nil {
+			return nil, err
+		}
+	}
+	if ttl != 0 && (ttl < MinMessageTTL || ttl > MaxMessageTTL) {
+		return nil, fmt.Errorf("message TTL must be between %s and %s", MinMessageTTL, MaxMessageTTL)
+	}
+	ttl = ttl.Truncate(time.Second)
+	if ttl == cs.MessageTTL(channel) {
+		return nil, errors.New("Message TTL is unchanged")
+	}
+
+	if channel.ExtraData == nil {
+		channel.ExtraData = map[string]interface{}{}
+	}
+	channel.ExtraData["messageTTL"] = int64(ttl / time.Second)
+	if err := cs.UpdateChannel(channel); err != nil {
+		return nil, errors.New("failed to update channel message TTL")
+	}
+
+	return cs.postSystemEvent(channel.ID, models.SystemEvent{
+		Action:  models.SystemActionMessageTTLChanged,
+		ActorID: requesterID,
+		Value:   int64(ttl / time.Second),
+	})
+}
+
+// Giới hạn cửa sổ thu hồi / chỉnh sửa cấu hình theo kênh
+const (
+	MaxRecallWindow = 24 * time.Hour
+	MaxEditWindow   = 7 * 24 * time.Hour
+)
+
+// RecallWindow trả về cửa sổ thu hồi của kênh (ghi đè trong ExtraData hoặc mặc định server)
+func (cs *ChannelService) RecallWindow(channel *models.Channel) time.Duration {
+	if secs := extraInt64(channel.ExtraData, "recallWindow"); secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return ServerRecallWindow()
+}
+
+// EditWindow trả về cửa sổ chỉnh sửa của kênh (ghi đè trong ExtraData hoặc mặc định server)
+func (cs *ChannelService) EditWindow(channel *models.Channel) time.Duration {
+	if secs := extraInt64(channel.ExtraData, "editWindow"); secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return ServerEditWindow()
+}
+
+// SetMessageWindows ghi đè cửa sổ thu hồi / chỉnh sửa cho kênh.
+// nil = giữ nguyên, 0 = quay về mặc định server. Kênh nhóm: chỉ leader.
+func (cs *ChannelService) SetMessageWindows(channel *models.Channel, requesterID primitive.ObjectID, recall, edit *time.Duration) error {
+	if !cs.IsMember(channel, requesterID) {
+		return errors.New("Requester is not a member of the channel")
+	}
+	if channel.ChannelType == models.ChannelTypeGroup {
+		if err := cs.HasPermission(channel, "setMessageWindows", requesterID); err != nil {
+			return err
+		}
+	}
+	if recall != nil && (*recall < 0 || *recall > MaxRecallWindow) {
+		return fmt.Errorf("recall window must be between 0 and %s", MaxRecallWindow)
+	}
+	if edit != nil && (*edit < 0 || *edit > MaxEditWindow) {
+		return fmt.Errorf("edit window must be between 0 and %s", MaxEditWindow)
+	}
+
+	if channel.ExtraData == nil {
+		channel.ExtraData = map[string]interface{}{}
+	}
+	// lưu 0 thay vì xoá key: UpdateChannel dùng $set nên map rỗng sẽ không ghi đè được dữ liệu cũ
+	if recall != nil {
+		channel.ExtraData["recallWindow"] = int64(*recall / time.Second)
+	}
+	if edit != nil {
+		channel.ExtraData["editWindow"] = int64(*edit / time.Second)
+	}
+
+	if err := cs.UpdateChannel(channel); err != nil {
+		return errors.New("failed to update channel message windows")
+	}
+	return nil
+}
+
+// SingleReaction: kênh bật chế độ mỗi người chỉ một reaction trên một tin nhắn
+func (cs *ChannelService) SingleReaction(channel *models.Channel) bool {
+	enabled, _ := channel.ExtraData["singleReaction"].(bool)
+	return enabled
+}
+
+// SetReactionMode bật/tắt chế độ một reaction mỗi người. Kênh nhóm: leader hoặc deputy.
+func (cs *ChannelService) SetReactionMode(channel *models.Channel, requesterID primitive.ObjectID, single bool) error {
+	if !cs.IsMember(channel, requesterID) {
+		return errors.New("Requester is not a member of the channel")
+	}
+	if channel.ChannelType == models.ChannelTypeGroup {
+		if err := cs.HasPermission(channel, "setReactionMode", requesterID); err != nil {
+			return err
+		}
+	}
+
+	if channel.ExtraData == nil {
+		channel.ExtraData = map[string]interface{}{}
+	}
+	channel.ExtraData["singleReaction"] = single
+
+	if err := cs.UpdateChannel(channel); err != nil {
+		return errors.New("failed to update channel reaction mode")
+	}
+	return nil
+}
+
+// postSystemEvent lưu tin nhắn hệ thống (MessageTypeSystem) cho một sự kiện của kênh,
+// cập nhật preview trong chathistory và broadcast "message_new" qua Notifier.
+// Lỗi chỉ được log lại: sự kiện của kênh đã được ghi DB trước đó.
+func (cs *ChannelService) postSystemEvent(channelID primitive.ObjectID, event models.SystemEvent) (*models.Message, error) {
+	now := time.Now()
+	content := cs.ChatHistoryService.SystemEventPreview(&event)
+	message := &models.Message{
+		ID:          primitive.NewObjectID(),
+		ChannelID:   channelID,
+		Content:     content,
+		Timestamp:   now,
+		MessageType: models.MessageTypeSystem,
+		SenderID:    event.ActorID,
+		Status:      models.MessageStatusSent,
+		SystemEvent: &event,
+	}
+	if _, err := cs.DB.Collection("messages").InsertOne(context.Background(), message); err != nil {
+		log.Printf("[postSystemEvent] Insert system message error: %v", err)
+		return nil, err
+	}
+
+	_, err := cs.DB.Collection("chathistory").UpdateOne(
+		context.Background(),
+		bson.M{"channelID": channelID},
+		bson.M{"$set": bson.M{
+			"channelID": channelID,
+			"lastMessage": models.LastMessagePreview{
+				ID:      message.ID,
+				Content: content,
+				Type:    string(message.MessageType),
+				Sender:  event.ActorID,
+			},
+			"lastActive": now,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("[postSystemEvent] Update chat history error: %v", err)
+	}
+
+	if cs.Notifier != nil {
+		payload := SystemMessagePayload(message)
+		cs.Notifier.BroadcastMessage(channelID, payload)
+		// người bị xoá/chặn không còn trong Members nên gửi riêng
+		if event.TargetID != nil && (event.Action == models.SystemActionMemberRemoved || event.Action == models.SystemActionMemberBlocked) {
+			cs.Notifier.NotifyUser(event.TargetID.Hex(), payload)
+		}
+	}
+	return message, nil
+}
+
+// SystemMessagePayload chuẩn hoá payload "message_new" cho tin nhắn hệ thống
+func SystemMessagePayload(msg *models.Message) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "message_new",
+		"id":          msg.ID.Hex(),
+		"content":     msg.Content,
+		"timestamp":   msg.Timestamp,
+		"messageType": msg.MessageType,
+		"senderId":    msg.SenderID.Hex(),
+		"status":      msg.Status,
+		"recalled":    msg.Recalled,
+		"channelId":   msg.ChannelID.Hex(),
+		"systemEvent": msg.SystemEvent,
+	}
+}
+
+// formatTTL hiển thị thời lượng dạng "24 giờ", "7 ngày", "30 phút"
+func formatTTL(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d ngày", d/(24*time.Hour))
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%d giờ", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%d phút", d/time.Minute)
+	default:
+		return fmt.Sprintf("%d giây", d/time.Second)
+	}
+}
+
+// extraInt64 đọc số nguyên từ ExtraData (BSON có thể trả int32/int64/float64)
+func extraInt64(extra map[string]interface{}, key string) int64 {
+	switch v := extra[key].(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
 func (cs *ChannelService) HasPermission(channel *models.Channel, action string, requesterID primitive.ObjectID) error {
 	requesterRole := cs.roleOf(channel, requesterID)
 
 	switch action {
-	case "removeMember", "blockMember", "unblockMember":
+	case "addMember":
+		// người thêm phải đang là thành viên nhóm; nhóm bật phê duyệt thì chỉ Leader/Deputy được thêm trực tiếp
+		if channel.ChannelType != models.ChannelTypeGroup {
+			return errors.New("Members can only be added to group channels")
+		}
+		if !cs.IsMember(channel, requesterID) {
+			return errors.New("Only members can add members to the channel")
+		}
+		approvalRequired, _ := channel.ExtraData["approvalRequired"].(bool)
+		if approvalRequired && requesterRole != models.RoleLeader && requesterRole != models.RoleDeputy {
+			return errors.New("Approval is required: only leader or deputy can add members")
+		}
+	case "removeMember", "blockMember", "unblockMember", "setMessageTTL", "setReactionMode":
 		if requesterRole != models.RoleLeader && requesterRole != models.RoleDeputy {
 			return errors.New("Only leader or deputy can perform this action")
 		}
-	case "dissolveChannel", "toggleApproval":
+	case "dissolveChannel", "toggleApproval", "setMessageWindows", "manageStickers":
 		if requesterRole != models.RoleLeader {
 			return errors.New("Only the leader can perform this action")
 		}
@@ -667,7 +958,7 @@ func (cs *ChannelService) FindOrCreatePrivateChannel(member1 string, member2 str
 		return nil, err
 	}
 
-	chatItems, err := cs.ChatHistoryService.GetChatHistoryByUserID(id1)
+	chatItems, err := cs.ChatHistoryService.GetChatHistoryByUserID(id1, nil)
 	if err != nil {
 		return nil, err
 	}
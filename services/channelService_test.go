@@ -0,0 +1,49 @@
+package services
+
+import (
+	"chat-app-backend/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHasPermissionAddMember(t *testing.T) {
+	leader, deputy, member, outsider := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	group := func(approvalRequired bool) *models.Channel {
+		return &models.Channel{
+			ChannelType: models.ChannelTypeGroup,
+			Members: []models.ChannelMember{
+				{MemberID: leader, Role: models.RoleLeader},
+				{MemberID: deputy, Role: models.RoleDeputy},
+				{MemberID: member, Role: models.RoleMember},
+			},
+			ExtraData: map[string]interface{}{"leader": leader, "approvalRequired": approvalRequired},
+		}
+	}
+	private := &models.Channel{
+		ChannelType: models.ChannelTypePrivate,
+		Members:     []models.ChannelMember{{MemberID: member, Role: models.RoleMember}},
+	}
+
+	cs := &ChannelService{}
+	tests := []struct {
+		name      string
+		channel   *models.Channel
+		requester primitive.ObjectID
+		allowed   bool
+	}{
+		{"member, open group", group(false), member, true},
+		{"outsider, open group", group(false), outsider, false},
+		{"member, approval required", group(true), member, false},
+		{"deputy, approval required", group(true), deputy, true},
+		{"leader, approval required", group(true), leader, true},
+		{"outsider, approval required", group(true), outsider, false},
+		{"private channel", private, member, false},
+	}
+	for _, tt := range tests {
+		err := cs.HasPermission(tt.channel, "addMember", tt.requester)
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s: err = %v, want allowed=%v", tt.name, err, tt.allowed)
+		}
+	}
+}
@@ -46,16 +46,27 @@ func (chs *ChatHistoryService) GetChatHistory(channelID, userID primitive.Object
 			var otherUser models.User
 			if err := userCollection.FindOne(ctx, bson.M{"_id": otherUC.UserID}).Decode(&otherUser); err == nil {
 				result["userName"] = otherUser.Name
-				result["userAvatar"] = fullAvatarURL(otherUser.Avatar)
+				result["userAvatar"] = FullAvatarURL(otherUser.Avatar)
 			}
 		}
 	} else {
 		result["channelName"] = channel.ChannelName
-		result["channelAvatar"] = fullAvatarURL(channel.Avatar)
+		result["channelAvatar"] = FullAvatarURL(channel.Avatar)
 	}
 
 	// --- Messages ---
-	cur, err := messagesCollection.Find(ctx, bson.M{"channelID": channelID}, options.Find().SetSort(bson.D{{"timestamp", 1}}))
+	// bỏ qua tin nhắn tự hủy đã hết hạn nhưng chưa được sweeper dọn, và tin nhắn chờ quét file của người khác
+	filter := bson.M{
+		"channelID": channelID,
+		"$nor": []bson.M{
+			{"expiresAt": bson.M{"$lte": time.Now()}},
+			{"withheld": true, "senderId": bson.M{"$ne": userID}},
+		},
+	}
+	if clearedAt := chs.clearedAt(channelID, userID); clearedAt != nil {
+		filter["timestamp"] = bson.M{"$gt": *clearedAt}
+	}
+	cur, err := messagesCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
 	if err != nil {
 		return nil, err
 	}
@@ -103,13 +114,21 @@ func (chs *ChatHistoryService) GetChatHistory(channelID, userID primitive.Object
 			"messageType":  msg.MessageType,
 			"senderId":     msg.SenderID,
 			"senderName":   sender.Name,
-			"senderAvatar": fullAvatarURL(sender.Avatar),
+			"senderAvatar": FullAvatarURL(sender.Avatar),
 			"status":       msg.Status,
 			"recalled":     msg.Recalled,
+			"recalledBy":   msg.RecalledBy,
+			"recallKind":   msg.RecallKind,
+			"systemEvent":  msg.SystemEvent,
+			"mentions":     msg.Mentions,
+			"mentionAll":   msg.MentionAll,
+			"linkPreview":  msg.LinkPreview,
+			"poll":         PollView(msg.Poll, userID),
 			"url":          msg.URL,
 			"fileId":       msg.FileID,
 			"reactions":    msg.Reactions,
 			"replyTo":      reply,
+			"expiresAt":    msg.ExpiresAt,
 		})
 	}
 
@@ -118,7 +137,8 @@ func (chs *ChatHistoryService) GetChatHistory(channelID, userID primitive.Object
 }
 
 // Lấy lịch sử kênh chat của người dùng (KHÔNG phụ thuộc chatHistory.Message)
-func (chs *ChatHistoryService) GetChatHistoryByUserID(userID primitive.ObjectID) ([]map[string]interface{}, error) {
+// archived: true = chỉ hội thoại đã lưu trữ, false = bỏ chúng đi, nil = tất cả
+func (chs *ChatHistoryService) GetChatHistoryByUserID(userID primitive.ObjectID, archived *bool) ([]map[string]interface{}, error) {
 	userChannelsColl := chs.DB.Collection("userChannels")
 	chathistoryColl := chs.DB.Collection("chathistory")
 	channelsColl := chs.DB.Collection("channels")
@@ -126,7 +146,15 @@ func (chs *ChatHistoryService) GetChatHistoryByUserID(userID primitive.ObjectID)
 	usersColl := chs.DB.Collection("users")
 
 	// 1) Lấy các channel của user
-	cur, err := userChannelsColl.Find(context.Background(), bson.M{"userID": userID})
+	ucFilter := bson.M{"userID": userID}
+	if archived != nil {
+		if *archived {
+			ucFilter["archived"] = true
+		} else {
+			ucFilter["archived"] = bson.M{"$ne": true}
+		}
+	}
+	cur, err := userChannelsColl.Find(context.Background(), ucFilter)
 	if err != nil {
 		return nil, err
 	}
@@ -191,6 +219,10 @@ func (chs *ChatHistoryService) GetChatHistoryByUserID(userID primitive.ObjectID)
 					{"hiddenBy": bson.M{"$exists": false}},
 					{"hiddenBy": bson.M{"$ne": userID}},
 				},
+				"$nor": []bson.M{
+					{"expiresAt": bson.M{"$lte": time.Now()}},
+					{"withheld": true, "senderId": bson.M{"$ne": userID}},
+				},
 			}
 			var lastMsg models.Message
 			if err := messagesColl.FindOne(
@@ -205,9 +237,11 @@ func (chs *ChatHistoryService) GetChatHistoryByUserID(userID primitive.ObjectID)
 					case models.MessageTypeFile:
 						lastMessageContent = "[Tệp]"
 					case models.MessageTypeVoice:
-						lastMessageContent = "[Voice]"
+						lastMessageContent = VoicePreview(lastMsg.Attachments)
 					case models.MessageTypeSticker:
 						lastMessageContent = "[Sticker]"
+					case models.MessageTypeSystem:
+						lastMessageContent = chs.SystemEventPreview(lastMsg.SystemEvent)
 					default:
 						lastMessageContent = lastMsg.Content
 					}
@@ -219,6 +253,16 @@ func (chs *ChatHistoryService) GetChatHistoryByUserID(userID primitive.ObjectID)
 			}
 		}
 
+		// user đã xoá hội thoại và chưa có tin nhắn mới → ẩn khỏi danh sách
+		if uc.ClearedAt != nil && !lastActive.After(*uc.ClearedAt) && uc.Draft == nil {
+			continue
+		}
+
+		// có bản nháp thì hiển thị bản nháp thay cho tin nhắn cuối
+		if uc.Draft != nil {
+			lastMessageContent = "[Bản nháp] " + uc.Draft.Content
+		}
+
 		item := map[string]interface{}{
 			"channelID":     uc.ChannelID,
 			"channelAvatar": channelAvatar,
@@ -228,6 +272,11 @@ func (chs *ChatHistoryService) GetChatHistoryByUserID(userID primitive.ObjectID)
 			"userAvatar":    userAvatar,
 			"lastMessage":   lastMessageContent,
 			"lastActive":    lastActive,
+			"pinned":        uc.Pinned,
+			"archived":      uc.Archived,
+			"muted":         uc.IsMuted(),
+			"mutedUntil":    uc.MutedUntil,
+			"draft":         uc.Draft,
 		}
 		items = append(items, item)
 	}
@@ -235,8 +284,13 @@ func (chs *ChatHistoryService) GetChatHistoryByUserID(userID primitive.ObjectID)
 		return nil, err
 	}
 
-	// 6) Sắp xếp theo lastActive giảm dần
-	sort.Slice(items, func(i, j int) bool {
+	// 6) Hội thoại được ghim lên đầu, còn lại sắp xếp theo lastActive giảm dần
+	sort.SliceStable(items, func(i, j int) bool {
+		pi, _ := items[i]["pinned"].(bool)
+		pj, _ := items[j]["pinned"].(bool)
+		if pi != pj {
+			return pi
+		}
 		ti, _ := items[i]["lastActive"].(time.Time)
 		tj, _ := items[j]["lastActive"].(time.Time)
 		return ti.After(tj)
@@ -245,7 +299,51 @@ func (chs *ChatHistoryService) GetChatHistoryByUserID(userID primitive.ObjectID)
 	return items, nil
 }
 
-// Xóa lịch sử chat
+// clearedAt trả mốc "xoá hội thoại" của user trong kênh (nil nếu chưa xoá)
+func (chs *ChatHistoryService) clearedAt(channelID, userID primitive.ObjectID) *time.Time {
+	var uc models.UserChannel
+	if err := chs.DB.Collection("userChannels").FindOne(context.Background(),
+		bson.M{"userID": userID, "channelID": channelID},
+	).Decode(&uc); err != nil {
+		return nil
+	}
+	return uc.ClearedAt
+}
+
+// clearedAtByChannel trả mốc "xoá hội thoại" của user theo từng kênh (chỉ các kênh đã xoá)
+func (chs *ChatHistoryService) clearedAtByChannel(userID primitive.ObjectID) (map[primitive.ObjectID]time.Time, error) {
+	ctx := context.Background()
+	cur, err := chs.DB.Collection("userChannels").Find(ctx,
+		bson.M{"userID": userID, "clearedAt": bson.M{"$ne": nil}},
+		options.Find().SetProjection(bson.M{"channelID": 1, "clearedAt": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var ucs []models.UserChannel
+	if err := cur.All(ctx, &ucs); err != nil {
+		return nil, err
+	}
+	cleared := make(map[primitive.ObjectID]time.Time, len(ucs))
+	for _, uc := range ucs {
+		if uc.ClearedAt != nil {
+			cleared[uc.ChannelID] = *uc.ClearedAt
+		}
+	}
+	return cleared, nil
+}
+
+// clearedAtNor là các điều kiện cho $nor để bỏ tin nhắn không muộn hơn mốc xoá hội thoại của kênh;
+// channelField/timestampField là đường dẫn tới channelID và timestamp của tin nhắn trong document
+func clearedAtNor(cleared map[primitive.ObjectID]time.Time, channelField, timestampField string) []bson.M {
+	nor := make([]bson.M, 0, len(cleared))
+	for channelID, t := range cleared {
+		nor = append(nor, bson.M{channelField: channelID, timestampField: bson.M{"$lte": t}})
+	}
+	return nor
+}
+
+// Xóa lịch sử chat (document chathistory dùng chung của cả kênh) — chỉ dành cho admin
 func (chs *ChatHistoryService) DeleteChatHistory(channelID primitive.ObjectID) error {
 	chatHistoryCollection := chs.DB.Collection("chathistory")
 	_, err := chatHistoryCollection.DeleteOne(context.Background(), bson.M{"channelID": channelID})
@@ -280,9 +378,21 @@ func (chs *ChatHistoryService) GetChannelMessages(
 			{"hiddenBy": bson.M{"$exists": false}},
 			{"hiddenBy": bson.M{"$ne": viewerID}},
 		},
+		"$nor": []bson.M{
+			{"expiresAt": bson.M{"$lte": time.Now()}},
+			// tin nhắn chờ quét file chỉ người gửi thấy
+			{"withheld": true, "senderId": bson.M{"$ne": viewerID}},
+		},
 	}
+	ts := bson.M{}
 	if !beforeTS.IsZero() {
-		match["timestamp"] = bson.M{"$lt": beforeTS}
+		ts["$lt"] = beforeTS
+	}
+	if clearedAt := chs.clearedAt(channelID, viewerID); clearedAt != nil {
+		ts["$gt"] = *clearedAt
+	}
+	if len(ts) > 0 {
+		match["timestamp"] = ts
 	}
 
 	pipeline := mongo.Pipeline{
@@ -322,11 +432,21 @@ func (chs *ChatHistoryService) GetChannelMessages(
 				"senderID":     1,
 				"status":       1,
 				"recalled":     1,
+				"recalledBy":   1,
+				"recallKind":   1,
+				"systemEvent":  1,
+				"linkPreview":  1,
+				"poll":         1,
 				"url":          1,
 				"fileID":       1,
 				"channelID":    1,
 				"senderName":   1,
 				"senderAvatar": 1,
+				"reactions":    1,
+				"attachments":  1,
+				"mentions":     1,
+				"mentionAll":   1,
+				"expiresAt":    1,
 			}},
 		},
 		{{Key: "$sort", Value: bson.M{"timestamp": 1}}}, // trả về theo thứ tự tăng
@@ -348,12 +468,21 @@ func (chs *ChatHistoryService) GetChannelMessages(
 			SenderID     primitive.ObjectID   `bson:"senderID"`
 			Status       models.MessageStatus `bson:"status"`
 			Recalled     bool                 `bson:"recalled"`
+			RecalledBy   *primitive.ObjectID  `bson:"recalledBy"`
+			RecallKind   models.RecallKind    `bson:"recallKind"`
+			SystemEvent  *models.SystemEvent  `bson:"systemEvent"`
+			LinkPreview  *models.LinkPreview  `bson:"linkPreview"`
+			Poll         *models.Poll         `bson:"poll"`
 			URL          string               `bson:"url"`
 			FileID       *primitive.ObjectID  `bson:"fileID"`
 			ChannelID    primitive.ObjectID   `bson:"channelID"`
 			SenderName   string               `bson:"senderName"`
 			SenderAvatar string               `bson:"senderAvatar"`
 			Reactions    []models.Reaction    `bson:"reactions"`
+			Attachments  []models.Attachment  `bson:"attachments"`
+			Mentions     []primitive.ObjectID `bson:"mentions"`
+			MentionAll   bool                 `bson:"mentionAll"`
+			ExpiresAt    *time.Time           `bson:"expiresAt"`
 		}
 		if err := cur.Decode(&m); err != nil {
 			return nil, err
@@ -366,13 +495,22 @@ func (chs *ChatHistoryService) GetChannelMessages(
 			"messageType":  m.MessageType,
 			"senderId":     m.SenderID.Hex(),
 			"senderName":   m.SenderName,
-			"senderAvatar": fullAvatarURL(m.SenderAvatar),
+			"senderAvatar": FullAvatarURL(m.SenderAvatar),
 			"status":       m.Status,
 			"recalled":     m.Recalled,
+			"recalledBy":   m.RecalledBy,
+			"recallKind":   m.RecallKind,
+			"systemEvent":  m.SystemEvent,
+			"linkPreview":  m.LinkPreview,
+			"poll":         PollView(m.Poll, viewerID),
 			"url":          m.URL,
 			"fileId":       m.FileID,
 			"channelId":    m.ChannelID.Hex(),
 			"reactions":    m.Reactions,
+			"attachments":  m.Attachments,
+			"mentions":     m.Mentions,
+			"mentionAll":   m.MentionAll,
+			"expiresAt":    m.ExpiresAt,
 		})
 	}
 	if err := cur.Err(); err != nil {
@@ -390,8 +528,50 @@ func (chs *ChatHistoryService) GetMessages(channelID, viewerID primitive.ObjectI
 	return chs.GetChannelMessages(channelID, viewerID, ts, limit)
 }
 
-// trả về absolute URL cho avatar (lấy từ env PUBLIC_BASE_URL, mặc định localhost)
-func fullAvatarURL(path string) string {
+// SystemEventPreview hiển thị sự kiện của kênh thành câu tiếng Việt (dùng cho content + preview)
+func (chs *ChatHistoryService) SystemEventPreview(event *models.SystemEvent) string {
+	if event == nil {
+		return ""
+	}
+	actor := chs.userDisplayName(event.ActorID)
+	target := ""
+	if event.TargetID != nil {
+		target = chs.userDisplayName(*event.TargetID)
+	}
+
+	switch event.Action {
+	case models.SystemActionMemberAdded:
+		return fmt.Sprintf("%s đã thêm %s vào nhóm", actor, target)
+	case models.SystemActionMemberRemoved:
+		return fmt.Sprintf("%s đã xóa %s khỏi nhóm", actor, target)
+	case models.SystemActionMemberBlocked:
+		return fmt.Sprintf("%s đã chặn %s khỏi nhóm", actor, target)
+	case models.SystemActionMemberLeft:
+		return fmt.Sprintf("%s đã rời khỏi nhóm", actor)
+	case models.SystemActionLeaderChanged:
+		return fmt.Sprintf("%s đã chuyển quyền trưởng nhóm cho %s", actor, target)
+	case models.SystemActionMessageTTLChanged:
+		if event.Value <= 0 {
+			return fmt.Sprintf("%s đã tắt tin nhắn tự hủy", actor)
+		}
+		return fmt.Sprintf("%s đã bật tin nhắn tự hủy: %s", actor, formatTTL(time.Duration(event.Value)*time.Second))
+	default:
+		return "Thông báo hệ thống"
+	}
+}
+
+func (chs *ChatHistoryService) userDisplayName(userID primitive.ObjectID) string {
+	var u struct {
+		Name string `bson:"name"`
+	}
+	if err := chs.DB.Collection("users").FindOne(context.Background(), bson.M{"_id": userID}).Decode(&u); err != nil || u.Name == "" {
+		return "Một thành viên"
+	}
+	return u.Name
+}
+
+// FullAvatarURL trả về absolute URL cho avatar (lấy từ env PUBLIC_BASE_URL, mặc định localhost)
+func FullAvatarURL(path string) string {
 	if path == "" {
 		return ""
 	}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestClearedAtNor(t *testing.T) {
+	if nor := clearedAtNor(nil, "channelID", "timestamp"); len(nor) != 0 {
+		t.Fatalf("nor = %v, want empty", nor)
+	}
+
+	ch := primitive.NewObjectID()
+	at := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	nor := clearedAtNor(map[primitive.ObjectID]time.Time{ch: at}, "message.channelID", "message.timestamp")
+	if len(nor) != 1 || nor[0]["message.channelID"] != ch || nor[0]["message.timestamp"].(bson.M)["$lte"] != at {
+		t.Fatalf("nor = %v", nor)
+	}
+}
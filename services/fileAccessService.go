@@ -0,0 +1,255 @@
+package services
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultSignedURLTTL = time.Hour // thời hạn mặc định của URL download đã ký (FILE_URL_TTL)
+	MaxSignedURLBatch   = 100       // số URL tối đa mỗi lần ký hàng loạt
+)
+
+var ErrFileAccessDenied = errors.New("You do not have access to this file")
+
+type FileAccessService struct {
+	DB             *mongo.Database
+	ChannelService *ChannelService
+}
+
+func NewFileAccessService() *FileAccessService {
+	return &FileAccessService{
+		DB:             config.DB,
+		ChannelService: NewChannelService(),
+	}
+}
+
+// SignedURLTTL đọc FILE_URL_TTL (duration, ví dụ "30m")
+func SignedURLTTL() time.Duration {
+	return durationFromEnv("FILE_URL_TTL", DefaultSignedURLTTL)
+}
+
+// ErrFileURLSecretMissing: chưa cấu hình khoá ký URL; không ký bằng khoá rỗng (ai cũng tự ký được)
+var ErrFileURLSecretMissing = errors.New("FILE_URL_SECRET (or JWT_SECRET) is not configured")
+
+// fileURLSecret: FILE_URL_SECRET, không có thì dùng JWT_SECRET
+func fileURLSecret() []byte {
+	if s := os.Getenv("FILE_URL_SECRET"); s != "" {
+		return []byte(s)
+	}
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+func fileSignature(fileID primitive.ObjectID, exp int64) (string, error) {
+	secret := fileURLSecret()
+	if len(secret) == 0 {
+		return "", ErrFileURLSecretMissing
+	}
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s.%d", fileID.Hex(), exp)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyFileSignature kiểm tra chữ ký và hạn của URL đã ký (exp là unix giây)
+func VerifyFileSignature(fileID primitive.ObjectID, exp, sig string) bool {
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || sig == "" || time.Now().Unix() > expUnix {
+		return false
+	}
+	expected, err := fileSignature(fileID, expUnix)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(expected))
+}
+
+// SignedDownloadURL tạo URL download có hạn, dùng được trực tiếp trong <img>/<audio> (không cần header Authorization)
+func SignedDownloadURL(fileID primitive.ObjectID, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	exp := expiresAt.Unix()
+	sig, err := fileSignature(fileID, exp)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	base := os.Getenv("PUBLIC_BASE_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return fmt.Sprintf("%s/api/files/%s/download?exp=%d&sig=%s", base, fileID.Hex(), exp, sig), expiresAt, nil
+}
+
+func (fas *FileAccessService) GetFile(fileID primitive.ObjectID) (*models.File, error) {
+	var file models.File
+	if err := fas.DB.Collection("files").FindOne(context.Background(), bson.M{"_id": fileID}).Decode(&file); err != nil {
+		return nil, errors.New("File not found")
+	}
+	return &file, nil
+}
+
+// FindByStorageKey tìm các bản ghi file theo key trên storage (file gốc hoặc thumbnail) cho các URL cũ dạng /uploads/<key>.
+// Sau khi khử trùng lặp nhiều bản ghi (của nhiều người upload) có thể dùng chung một key nên trả về tất cả.
+// Bản ghi cũ chưa lưu key thì so theo đuôi URL. Không có bản ghi nào thì trả mongo.ErrNoDocuments.
+func (fas *FileAccessService) FindByStorageKey(provider, key string) ([]models.File, error) {
+	return fas.findFiles(bson.M{
+		"$or": []bson.M{
+			{"provider": provider, "storageKey": key},
+			{"provider": provider, "thumbnails.key": key},
+			{"storageKey": bson.M{"$exists": false}, "url": bson.M{"$regex": "/" + regexp.QuoteMeta(key) + "$"}},
+		},
+	})
+}
+
+// FindByURL tìm các bản ghi file theo URL đã lưu trong tin nhắn/hồ sơ (file gốc hoặc thumbnail)
+func (fas *FileAccessService) FindByURL(url string) ([]models.File, error) {
+	return fas.findFiles(bson.M{"$or": []bson.M{{"url": url}, {"thumbnails.url": url}}})
+}
+
+func (fas *FileAccessService) findFiles(filter bson.M) ([]models.File, error) {
+	cur, err := fas.DB.Collection("files").Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	var files []models.File
+	if err := cur.All(context.Background(), &files); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return files, nil
+}
+
+// ThumbnailIndex trả chỉ số thumbnail có URL hoặc key trùng ref (-1 nếu ref là file gốc)
+func ThumbnailIndex(file *models.File, ref string) int {
+	if file.URL == ref || file.StorageKey == ref {
+		return -1
+	}
+	for i, t := range file.Thumbnails {
+		if t.URL == ref || t.Key == ref {
+			return i
+		}
+	}
+	return -1
+}
+
+// FirstAccessible chọn trong các bản ghi dùng chung một nội dung bản ghi đầu tiên userID được xem,
+// ưu tiên bản ghi của chính userID. Không bản ghi nào xem được thì trả ErrFileAccessDenied.
+func (fas *FileAccessService) FirstAccessible(files []models.File, userID *primitive.ObjectID) (*models.File, error) {
+	ordered := make([]*models.File, 0, len(files))
+	for i := range files {
+		if userID != nil && files[i].OwnerID != nil && *files[i].OwnerID == *userID {
+			ordered = append([]*models.File{&files[i]}, ordered...)
+		} else {
+			ordered = append(ordered, &files[i])
+		}
+	}
+	var lastErr error = ErrFileAccessDenied
+	for _, file := range ordered {
+		err := fas.CanAccess(file, userID)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, ErrFileAccessDenied) {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// IsPublic: avatar, ảnh bìa, avatar kênh, sticker và emoji tuỳ chỉnh ai cũng xem được
+func (fas *FileAccessService) IsPublic(file *models.File) (bool, error) {
+	ctx := context.Background()
+	checks := []struct {
+		collection string
+		filter     bson.M
+	}{
+		{"users", bson.M{"$or": []bson.M{{"avatar": file.URL}, {"coverPhoto": file.URL}}}},
+		{"channels", bson.M{"avatar": file.URL}},
+		{"stickerPacks", bson.M{"stickers.fileID": file.ID}},
+		{"customEmojis", bson.M{"fileID": file.ID}},
+	}
+	for _, c := range checks {
+		n, err := fas.DB.Collection(c.collection).CountDocuments(ctx, c.filter, options.Count().SetLimit(1))
+		if err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CanAccess: file công khai, người upload, hoặc thành viên của kênh có tin nhắn chứa file do chính người upload gửi.
+// File đang chờ quét (hoặc quét lỗi) chỉ người upload xem được; file nhiễm mã độc thì không ai xem được.
+func (fas *FileAccessService) CanAccess(file *models.File, userID *primitive.ObjectID) error {
+	switch file.ScanStatus {
+	case models.ScanStatusInfected:
+		return ErrFileAccessDenied
+	case models.ScanStatusPending, models.ScanStatusError:
+		if userID != nil && file.OwnerID != nil && *file.OwnerID == *userID {
+			return nil
+		}
+		return ErrFileAccessDenied
+	}
+	if userID != nil && file.OwnerID != nil && *file.OwnerID == *userID {
+		return nil
+	}
+	public, err := fas.IsPublic(file)
+	if err != nil {
+		return err
+	}
+	if public {
+		return nil
+	}
+	if userID == nil {
+		return ErrFileAccessDenied
+	}
+
+	channelIDs, err := fas.DB.Collection("messages").Distinct(context.Background(), "channelID", fileMessagesFilter(file))
+	if err != nil {
+		return err
+	}
+	for _, v := range channelIDs {
+		id, ok := v.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		channel, err := fas.ChannelService.GetChannel(id)
+		if err == nil && fas.ChannelService.IsMember(channel, *userID) {
+			return nil
+		}
+	}
+	return ErrFileAccessDenied
+}
+
+// fileMessagesFilter: tin nhắn chưa thu hồi chứa file và do chính người upload gửi. Tin nhắn người khác
+// dán ID/URL của file vào không cho thêm quyền xem. Bản ghi cũ chưa có ownerId thì không lọc theo người gửi.
+func fileMessagesFilter(file *models.File) bson.M {
+	filter := bson.M{
+		"$or": []bson.M{
+			{"fileId": file.ID},
+			{"url": file.URL},
+			{"attachments.url": file.URL},
+		},
+		"recalled": bson.M{"$ne": true},
+	}
+	if file.OwnerID != nil {
+		filter["senderId"] = *file.OwnerID
+	}
+	return filter
+}
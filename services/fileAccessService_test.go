@@ -0,0 +1,87 @@
+package services
+
+import (
+	"chat-app-backend/models"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFileMessagesFilterOnlyCountsOwnerMessages(t *testing.T) {
+	owner := primitive.NewObjectID()
+	file := &models.File{ID: primitive.NewObjectID(), URL: "/uploads/a.png", OwnerID: &owner}
+
+	if got, ok := fileMessagesFilter(file)["senderId"]; !ok || got != owner {
+		t.Fatalf("senderId = %v, want owner %s", got, owner.Hex())
+	}
+
+	// bản ghi cũ chưa có ownerId: không lọc theo người gửi
+	legacy := &models.File{ID: primitive.NewObjectID(), URL: "/uploads/b.png"}
+	if _, ok := fileMessagesFilter(legacy)["senderId"]; ok {
+		t.Fatal("legacy file without owner must not filter by sender")
+	}
+}
+
+func TestSignedDownloadURLRequiresSecret(t *testing.T) {
+	fileID := primitive.NewObjectID()
+	exp := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+
+	t.Setenv("FILE_URL_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+	if _, _, err := SignedDownloadURL(fileID, time.Minute); !errors.Is(err, ErrFileURLSecretMissing) {
+		t.Fatalf("err = %v, want ErrFileURLSecretMissing", err)
+	}
+	if VerifyFileSignature(fileID, exp, "00") {
+		t.Fatal("signature must not verify without a secret")
+	}
+
+	t.Setenv("JWT_SECRET", "test-secret")
+	url, expiresAt, err := SignedDownloadURL(fileID, time.Minute)
+	if err != nil {
+		t.Fatalf("SignedDownloadURL: %v", err)
+	}
+	sig := url[strings.LastIndex(url, "sig=")+len("sig="):]
+	if !VerifyFileSignature(fileID, strconv.FormatInt(expiresAt.Unix(), 10), sig) {
+		t.Fatalf("signature of %s does not verify", url)
+	}
+	if VerifyFileSignature(primitive.NewObjectID(), strconv.FormatInt(expiresAt.Unix(), 10), sig) {
+		t.Fatal("signature must not verify for another file")
+	}
+}
+
+func TestFirstAccessibleSharedBlob(t *testing.T) {
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+	files := []models.File{
+		{ID: primitive.NewObjectID(), URL: "/uploads/shared.png", OwnerID: &alice, ScanStatus: models.ScanStatusPending},
+		{ID: primitive.NewObjectID(), URL: "/uploads/shared.png", OwnerID: &bob, ScanStatus: models.ScanStatusClean},
+	}
+	fas := &FileAccessService{}
+
+	// bản ghi đầu không xem được (đang chờ quét của người khác) nhưng bản ghi của chính bob thì được
+	file, err := fas.FirstAccessible(files, &bob)
+	if err != nil || file.ID != files[1].ID {
+		t.Fatalf("FirstAccessible(bob) = %v, %v; want bob's record", file, err)
+	}
+	file, err = fas.FirstAccessible(files, &alice)
+	if err != nil || file.ID != files[0].ID {
+		t.Fatalf("FirstAccessible(alice) = %v, %v; want alice's record", file, err)
+	}
+
+	infected := []models.File{{ID: primitive.NewObjectID(), OwnerID: &bob, ScanStatus: models.ScanStatusInfected}}
+	if _, err := fas.FirstAccessible(infected, &bob); !errors.Is(err, ErrFileAccessDenied) {
+		t.Fatalf("err = %v, want ErrFileAccessDenied", err)
+	}
+}
+
+func TestThumbnailIndex(t *testing.T) {
+	f := &models.File{URL: "/a.png", StorageKey: "a.png", Thumbnails: []models.Thumbnail{{URL: "/a_s.png", Key: "a_s.png"}, {URL: "/a_m.png", Key: "a_m.png"}}}
+	for ref, want := range map[string]int{"/a.png": -1, "a.png": -1, "/a_m.png": 1, "a_s.png": 0, "other": -1} {
+		if got := ThumbnailIndex(f, ref); got != want {
+			t.Errorf("ThumbnailIndex(%q) = %d, want %d", ref, got, want)
+		}
+	}
+}
@@ -2,14 +2,26 @@ package services
 
 import (
 	"chat-app-backend/config"
+	"chat-app-backend/media"
 	"chat-app-backend/models"
+	"chat-app-backend/scanner"
 	"chat-app-backend/storage"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,10 +29,34 @@ import (
 
 type FileService struct {
 	Provider storage.Provider
+	Quota    *StorageQuotaService
+	// Scanner quét mã độc sau khi upload (nil = không quét, file sạch ngay)
+	Scanner scanner.Scanner
+	// Policy: allowlist MIME theo loại file và quy tắc phần mở rộng (UPLOAD_ALLOWED_*)
+	Policy *UploadPolicy
+	// OnScanComplete được gọi khi quét xong các file cùng nội dung (gán trong main để nhả tin nhắn đang bị giữ)
+	OnScanComplete func(files []models.File)
 }
 
+var (
+	ErrFileInfected   = errors.New("File contains malware and was blocked")
+	ErrFileScanFailed = errors.New("File could not be scanned for malware")
+	// ErrFileTooLargeToScan: file lớn hơn giới hạn của scanner, không bao giờ quét được nên từ chối ngay
+	ErrFileTooLargeToScan = errors.New("File is too large to be scanned for malware")
+)
+
+const (
+	// Số lần thử quét ngay sau upload khi scanner lỗi (không kết nối được...) trước khi chuyển sang quét lại định kỳ
+	scanAttempts = 4
+	// Quét lại định kỳ: khoảng cách giữa các lần, số lần tối đa trước khi đánh dấu ScanStatusError (~12 giờ)
+	scanRetryInterval = 15 * time.Minute
+	maxScanRetries    = 48
+	// Blob chờ quét quá lâu mà không có lịch quét lại (server khởi động lại giữa chừng) cũng được quét lại
+	scanStaleAfter = time.Hour
+)
+
 func NewFileService(provider storage.Provider) *FileService {
-	return &FileService{Provider: provider}
+	return &FileService{Provider: provider, Quota: NewStorageQuotaService(), Policy: NewUploadPolicyFromEnv()}
 }
 
 // Singleton default provider/service for convenience in controllers
@@ -37,7 +73,13 @@ func GetDefaultFileService() (*FileService, error) {
 		if err != nil {
 			return
 		}
+		var sc scanner.Scanner
+		sc, err = scanner.NewScannerFromEnv()
+		if err != nil {
+			return
+		}
 		defaultFS = NewFileService(prov)
+		defaultFS.Scanner = sc
 	})
 	if err != nil {
 		return nil, err
@@ -45,46 +87,151 @@ func GetDefaultFileService() (*FileService, error) {
 	return defaultFS, nil
 }
 
-// SaveUpload: lưu file lên provider và tạo record trong Mongo
-func (fs *FileService) SaveUpload(file multipart.File, fh *multipart.FileHeader) (*models.File, error) {
+// Giới hạn kích thước upload một lần (multipart); file lớn hơn dùng upload chia chunk (xem UploadSessionService)
+const (
+	MaxSimpleUploadSize = 20 << 20 // 20MB
+	MaxImageUploadSize  = 20 << 20 // ảnh phải đọc hết vào bộ nhớ để bỏ metadata và tạo thumbnail
+)
+
+// SaveUpload: lưu file lên provider và tạo record trong Mongo (ownerID: người upload)
+func (fs *FileService) SaveUpload(ownerID primitive.ObjectID, file multipart.File, fh *multipart.FileHeader) (*models.File, error) {
 	defer func() {
 		// some providers (cloud) Close() inside, but ensure file closed here as a safety net
 		_ = file.Close()
 	}()
 
-	// Đọc MIME type
+	// Giới hạn kích thước (20MB)
+	if fh.Size > MaxSimpleUploadSize {
+		return nil, fmt.Errorf("file quá lớn, tối đa 20MB")
+	}
+	return fs.store(ownerID, file, fh.Filename, fh.Size, "")
+}
+
+// CheckScanSize từ chối file lớn hơn kích thước tối đa scanner quét được (không có scanner thì không giới hạn)
+func (fs *FileService) CheckScanSize(size int64) error {
+	limiter, ok := fs.Scanner.(scanner.SizeLimiter)
+	if !ok {
+		return nil
+	}
+	if max := limiter.MaxScanSize(); max > 0 && size > max {
+		return fmt.Errorf("%w: limit is %dMB", ErrFileTooLargeToScan, max>>20)
+	}
+	return nil
+}
+
+// store phân loại, xử lý (audio/ảnh) và upload file lên provider rồi tạo record; file được đọc từ đầu.
+// Nội dung đã có trên storage (cùng SHA-256) thì chỉ tạo bản ghi mới trỏ tới object cũ.
+// checksum: SHA-256 (hex) đã kiểm tra trước đó, rỗng thì tự tính.
+func (fs *FileService) store(ownerID primitive.ObjectID, file multipart.File, filename string, size int64, checksum string) (saved *models.File, err error) {
+	if checksum == "" {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return nil, fmt.Errorf("không thể đọc file: %v", err)
+		}
+		checksum = hex.EncodeToString(hash.Sum(nil))
+		if _, err := file.Seek(0, 0); err != nil {
+			return nil, fmt.Errorf("không thể reset file reader: %v", err)
+		}
+	}
+	// Loại file xác định theo nội dung (magic bytes), không theo phần mở rộng client gửi
 	buf := make([]byte, 512)
-	n, _ := file.Read(buf)
-	mime := http.DetectContentType(buf[:n])
-	_, err := file.Seek(0, 0) // reset
-	if err != nil {
+	n, _ := io.ReadFull(file, buf)
+	if _, err := file.Seek(0, 0); err != nil {
 		return nil, fmt.Errorf("không thể reset file reader: %v", err)
 	}
+	mime, ext, fileType, err := fs.Policy.Check(filename, DetectMIME(buf[:n]))
+	if err != nil {
+		return nil, err
+	}
+	if old := filepath.Ext(filename); !strings.EqualFold(old, ext) {
+		// phần mở rộng được đổi theo nội dung thật
+		filename = strings.TrimSuffix(filename, old) + ext
+	}
 
-	// Giới hạn kích thước (20MB)
-	const maxSize = 20 << 20 // 20MB
-	if fh.Size > maxSize {
-		return nil, fmt.Errorf("file quá lớn, tối đa 20MB")
+	// Quota tính theo bản ghi của từng user, kể cả khi nội dung dùng chung blob với file đã có.
+	// Giữ chỗ trước khi upload; kết thúc thì trả lại phần chênh với dung lượng đã lưu (toàn bộ nếu lỗi).
+	if err := fs.Quota.ReserveUser(ownerID, fileType, size); err != nil {
+		return nil, err
+	}
+	reserved := size
+	defer func() {
+		var used int64
+		if saved != nil {
+			used = saved.FileSize
+		}
+		fs.Quota.ReleaseUser(ownerID, fileType, reserved-used)
+	}()
+	if record, err := fs.reuseBlob(ownerID, filename, checksum); err != nil || record != nil {
+		return record, err
 	}
 
-	// Phân loại loại file
-	var fileType models.FileType
-	if strings.HasPrefix(mime, "image/") {
-		fileType = models.FileTypeImage
-	} else if strings.HasPrefix(mime, "video/") {
-		fileType = models.FileTypeVideo
-	} else if strings.HasPrefix(mime, "audio/") {
-		fileType = models.FileTypeAudio
-	} else {
-		fileType = models.FileTypeDocument
+	// Có scanner: giữ một bản sao nội dung gốc để quét ở nền sau khi trả kết quả upload
+	// (provider có thể đóng file sau khi upload)
+	var spool string
+	if fs.Scanner != nil {
+		if err := fs.CheckScanSize(size); err != nil {
+			return nil, err
+		}
+		path, err := spoolTemp(file)
+		if err != nil {
+			return nil, fmt.Errorf("không thể lưu file tạm để quét: %v", err)
+		}
+		spool = path
+		defer func() {
+			if spool != "" {
+				_ = os.Remove(spool)
+			}
+		}()
+	}
+
+	// Audio: đọc thời lượng và dạng sóng trước khi upload (định dạng không hỗ trợ thì bỏ qua)
+	var audio *media.AudioInfo
+	if fileType == models.FileTypeAudio {
+		if info, err := media.AnalyzeAudio(file); err == nil {
+			audio = info
+		} else {
+			log.Printf("[FileService] analyze audio %s: %v", filename, err)
+		}
+		if _, err := file.Seek(0, 0); err != nil {
+			return nil, fmt.Errorf("không thể reset file reader: %v", err)
+		}
 	}
 
 	// Tạo tên file duy nhất
-	ext := filepath.Ext(fh.Filename)
-	filename := primitive.NewObjectID().Hex() + ext
+	fileKey := primitive.NewObjectID().Hex()
+
+	// Ảnh: đọc kích thước, bỏ EXIF/GPS và tạo thumbnail; upload bản đã bỏ metadata thay cho file gốc
+	var upload multipart.File = file
+	var img *media.ImageInfo
+	if fileType == models.FileTypeImage {
+		if size > MaxImageUploadSize {
+			return nil, fmt.Errorf("ảnh quá lớn, tối đa %dMB", MaxImageUploadSize>>20)
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("không thể đọc file: %v", err)
+		}
+		info, err := media.ProcessImage(data)
+		switch {
+		case err == nil:
+			img = info
+			upload = storage.NewBytesFile(info.Data)
+			size = int64(len(info.Data))
+			if info.Mime != mime {
+				// ảnh phải mã hoá lại sang định dạng khác (xem media.ProcessImage)
+				mime, ext = info.Mime, ".png"
+			}
+		case errors.Is(err, media.ErrImageTooLarge):
+			return nil, fmt.Errorf("ảnh quá lớn, tối đa %d megapixel", media.MaxImagePixels/1_000_000)
+		default:
+			// định dạng ảnh không giải mã được (ví dụ BMP): giữ nguyên file
+			log.Printf("[FileService] process image %s: %v", filename, err)
+			upload = storage.NewBytesFile(data)
+		}
+	}
 
 	// Gọi provider để upload
-	uploadedURL, err := fs.Provider.Upload(file, filename)
+	uploaded, err := fs.Provider.Upload(upload, fileKey+ext)
 	if err != nil {
 		return nil, fmt.Errorf("upload failed: %v", err)
 	}
@@ -92,17 +239,700 @@ func (fs *FileService) SaveUpload(file multipart.File, fh *multipart.FileHeader)
 	// Tạo bản ghi file
 	record := &models.File{
 		ID:         primitive.NewObjectID(),
-		FileName:   fh.Filename,
+		FileName:   filename,
+		OwnerID:    &ownerID,
 		FileType:   fileType,
-		FileSize:   fh.Size,
+		FileSize:   size,
 		UploadTime: time.Now(),
-		URL:        uploadedURL,
+		URL:        uploaded.URL,
+		Provider:   fs.Provider.Name(),
+		StorageKey: uploaded.Key,
+		Mime:       mime,
+		SHA256:     checksum,
+	}
+	if spool != "" {
+		record.ScanStatus = models.ScanStatusPending
+	}
+	if audio != nil {
+		record.Duration = int32(audio.Duration.Round(time.Second) / time.Second)
+		record.Waveform = audio.Waveform
+	}
+	if img != nil {
+		record.Width, record.Height = int32(img.Width), int32(img.Height)
+		record.Thumbnails = fs.uploadThumbnails(fileKey, img.Thumbnails)
+	}
+
+	// Đăng ký blob; upload song song cùng nội dung thì bên ghi sau bỏ object vừa upload và dùng blob đã có
+	blob := models.Blob{
+		ID:        blobID(record.Provider, checksum),
+		SHA256:    checksum,
+		Provider:  record.Provider,
+		RefCount:  1,
+		Object:    blobObject(record),
+		CreatedAt: record.UploadTime,
+	}
+	if _, err := config.DB.Collection("blobs").InsertOne(context.Background(), blob); err != nil {
+		_ = fs.deleteObjects(record)
+		if mongo.IsDuplicateKeyError(err) {
+			if reused, err := fs.reuseBlob(ownerID, filename, checksum); err != nil || reused != nil {
+				return reused, err
+			}
+		}
+		return nil, fmt.Errorf("lỗi khi lưu blob: %v", err)
 	}
 
 	collection := config.DB.Collection("files")
 	if _, err := collection.InsertOne(context.Background(), record); err != nil {
+		_ = fs.releaseBlob(record)
 		return nil, fmt.Errorf("lỗi khi lưu file record: %v", err)
 	}
 
+	if spool != "" {
+		go fs.scanInBackground(record.Provider, checksum, spool)
+		spool = "" // goroutine quét sẽ xoá file tạm
+	}
 	return record, nil
 }
+
+// spoolTemp chép nội dung file ra file tạm rồi đưa file về đầu
+func spoolTemp(file multipart.File) (string, error) {
+	tmp, err := os.CreateTemp("", "scan-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		_, err = file.Seek(0, 0)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// scanInBackground quét file tạm (thử lại khi scanner lỗi) rồi cập nhật trạng thái mọi bản ghi cùng nội dung.
+// Vẫn lỗi sau scanAttempts lần thì giữ file tạm và để RetryPendingScans quét lại định kỳ.
+func (fs *FileService) scanInBackground(provider, checksum, path string) {
+	var result *scanner.Result
+	var err error
+	delay := 5 * time.Second
+	for attempt := 1; attempt <= scanAttempts; attempt++ {
+		if result, err = fs.scanFile(path); err == nil || errors.Is(err, scanner.ErrTooLarge) {
+			break
+		}
+		log.Printf("[FileScan] %s: lần %d/%d lỗi: %v", checksum, attempt, scanAttempts, err)
+		if attempt < scanAttempts {
+			time.Sleep(delay)
+			delay *= 3
+		}
+	}
+	if errors.Is(err, scanner.ErrTooLarge) {
+		// vượt giới hạn của scanner: thử lại vô ích, đánh dấu lỗi ngay để tin nhắn bị từ chối thay vì bị giữ
+		_ = os.Remove(path)
+		fs.failScan(provider, checksum, err)
+		return
+	}
+	if err != nil {
+		fs.deferScan(provider, checksum, path)
+		return
+	}
+	_ = os.Remove(path)
+	if err := fs.applyScanResult(provider, checksum, result); err != nil {
+		log.Printf("[FileScan] %s: cập nhật kết quả: %v", checksum, err)
+	}
+}
+
+// failScan đánh dấu nội dung không quét được (ScanStatusError)
+func (fs *FileService) failScan(provider, checksum string, cause error) {
+	log.Printf("[FileScan] %s: không quét được: %v", checksum, cause)
+	if err := fs.setScanStatus(provider, checksum, models.ScanStatusError, ""); err != nil {
+		log.Printf("[FileScan] %s: cập nhật trạng thái lỗi: %v", checksum, err)
+	}
+}
+
+// deferScan ghi file tạm và lần quét lại tiếp theo vào blob
+func (fs *FileService) deferScan(provider, checksum, path string) {
+	retryAt := time.Now().Add(scanRetryInterval)
+	res, err := config.DB.Collection("blobs").UpdateOne(context.Background(),
+		bson.M{"_id": blobID(provider, checksum), "object.scanStatus": models.ScanStatusPending},
+		bson.M{"$set": bson.M{"scanSpool": path, "scanRetryAt": retryAt}, "$inc": bson.M{"scanFailures": 1}})
+	if err != nil || res.MatchedCount == 0 {
+		_ = os.Remove(path)
+		if err != nil {
+			log.Printf("[FileScan] %s: lưu lịch quét lại: %v", checksum, err)
+		}
+		return
+	}
+	log.Printf("[FileScan] %s: scanner lỗi, quét lại lúc %s", checksum, retryAt.Format(time.RFC3339))
+}
+
+func (fs *FileService) scanFile(path string) (*scanner.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return fs.Scanner.Scan(context.Background(), f)
+}
+
+// StartScanRetrier định kỳ quét lại các blob còn chờ quét (scanner lỗi hoặc server khởi động lại giữa chừng)
+func (fs *FileService) StartScanRetrier(interval time.Duration) {
+	if fs.Scanner == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := fs.RetryPendingScans(); err != nil {
+				log.Printf("[FileScan] retry: %v", err)
+			}
+		}
+	}()
+}
+
+// RetryPendingScans quét lại blob đã tới hạn thử lại, hoặc chờ quét quá lâu mà không có lịch (mất goroutine quét).
+// Đọc nội dung từ file tạm nếu còn, không thì từ storage. Lỗi quá maxScanRetries lần thì chuyển sang ScanStatusError.
+func (fs *FileService) RetryPendingScans() error {
+	ctx := context.Background()
+	now := time.Now()
+	coll := config.DB.Collection("blobs")
+	cur, err := coll.Find(ctx, bson.M{
+		"object.scanStatus": models.ScanStatusPending,
+		"$or": []bson.M{
+			{"scanRetryAt": bson.M{"$lte": now}},
+			{"scanRetryAt": bson.M{"$exists": false}, "createdAt": bson.M{"$lte": now.Add(-scanStaleAfter)}},
+		},
+	}, options.Find().SetLimit(50))
+	if err != nil {
+		return err
+	}
+	var blobs []models.Blob
+	if err := cur.All(ctx, &blobs); err != nil {
+		return err
+	}
+
+	for _, blob := range blobs {
+		result, err := fs.rescanBlob(&blob)
+		if err == nil {
+			if blob.ScanSpool != "" {
+				_ = os.Remove(blob.ScanSpool)
+			}
+			_, _ = coll.UpdateOne(ctx, bson.M{"_id": blob.ID},
+				bson.M{"$unset": bson.M{"scanSpool": "", "scanRetryAt": "", "scanFailures": ""}})
+			if err := fs.applyScanResult(blob.Provider, blob.SHA256, result); err != nil {
+				log.Printf("[FileScan] %s: cập nhật kết quả: %v", blob.SHA256, err)
+			}
+			continue
+		}
+
+		failures := blob.ScanFailures + 1
+		log.Printf("[FileScan] %s: quét lại lần %d/%d lỗi: %v", blob.SHA256, failures, maxScanRetries, err)
+		if failures < maxScanRetries && !errors.Is(err, scanner.ErrTooLarge) {
+			_, _ = coll.UpdateOne(ctx, bson.M{"_id": blob.ID}, bson.M{"$set": bson.M{
+				"scanFailures": failures,
+				"scanRetryAt":  now.Add(scanRetryInterval),
+			}})
+			continue
+		}
+		if blob.ScanSpool != "" {
+			_ = os.Remove(blob.ScanSpool)
+		}
+		_, _ = coll.UpdateOne(ctx, bson.M{"_id": blob.ID},
+			bson.M{"$unset": bson.M{"scanSpool": "", "scanRetryAt": ""}, "$set": bson.M{"scanFailures": failures}})
+		fs.failScan(blob.Provider, blob.SHA256, err)
+	}
+	return nil
+}
+
+// rescanBlob quét nội dung blob: file tạm (nội dung gốc) nếu còn, không thì object trên storage
+func (fs *FileService) rescanBlob(blob *models.Blob) (*scanner.Result, error) {
+	if blob.ScanSpool != "" {
+		if _, err := os.Stat(blob.ScanSpool); err == nil {
+			return fs.scanFile(blob.ScanSpool)
+		}
+	}
+	r, err := fs.openObject(blob.Object.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return fs.Scanner.Scan(context.Background(), r)
+}
+
+// openObject đọc object trên storage: trực tiếp (local) hoặc qua presigned URL (S3)
+func (fs *FileService) openObject(key string) (io.ReadCloser, error) {
+	if key == "" {
+		return nil, errors.New("object has no storage key")
+	}
+	if opener, ok := fs.Provider.(storage.Opener); ok {
+		r, _, err := opener.Open(key)
+		return r, err
+	}
+	if presigner, ok := fs.Provider.(storage.Presigner); ok {
+		url, err := presigner.PresignGet(key, 10*time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("storage returned %s", resp.Status)
+		}
+		return resp.Body, nil
+	}
+	return nil, fmt.Errorf("provider %s cannot read objects", fs.Provider.Name())
+}
+
+// applyScanResult ghi kết quả quét cho blob và mọi bản ghi cùng nội dung.
+// File nhiễm mã độc bị xoá khỏi storage ngay; blob và bản ghi được giữ để chặn upload lại cùng nội dung.
+func (fs *FileService) applyScanResult(provider, checksum string, result *scanner.Result) error {
+	if result.Infected {
+		log.Printf("[FileScan] %s: phát hiện %s", checksum, result.Signature)
+		return fs.setScanStatus(provider, checksum, models.ScanStatusInfected, result.Signature)
+	}
+	return fs.setScanStatus(provider, checksum, models.ScanStatusClean, "")
+}
+
+// setScanStatus cập nhật trạng thái quét của blob và các bản ghi cùng nội dung rồi gọi OnScanComplete
+func (fs *FileService) setScanStatus(provider, checksum string, status models.ScanStatus, signature string) error {
+	ctx := context.Background()
+	set := bson.M{"scanStatus": status, "scannedAt": time.Now()}
+	if signature != "" {
+		set["scanSignature"] = signature
+	}
+
+	id := blobID(provider, checksum)
+	if _, err := config.DB.Collection("blobs").UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"object.scanStatus": status}}); err != nil {
+		return err
+	}
+	filter := bson.M{"provider": provider, "sha256": checksum}
+	if _, err := config.DB.Collection("files").UpdateMany(ctx, filter, bson.M{"$set": set}); err != nil {
+		return err
+	}
+
+	if status == models.ScanStatusInfected {
+		var blob models.Blob
+		if err := config.DB.Collection("blobs").FindOne(ctx, bson.M{"_id": id}).Decode(&blob); err == nil {
+			if err := fs.deleteObjects(&blob.Object); err != nil {
+				log.Printf("[FileScan] %s: xoá file nhiễm mã độc: %v", checksum, err)
+			}
+		}
+	}
+
+	if fs.OnScanComplete == nil {
+		return nil
+	}
+	cur, err := config.DB.Collection("files").Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var files []models.File
+	if err := cur.All(ctx, &files); err != nil {
+		return err
+	}
+	fs.OnScanComplete(files)
+	return nil
+}
+
+func blobID(provider, checksum string) string {
+	return provider + ":" + checksum
+}
+
+// blobObject giữ phần thông tin của record mô tả object trên storage (không gồm ID, người upload, tên file)
+func blobObject(record *models.File) models.File {
+	return models.File{
+		FileType:   record.FileType,
+		FileSize:   record.FileSize,
+		URL:        record.URL,
+		Provider:   record.Provider,
+		StorageKey: record.StorageKey,
+		SHA256:     record.SHA256,
+		Mime:       record.Mime,
+		Duration:   record.Duration,
+		Waveform:   record.Waveform,
+		Width:      record.Width,
+		Height:     record.Height,
+		Thumbnails: record.Thumbnails,
+		ScanStatus: record.ScanStatus,
+	}
+}
+
+// reuseBlob tăng refCount của blob cùng nội dung (nếu có) và tạo bản ghi File mới trỏ tới object đó; không có blob thì trả nil.
+// Dung lượng đã được giữ chỗ trong quota của user ở store.
+func (fs *FileService) reuseBlob(ownerID primitive.ObjectID, filename, checksum string) (*models.File, error) {
+	var blob models.Blob
+	err := config.DB.Collection("blobs").FindOneAndUpdate(context.Background(),
+		bson.M{"_id": blobID(fs.Provider.Name(), checksum)},
+		bson.M{"$inc": bson.M{"refCount": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&blob)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := blob.Object
+	record.ID = primitive.NewObjectID()
+	record.FileName = filename
+	record.OwnerID = &ownerID
+	record.UploadTime = time.Now()
+	switch record.ScanStatus {
+	case models.ScanStatusInfected:
+		// nội dung đã từng bị phát hiện mã độc
+		_ = fs.releaseBlob(&record)
+		return nil, ErrFileInfected
+	case models.ScanStatusError:
+		_ = fs.releaseBlob(&record)
+		return nil, ErrFileScanFailed
+	}
+	if _, err := config.DB.Collection("files").InsertOne(context.Background(), record); err != nil {
+		_ = fs.releaseBlob(&record)
+		return nil, fmt.Errorf("lỗi khi lưu file record: %v", err)
+	}
+	return &record, nil
+}
+
+// releaseBlob giảm refCount của blob mà record trỏ tới; blob không còn ai dùng thì xoá object trên storage
+func (fs *FileService) releaseBlob(record *models.File) error {
+	ctx := context.Background()
+	id := blobID(record.Provider, record.SHA256)
+	blobs := config.DB.Collection("blobs")
+	var blob models.Blob
+	err := blobs.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"refCount": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&blob)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// blob đã mất (dữ liệu cũ): xoá object như file riêng
+		return fs.deleteObjects(record)
+	}
+	if err != nil || blob.RefCount > 0 {
+		return err
+	}
+	// xoá blob trước (chỉ khi vẫn chưa ai dùng lại) rồi mới xoá object, để upload cùng nội dung
+	// chen vào giữa không trỏ tới object đã bị xoá
+	res, err := blobs.DeleteOne(ctx, bson.M{"_id": id, "refCount": bson.M{"$lte": 0}})
+	if err != nil || res.DeletedCount == 0 {
+		return err
+	}
+	obj := blob.Object
+	return fs.deleteObjects(&obj)
+}
+
+// uploadThumbnails lưu thumbnail cùng provider với ảnh gốc; lỗi thì bỏ qua thumbnail đó (client dùng ảnh gốc)
+func (fs *FileService) uploadThumbnails(fileKey string, thumbs []media.Thumbnail) []models.Thumbnail {
+	var out []models.Thumbnail
+	for _, t := range thumbs {
+		ext := ".jpg"
+		if t.Mime == "image/png" {
+			ext = ".png"
+		}
+		obj, err := fs.Provider.Upload(storage.NewBytesFile(t.Data), fmt.Sprintf("%s_thumb%d%s", fileKey, t.MaxEdge, ext))
+		if err != nil {
+			log.Printf("[FileService] upload thumbnail %s (%d): %v", fileKey, t.MaxEdge, err)
+			continue
+		}
+		out = append(out, models.Thumbnail{URL: obj.URL, Key: obj.Key, Width: int32(t.Width), Height: int32(t.Height)})
+	}
+	return out
+}
+
+// DeleteByID xoá file trên provider và bản ghi trong Mongo
+func (fs *FileService) DeleteByID(fileID primitive.ObjectID) error {
+	collection := config.DB.Collection("files")
+	var record models.File
+	if err := collection.FindOne(context.Background(), bson.M{"_id": fileID}).Decode(&record); err != nil {
+		return fmt.Errorf("không tìm thấy file: %v", err)
+	}
+	return fs.deleteRecord(&record)
+}
+
+// ReleaseMessageFiles xoá bản ghi file của các tin nhắn đã bị xoá (tin nhắn tự huỷ hết hạn) mà không còn nơi nào tham chiếu.
+// Chỉ xét bản ghi của chính người gửi; object dùng chung chỉ bị xoá khỏi storage khi hết bản ghi (deleteRecord).
+func (fs *FileService) ReleaseMessageFiles(msgs []models.Message) (int, error) {
+	filter := messageOwnedFilesFilter(msgs)
+	if filter == nil {
+		return 0, nil
+	}
+	ctx := context.Background()
+	cur, err := config.DB.Collection("files").Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var records []models.File
+	if err := cur.All(ctx, &records); err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	referenced, err := referencedFiles(ctx, records)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for i := range records {
+		if referenced[records[i].ID] {
+			continue
+		}
+		if err := fs.deleteRecord(&records[i]); err != nil {
+			log.Printf("[FileService] release %s: %v", records[i].ID.Hex(), err)
+			continue
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// messageOwnedFilesFilter lọc bản ghi file mà các tin nhắn trỏ tới (fileId, URL file hoặc đính kèm) và do chính người gửi upload.
+// Trả nil khi không tin nhắn nào có file.
+func messageOwnedFilesFilter(msgs []models.Message) bson.M {
+	var or []bson.M
+	for _, msg := range msgs {
+		var urls []string
+		if msg.URL != "" {
+			urls = append(urls, msg.URL)
+		}
+		for _, a := range msg.Attachments {
+			if a.URL != "" {
+				urls = append(urls, a.URL)
+			}
+		}
+		if msg.FileID != nil {
+			or = append(or, bson.M{"_id": *msg.FileID, "ownerId": msg.SenderID})
+		}
+		if len(urls) > 0 {
+			or = append(or, bson.M{"url": bson.M{"$in": urls}, "ownerId": msg.SenderID})
+		}
+	}
+	if len(or) == 0 {
+		return nil
+	}
+	return bson.M{"$or": or}
+}
+
+// deleteRecord xoá bản ghi; object trên storage chỉ bị xoá khi không còn bản ghi nào khác dùng chung
+func (fs *FileService) deleteRecord(record *models.File) error {
+	var err error
+	if record.SHA256 != "" {
+		err = fs.releaseBlob(record)
+	} else {
+		err = fs.deleteObjects(record)
+	}
+	if err != nil {
+		return fmt.Errorf("xoá file trên storage thất bại: %v", err)
+	}
+	res, err := config.DB.Collection("files").DeleteOne(context.Background(), bson.M{"_id": record.ID})
+	if err == nil && res.DeletedCount > 0 {
+		fs.Quota.Track(record, -1)
+	}
+	return err
+}
+
+// deleteObjects xoá file gốc và thumbnail trên storage
+func (fs *FileService) deleteObjects(record *models.File) error {
+	if err := fs.deleteObject(record.Provider, record.StorageKey, record.URL); err != nil {
+		return err
+	}
+	for _, t := range record.Thumbnails {
+		if err := fs.deleteObject(record.Provider, t.Key, t.URL); err != nil {
+			log.Printf("[FileService] delete thumbnail %s: %v", t.URL, err)
+		}
+	}
+	return nil
+}
+
+// deleteObject xoá object theo key đã lưu; bản ghi cũ chưa có key thì suy ra từ URL.
+// File nằm ở provider khác provider đang cấu hình thì không xoá được (lỗi).
+func (fs *FileService) deleteObject(provider, key, url string) error {
+	if provider != "" && provider != fs.Provider.Name() {
+		return fmt.Errorf("file stored in provider %q, current provider is %q", provider, fs.Provider.Name())
+	}
+	if key == "" {
+		key = fs.Provider.KeyFromURL(url)
+	}
+	if key == "" {
+		return nil // URL ngoài (không do server upload)
+	}
+	return fs.Provider.Delete(key)
+}
+
+// ObjectOf trả key và URL của file gốc (thumb < 0) hoặc thumbnail thứ thumb; bản ghi cũ chưa có key thì suy từ URL
+func (fs *FileService) ObjectOf(file *models.File, thumb int) (string, string, error) {
+	key, url := file.StorageKey, file.URL
+	if thumb >= 0 {
+		if thumb >= len(file.Thumbnails) {
+			return "", "", errors.New("thumbnail not found")
+		}
+		key, url = file.Thumbnails[thumb].Key, file.Thumbnails[thumb].URL
+	}
+	if file.Provider != "" && file.Provider != fs.Provider.Name() {
+		return "", url, nil
+	}
+	if key == "" {
+		key = fs.Provider.KeyFromURL(url)
+	}
+	return key, url, nil
+}
+
+// Số ngày một file phải không được dùng liên tục trước khi GC xoá (FILE_GC_DAYS)
+const DefaultFileGCDays = 7
+
+// fileRefFields là các field tham chiếu tới file; ByID: field lưu _id của file, còn lại lưu URL.
+// Thêm nơi dùng file mới thì phải thêm vào đây, nếu không GC sẽ xoá nhầm.
+var fileRefFields = []struct {
+	Collection string
+	Field      string
+	ByID       bool
+}{
+	{"messages", "fileId", true},
+	{"messages", "url", false},
+	{"messages", "attachments.url", false},
+	{"users", "avatar", false},
+	{"users", "coverPhoto", false},
+	{"channels", "avatar", false},
+	{"stickerPacks", "stickers.fileID", true},
+	{"customEmojis", "fileID", true},
+}
+
+// FileGCGracePeriod đọc FILE_GC_DAYS (số nguyên dương)
+func FileGCGracePeriod() time.Duration {
+	days := DefaultFileGCDays
+	if raw := os.Getenv("FILE_GC_DAYS"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			days = n
+		} else {
+			log.Printf("[FILE_GC_DAYS] giá trị không hợp lệ %q, dùng mặc định %d", raw, DefaultFileGCDays)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// StartGarbageCollector chạy nền, định kỳ dọn file không còn được tham chiếu
+func (fs *FileService) StartGarbageCollector(interval time.Duration) {
+	grace := FileGCGracePeriod()
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			deleted, err := fs.CollectGarbage(grace)
+			if err != nil {
+				log.Printf("[FileGC] error: %v", err)
+			}
+			if deleted > 0 {
+				log.Printf("[FileGC] deleted %d unreferenced files", deleted)
+			}
+		}
+	}()
+}
+
+// CollectGarbage quét toàn bộ file: file không còn được tham chiếu thì đánh dấu unreferencedSince,
+// được dùng lại thì bỏ đánh dấu, đã không được dùng quá grace thì xoá khỏi storage và DB.
+func (fs *FileService) CollectGarbage(grace time.Duration) (int, error) {
+	const batchSize = 200
+	ctx := context.Background()
+	coll := config.DB.Collection("files")
+
+	deleted := 0
+	lastID := primitive.NilObjectID
+	for {
+		cur, err := coll.Find(ctx,
+			bson.M{"_id": bson.M{"$gt": lastID}},
+			options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(batchSize),
+		)
+		if err != nil {
+			return deleted, err
+		}
+		var batch []models.File
+		if err := cur.All(ctx, &batch); err != nil {
+			return deleted, err
+		}
+		if len(batch) == 0 {
+			return deleted, nil
+		}
+		lastID = batch[len(batch)-1].ID
+
+		referenced, err := referencedFiles(ctx, batch)
+		if err != nil {
+			return deleted, err
+		}
+
+		now := time.Now()
+		var used, newlyUnused []primitive.ObjectID
+		for i := range batch {
+			f := &batch[i]
+			switch {
+			case referenced[f.ID]:
+				if f.UnreferencedSince != nil {
+					used = append(used, f.ID)
+				}
+			case f.UnreferencedSince == nil:
+				newlyUnused = append(newlyUnused, f.ID)
+			case now.Sub(*f.UnreferencedSince) >= grace:
+				if err := fs.deleteRecord(f); err != nil {
+					log.Printf("[FileGC] delete %s: %v", f.ID.Hex(), err)
+					continue
+				}
+				deleted++
+			}
+		}
+		if len(used) > 0 {
+			if _, err := coll.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": used}},
+				bson.M{"$unset": bson.M{"unreferencedSince": ""}}); err != nil {
+				return deleted, err
+			}
+		}
+		if len(newlyUnused) > 0 {
+			if _, err := coll.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": newlyUnused}},
+				bson.M{"$set": bson.M{"unreferencedSince": now}}); err != nil {
+				return deleted, err
+			}
+		}
+	}
+}
+
+// referencedFiles trả tập _id các file trong batch còn được tham chiếu ở fileRefFields
+func referencedFiles(ctx context.Context, files []models.File) (map[primitive.ObjectID]bool, error) {
+	ids := make([]primitive.ObjectID, 0, len(files))
+	urls := make([]string, 0, len(files))
+	byURL := make(map[string][]primitive.ObjectID, len(files))
+	for _, f := range files {
+		ids = append(ids, f.ID)
+		if f.URL != "" {
+			urls = append(urls, f.URL)
+			byURL[f.URL] = append(byURL[f.URL], f.ID)
+		}
+	}
+
+	referenced := make(map[primitive.ObjectID]bool)
+	for _, ref := range fileRefFields {
+		var values interface{} = urls
+		if ref.ByID {
+			values = ids
+		}
+		found, err := config.DB.Collection(ref.Collection).Distinct(ctx, ref.Field, bson.M{ref.Field: bson.M{"$in": values}})
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", ref.Collection, ref.Field, err)
+		}
+		for _, v := range found {
+			switch val := v.(type) {
+			case primitive.ObjectID:
+				referenced[val] = true
+			case string:
+				for _, id := range byURL[val] {
+					referenced[id] = true
+				}
+			}
+		}
+	}
+	return referenced, nil
+}
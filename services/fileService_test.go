@@ -0,0 +1,59 @@
+package services
+
+import (
+	"chat-app-backend/models"
+	"chat-app-backend/scanner"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMessageOwnedFilesFilter(t *testing.T) {
+	if f := messageOwnedFilesFilter([]models.Message{{Content: "hi"}}); f != nil {
+		t.Fatalf("filter for text messages = %v, want nil", f)
+	}
+
+	sender := primitive.NewObjectID()
+	fileID := primitive.NewObjectID()
+	msgs := []models.Message{
+		{SenderID: sender, FileID: &fileID, URL: "/uploads/a.pdf"},
+		{SenderID: sender, Attachments: []models.Attachment{{URL: "/uploads/b.png"}, {URL: ""}}},
+	}
+	or := messageOwnedFilesFilter(msgs)["$or"].([]bson.M)
+	if len(or) != 3 {
+		t.Fatalf("$or = %v, want 3 clauses", or)
+	}
+	// mọi nhánh đều giới hạn theo người gửi: không xoá bản ghi của người khác dùng chung URL
+	for _, c := range or {
+		if c["ownerId"] != sender {
+			t.Fatalf("clause %v is not scoped to the sender", c)
+		}
+	}
+	if urls := or[2]["url"].(bson.M)["$in"].([]string); len(urls) != 1 || urls[0] != "/uploads/b.png" {
+		t.Fatalf("attachment urls = %v", urls)
+	}
+}
+
+func TestCheckScanSize(t *testing.T) {
+	clamd := scanner.NewClamdScanner("localhost:3310")
+	clamd.MaxSize = 10 << 20
+
+	fs := &FileService{}
+	if err := fs.CheckScanSize(1 << 40); err != nil {
+		t.Fatalf("no scanner: err = %v", err)
+	}
+	fs.Scanner = clamd
+	if err := fs.CheckScanSize(10 << 20); err != nil {
+		t.Fatalf("at limit: err = %v", err)
+	}
+	err := fs.CheckScanSize(10<<20 + 1)
+	if !errors.Is(err, ErrFileTooLargeToScan) || !unrecoverableAssembleError(err) {
+		t.Fatalf("over limit: err = %v, want ErrFileTooLargeToScan", err)
+	}
+	clamd.MaxSize = 0
+	if err := fs.CheckScanSize(1 << 40); err != nil {
+		t.Fatalf("limit disabled: err = %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/net/html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Giới hạn khi unfurl link
+const (
+	linkPreviewTimeout      = 5 * time.Second
+	linkPreviewMaxBodyBytes = 512 << 10 // chỉ đọc tối đa 512KB đầu trang
+	linkPreviewMaxRedirects = 3
+	linkPreviewCacheTTL     = 24 * time.Hour
+)
+
+var (
+	urlPattern = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+	errLinkPreviewBlocked = errors.New("link preview: destination address is not allowed")
+)
+
+// LinkPreviewService lấy OpenGraph metadata của link (title/description/image) và cache theo URL
+type LinkPreviewService struct {
+	DB     *mongo.Database
+	Client *http.Client
+}
+
+func NewLinkPreviewService() *LinkPreviewService {
+	return &LinkPreviewService{
+		DB:     config.DB,
+		Client: newSafeHTTPClient(isDisallowedIP),
+	}
+}
+
+// newSafeHTTPClient tạo http.Client chống SSRF: chặn kết nối tới IP mà blocked trả true ngay ở bước dial
+// (áp dụng cả cho redirect và DNS rebinding), không dùng proxy từ env, timeout chặt.
+func newSafeHTTPClient(blocked func(net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 3 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || blocked(ip) {
+				return errLinkPreviewBlocked
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   3 * time.Second,
+		ResponseHeaderTimeout: 3 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   linkPreviewTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= linkPreviewMaxRedirects {
+				return errors.New("link preview: too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("link preview: unsupported redirect scheme")
+			}
+			return nil
+		},
+	}
+}
+
+// Các dải không nằm trong net.IP.IsPrivate: CGNAT 100.64.0.0/10 và NAT64 64:ff9b::/96, 64:ff9b:1::/48
+// (NAT64 chuyển tiếp tới địa chỉ IPv4 nhúng bên trong, kể cả IP nội bộ)
+var (
+	cgnatNet      = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+	nat64Net      = &net.IPNet{IP: net.ParseIP("64:ff9b::"), Mask: net.CIDRMask(96, 128)}
+	nat64LocalNet = &net.IPNet{IP: net.ParseIP("64:ff9b:1::"), Mask: net.CIDRMask(48, 128)}
+)
+
+// isDisallowedIP chặn loopback, private (RFC1918/ULA), link-local, multicast, unspecified, CGNAT, NAT64
+func isDisallowedIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		cgnatNet.Contains(ip) ||
+		nat64Net.Contains(ip) ||
+		nat64LocalNet.Contains(ip) ||
+		(ip.To4() != nil && ip.To4()[0] == 0)
+}
+
+// ExtractFirstURL trả về URL http(s) đầu tiên trong nội dung (bỏ dấu câu cuối)
+func ExtractFirstURL(content string) string {
+	raw := urlPattern.FindString(content)
+	return strings.TrimRight(raw, ".,;:!?)]}")
+}
+
+type linkPreviewCache struct {
+	URL       string             `bson:"url"`
+	Preview   models.LinkPreview `bson:"preview"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// Preview trả preview từ cache (collection linkPreviews) hoặc fetch mới
+func (lps *LinkPreviewService) Preview(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	coll := lps.DB.Collection("linkPreviews")
+
+	var cached linkPreviewCache
+	err := coll.FindOne(ctx, bson.M{"url": rawURL, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&cached)
+	if err == nil {
+		return &cached.Preview, nil
+	}
+
+	preview, err := lps.fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = coll.UpdateOne(ctx,
+		bson.M{"url": rawURL},
+		bson.M{"$set": linkPreviewCache{
+			URL:       rawURL,
+			Preview:   *preview,
+			ExpiresAt: time.Now().Add(linkPreviewCacheTTL),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return preview, fmt.Errorf("link preview: cache write failed: %v", err)
+	}
+	return preview, nil
+}
+
+func (lps *LinkPreviewService) fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("link preview: invalid url")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "WebChatLinkPreview/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := lps.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("link preview: unexpected status %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("link preview: unsupported content type %q", mediaType)
+	}
+
+	preview := parseOpenGraph(io.LimitReader(resp.Body, linkPreviewMaxBodyBytes), resp.Request.URL)
+	preview.URL = rawURL
+	if preview.Title == "" && preview.Description == "" && preview.Image == "" {
+		return nil, errors.New("link preview: no metadata found")
+	}
+	return preview, nil
+}
+
+// parseOpenGraph đọc thẻ og:* (fallback <title> và meta description) trong <head>
+func parseOpenGraph(r io.Reader, base *url.URL) *models.LinkPreview {
+	preview := &models.LinkPreview{}
+	var fallbackTitle, fallbackDesc string
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+tokens:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			break tokens
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if string(name) == "head" {
+				break tokens
+			}
+			if string(name) == "title" {
+				inTitle = false
+			}
+		case html.TextToken:
+			if inTitle && fallbackTitle == "" {
+				fallbackTitle = strings.TrimSpace(string(z.Text()))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				break tokens
+			case "title":
+				inTitle = tt == html.StartTagToken
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+				var key, content string
+				for {
+					k, v, more := z.TagAttr()
+					switch strings.ToLower(string(k)) {
+					case "property", "name":
+						key = strings.ToLower(string(v))
+					case "content":
+						content = strings.TrimSpace(string(v))
+					}
+					if !more {
+						break
+					}
+				}
+				switch key {
+				case "og:title":
+					preview.Title = content
+				case "og:description":
+					preview.Description = content
+				case "og:image", "og:image:url":
+					if preview.Image == "" {
+						preview.Image = resolveURL(base, content)
+					}
+				case "og:site_name":
+					preview.SiteName = content
+				case "description":
+					fallbackDesc = content
+				}
+			}
+		}
+	}
+
+	if preview.Title == "" {
+		preview.Title = fallbackTitle
+	}
+	if preview.Description == "" {
+		preview.Description = fallbackDesc
+	}
+	preview.Title = truncateUTF8(preview.Title, 200)
+	preview.Description = truncateUTF8(preview.Description, 500)
+	return preview
+}
+
+// resolveURL chuyển URL tương đối (og:image) thành tuyệt đối theo trang gốc, chỉ nhận http(s)
+func resolveURL(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
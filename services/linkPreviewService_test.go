@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testPreviewService dùng client chống SSRF như thật nhưng cho phép loopback để gọi được httptest server
+func testPreviewService() *LinkPreviewService {
+	return &LinkPreviewService{Client: newSafeHTTPClient(func(ip net.IP) bool {
+		return !ip.IsLoopback() && isDisallowedIP(ip)
+	})}
+}
+
+const ogPage = `<!doctype html><html><head>
+<title>Fallback title</title>
+<meta property="og:title" content=" Trang chủ ">
+<meta property="og:description" content="Mô tả trang">
+<meta property="og:image" content="/img/cover.png">
+<meta property="og:site_name" content="Example">
+</head><body><meta property="og:title" content="ignored in body"></body></html>`
+
+func TestLinkPreviewFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(ogPage))
+	})
+	mux.HandleFunc("/fallback", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><head><title>Chỉ có title</title><meta name="description" content="desc"></head></html>`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/og", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/to-private", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://10.0.0.1/", http.StatusFound)
+	})
+	mux.HandleFunc("/to-nat64", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://[64:ff9b::a9fe:a9fe]/", http.StatusFound)
+	})
+	mux.HandleFunc("/to-file", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"og:title":"x"}`))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		// thẻ og nằm sau giới hạn đọc: không được thấy
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><head><!--" + strings.Repeat("x", linkPreviewMaxBodyBytes) + "-->"))
+		_, _ = w.Write([]byte(`<meta property="og:title" content="too late"></head></html>`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	lps := testPreviewService()
+	tests := []struct {
+		path      string
+		title     string
+		wantError string
+	}{
+		{path: "/og", title: "Trang chủ"},
+		{path: "/fallback", title: "Chỉ có title"},
+		{path: "/redirect", title: "Trang chủ"},
+		{path: "/loop", wantError: "too many redirects"},
+		{path: "/to-private", wantError: errLinkPreviewBlocked.Error()},
+		{path: "/to-nat64", wantError: errLinkPreviewBlocked.Error()},
+		{path: "/to-file", wantError: "unsupported redirect scheme"},
+		{path: "/json", wantError: "unsupported content type"},
+		{path: "/missing", wantError: "unexpected status 404"},
+		{path: "/huge", wantError: "no metadata found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			preview, err := lps.fetch(context.Background(), srv.URL+tt.path)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+			if preview.Title != tt.title || preview.URL != srv.URL+tt.path {
+				t.Fatalf("preview = %+v, want title %q", preview, tt.title)
+			}
+		})
+	}
+
+	// trang OG đầy đủ: ảnh tương đối được đổi thành tuyệt đối theo trang cuối (sau redirect)
+	preview, err := lps.fetch(context.Background(), srv.URL+"/redirect")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if preview.Image != srv.URL+"/img/cover.png" || preview.Description != "Mô tả trang" || preview.SiteName != "Example" {
+		t.Fatalf("preview = %+v", preview)
+	}
+}
+
+func TestLinkPreviewBlocksLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request must not reach a loopback server")
+	}))
+	defer srv.Close()
+
+	lps := &LinkPreviewService{Client: newSafeHTTPClient(isDisallowedIP)}
+	_, err := lps.fetch(context.Background(), srv.URL)
+	if !errors.Is(err, errLinkPreviewBlocked) {
+		t.Fatalf("err = %v, want errLinkPreviewBlocked", err)
+	}
+	for _, raw := range []string{"ftp://example.com/", "http://", "javascript:alert(1)"} {
+		if _, err := lps.fetch(context.Background(), raw); err == nil {
+			t.Fatalf("fetch(%q) must fail", raw)
+		}
+	}
+}
+
+func TestIsDisallowedIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"::", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"64:ff9b::a9fe:a9fe", true}, // NAT64 → 169.254.169.254
+		{"64:ff9b::808:808", true},
+		{"64:ff9b:1::a00:1", true},
+		{"8.8.8.8", false},
+		{"100.128.0.1", false},
+		{"2001:4860:4860::8888", false},
+	}
+	for _, tt := range tests {
+		if got := isDisallowedIP(net.ParseIP(tt.ip)); got != tt.blocked {
+			t.Errorf("isDisallowedIP(%s) = %v, want %v", tt.ip, got, tt.blocked)
+		}
+	}
+}
+
+func TestExtractFirstURL(t *testing.T) {
+	tests := map[string]string{
+		"xem https://example.com/a?b=1.":      "https://example.com/a?b=1",
+		"(http://example.com/path)":           "http://example.com/path",
+		"không có link":                       "",
+		"<a href='https://x.test/y'>link</a>": "https://x.test/y",
+	}
+	for in, want := range tests {
+		if got := ExtractFirstURL(in); got != want {
+			t.Errorf("ExtractFirstURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// MediaTypeLink là loại "Link" của thư viện media (link đã unfurl), dùng cùng tham số type với các FileType
+const MediaTypeLink = "Link"
+
+// Số tin nhắn mỗi trang của thư viện media
+const (
+	MediaPageDefault = 30
+	MediaPageMax     = 100
+)
+
+// MediaItem là một ảnh/video/audio/file hoặc link trong thư viện media của kênh; một tin nhắn có thể cho nhiều item
+type MediaItem struct {
+	MessageID primitive.ObjectID  `json:"messageId"`
+	SenderID  primitive.ObjectID  `json:"senderId"`
+	Timestamp time.Time           `json:"timestamp"`
+	Type      string              `json:"type"` // FileType hoặc MediaTypeLink
+	URL       string              `json:"url"`
+	FileID    *primitive.ObjectID `json:"fileId,omitempty"`
+	FileName  string              `json:"fileName,omitempty"`
+	Mime      string              `json:"mime,omitempty"`
+	Size      int64               `json:"size,omitempty"`
+	Width     int32               `json:"width,omitempty"`
+	Height    int32               `json:"height,omitempty"`
+	Duration  int32               `json:"duration,omitempty"`
+	Thumbnail string              `json:"thumbnail,omitempty"`
+	Link      *models.LinkPreview `json:"link,omitempty"`
+}
+
+// MediaPage: NextBefore/NextBeforeID là tham số before/beforeId cho trang tiếp theo (nil = hết)
+type MediaPage struct {
+	Items        []MediaItem         `json:"items"`
+	NextBefore   *time.Time          `json:"nextBefore,omitempty"`
+	NextBeforeID *primitive.ObjectID `json:"nextBeforeId,omitempty"`
+}
+
+// Số lượt đọc tối đa mỗi trang: tin nhắn không cho item nào (sai loại, file bị chặn) không làm một request quét cả kênh
+const mediaMaxBatches = 5
+
+type MediaService struct {
+	DB                 *mongo.Database
+	ChannelService     *ChannelService
+	ChatHistoryService *ChatHistoryService
+}
+
+func NewMediaService() *MediaService {
+	return &MediaService{
+		DB:                 config.DB,
+		ChannelService:     NewChannelService(),
+		ChatHistoryService: NewChatHistoryService(),
+	}
+}
+
+// mediaMessageFilter lọc tin nhắn có item thuộc loại mediaType ("" = mọi loại).
+// Tin nhắn file cũ chỉ có fileId (chưa có attachments) luôn được lấy, loại file kiểm tra sau khi join collection files.
+func mediaMessageFilter(mediaType string) (bson.M, error) {
+	legacyFile := bson.M{"attachments.0": bson.M{"$exists": false}, "fileId": bson.M{"$ne": nil}}
+	link := []bson.M{{"linkPreview": bson.M{"$exists": true}}, {"messageType": models.MessageTypeLink}}
+	switch mediaType {
+	case "":
+		return bson.M{"$or": append([]bson.M{{"attachments.0": bson.M{"$exists": true}}, legacyFile}, link...)}, nil
+	case MediaTypeLink:
+		return bson.M{"$or": link}, nil
+	case string(models.FileTypeImage), string(models.FileTypeVideo), string(models.FileTypeAudio):
+		prefix := "^" + strings.ToLower(mediaType) + "/"
+		return bson.M{"$or": []bson.M{
+			{"attachments": bson.M{"$elemMatch": bson.M{"mime": primitive.Regex{Pattern: prefix}}}},
+			legacyFile,
+		}}, nil
+	case string(models.FileTypeDocument):
+		return bson.M{"$or": []bson.M{
+			{"attachments": bson.M{"$elemMatch": bson.M{"mime": bson.M{"$not": primitive.Regex{Pattern: "^(image|video|audio)/"}}}}},
+			legacyFile,
+		}}, nil
+	}
+	return nil, errors.New("invalid media type, expected Image, Video, Audio, Document or Link")
+}
+
+// ListChannelMedia liệt kê ảnh, video, file và link đã gửi trong kênh, mới nhất trước (viewerID đã được kiểm tra là thành viên).
+// Phân trang theo (timestamp, _id) của tin nhắn: before zero => mới nhất; beforeID (có thể nil) phân biệt các tin cùng timestamp.
+// limit (1..MediaPageMax) là số item tối thiểu mỗi trang: một tin nhắn không bị tách nên trang có thể nhiều hơn limit item;
+// sau mediaMaxBatches lượt đọc mà chưa đủ thì trả trang ngắn hơn (có thể rỗng) kèm NextBefore để đọc tiếp.
+func (ms *MediaService) ListChannelMedia(channelID, viewerID primitive.ObjectID, mediaType string, before time.Time, beforeID *primitive.ObjectID, limit int64) (*MediaPage, error) {
+	ctx := context.Background()
+	if limit <= 0 || limit > MediaPageMax {
+		limit = MediaPageDefault
+	}
+	filter, err := mediaMessageFilter(mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	// cùng điều kiện hiển thị với lịch sử chat: bỏ tin đã thu hồi, đã ẩn, hết hạn, đang chờ quét (của người khác)
+	filter["channelID"] = channelID
+	filter["recalled"] = bson.M{"$ne": true}
+	filter["hiddenBy"] = bson.M{"$ne": viewerID}
+	filter["messageType"] = bson.M{"$nin": []models.MessageType{models.MessageTypeSticker, models.MessageTypeSystem, models.MessageTypePoll}}
+	filter["$nor"] = []bson.M{
+		{"expiresAt": bson.M{"$lte": time.Now()}},
+		{"withheld": true, "senderId": bson.M{"$ne": viewerID}},
+	}
+	if clearedAt := ms.ChatHistoryService.clearedAt(channelID, viewerID); clearedAt != nil {
+		filter["timestamp"] = bson.M{"$gt": *clearedAt}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit)
+
+	page := &MediaPage{Items: []MediaItem{}}
+	for batch := 0; batch < mediaMaxBatches; batch++ {
+		if !before.IsZero() {
+			filter["$and"] = []bson.M{mediaCursorFilter(before, beforeID)}
+		}
+		cur, err := ms.DB.Collection("messages").Find(ctx, filter, opts)
+		if err != nil {
+			return nil, err
+		}
+		var msgs []models.Message
+		if err := cur.All(ctx, &msgs); err != nil {
+			return nil, err
+		}
+		byID, byURL, err := ms.messageFiles(msgs)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range msgs {
+			for _, item := range mediaItems(&msgs[i], viewerID, byID, byURL) {
+				if mediaType == "" || item.Type == mediaType {
+					page.Items = append(page.Items, item)
+				}
+			}
+			id := msgs[i].ID
+			before, beforeID = msgs[i].Timestamp, &id
+			if int64(len(page.Items)) >= limit {
+				// còn tin nhắn phía sau (trong lượt này hoặc lượt sau)
+				if i < len(msgs)-1 || int64(len(msgs)) == limit {
+					page.NextBefore, page.NextBeforeID = &before, beforeID
+				}
+				return page, nil
+			}
+		}
+		if int64(len(msgs)) < limit {
+			return page, nil // hết tin nhắn
+		}
+	}
+	page.NextBefore, page.NextBeforeID = &before, beforeID
+	return page, nil
+}
+
+// mediaCursorFilter lọc tin nhắn đứng sau (timestamp, _id) theo thứ tự mới nhất trước
+func mediaCursorFilter(before time.Time, beforeID *primitive.ObjectID) bson.M {
+	if beforeID == nil {
+		return bson.M{"timestamp": bson.M{"$lt": before}}
+	}
+	return bson.M{"$or": []bson.M{
+		{"timestamp": bson.M{"$lt": before}},
+		{"timestamp": before, "_id": bson.M{"$lt": *beforeID}},
+	}}
+}
+
+// messageFiles lấy bản ghi File của các file trong tin nhắn (theo fileId và URL đính kèm)
+func (ms *MediaService) messageFiles(msgs []models.Message) (map[primitive.ObjectID]*models.File, map[string][]*models.File, error) {
+	ids := []primitive.ObjectID{}
+	urls := []string{}
+	for _, msg := range msgs {
+		if msg.FileID != nil {
+			ids = append(ids, *msg.FileID)
+		}
+		for _, a := range msg.Attachments {
+			urls = append(urls, a.URL)
+		}
+	}
+	byID := make(map[primitive.ObjectID]*models.File)
+	byURL := make(map[string][]*models.File) // nhiều người upload cùng nội dung dùng chung URL
+	if len(ids) == 0 && len(urls) == 0 {
+		return byID, byURL, nil
+	}
+
+	cur, err := ms.DB.Collection("files").Find(context.Background(), bson.M{"$or": []bson.M{
+		{"_id": bson.M{"$in": ids}},
+		{"url": bson.M{"$in": urls}},
+	}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []models.File
+	if err := cur.All(context.Background(), &files); err != nil {
+		return nil, nil, err
+	}
+	for i := range files {
+		byID[files[i].ID] = &files[i]
+		byURL[files[i].URL] = append(byURL[files[i].URL], &files[i])
+	}
+	return byID, byURL, nil
+}
+
+// mediaItems tách tin nhắn thành các item: mỗi file đính kèm một item, link preview một item.
+// Metadata lấy từ bản ghi file của người gửi; đính kèm không khớp file nào (dữ liệu cũ, URL tuỳ ý) thì bỏ qua.
+// File nhiễm mã độc bị ẩn; file đang chờ quét hoặc quét lỗi chỉ người upload thấy.
+func mediaItems(msg *models.Message, viewerID primitive.ObjectID, byID map[primitive.ObjectID]*models.File, byURL map[string][]*models.File) []MediaItem {
+	var items []MediaItem
+	base := MediaItem{MessageID: msg.ID, SenderID: msg.SenderID, Timestamp: msg.Timestamp}
+
+	if msg.LinkPreview != nil {
+		item := base
+		item.Type, item.URL, item.Link = MediaTypeLink, msg.LinkPreview.URL, msg.LinkPreview
+		items = append(items, item)
+	} else if msg.MessageType == models.MessageTypeLink && msg.Content != "" {
+		item := base
+		item.Type, item.URL = MediaTypeLink, msg.Content
+		items = append(items, item)
+	}
+
+	urls := make([]string, 0, len(msg.Attachments)+1)
+	for _, a := range msg.Attachments {
+		urls = append(urls, a.URL)
+	}
+	if len(urls) == 0 && msg.FileID != nil {
+		// tin nhắn cũ chưa có attachments: dựng từ bản ghi file
+		urls = append(urls, msg.URL)
+	}
+	for _, u := range urls {
+		file := senderFile(byURL[u], msg.SenderID)
+		if file == nil && msg.FileID != nil && u == msg.URL {
+			file = senderFile([]*models.File{byID[*msg.FileID]}, msg.SenderID)
+		}
+		if file == nil {
+			continue
+		}
+		switch file.ScanStatus {
+		case models.ScanStatusInfected:
+			continue
+		case models.ScanStatusPending, models.ScanStatusError:
+			if file.OwnerID == nil || *file.OwnerID != viewerID {
+				continue
+			}
+		}
+		a := fileAttachment(file)
+		id := file.ID
+		item := base
+		item.Type, item.URL, item.FileID, item.FileName = string(file.FileType), a.URL, &id, file.FileName
+		item.Mime, item.Size = a.Mime, a.Size
+		item.Width, item.Height, item.Duration, item.Thumbnail = a.Width, a.Height, a.Duration, a.Thumbnail
+		items = append(items, item)
+	}
+	return items
+}
+
+// senderFile chọn trong các bản ghi dùng chung một URL bản ghi của người gửi, không có thì bản ghi cũ chưa có ownerId
+func senderFile(files []*models.File, senderID primitive.ObjectID) *models.File {
+	var legacy *models.File
+	for _, f := range files {
+		switch {
+		case f == nil:
+		case f.OwnerID != nil && *f.OwnerID == senderID:
+			return f
+		case f.OwnerID == nil && legacy == nil:
+			legacy = f
+		}
+	}
+	return legacy
+}
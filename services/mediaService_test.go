@@ -0,0 +1,122 @@
+package services
+
+import (
+	"chat-app-backend/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMediaItemsUsesOwnedFileRecords(t *testing.T) {
+	sender, viewer := primitive.NewObjectID(), primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	file := func(url string, owner *primitive.ObjectID, status models.ScanStatus) *models.File {
+		return &models.File{
+			ID: primitive.NewObjectID(), URL: url, OwnerID: owner, FileName: url[1:], FileType: models.FileTypeImage,
+			Mime: "image/png", FileSize: 100, Width: 10, Height: 20, ScanStatus: status,
+		}
+	}
+	files := []*models.File{
+		file("/clean.png", &sender, models.ScanStatusClean),
+		file("/infected.png", &sender, models.ScanStatusInfected),
+		file("/pending.png", &sender, models.ScanStatusPending),
+		file("/error.png", &sender, models.ScanStatusError),
+		file("/someone-else.png", &other, models.ScanStatusClean),
+		file("/legacy.png", nil, ""),
+	}
+	byID := make(map[primitive.ObjectID]*models.File)
+	byURL := make(map[string][]*models.File)
+	for _, f := range files {
+		byID[f.ID], byURL[f.URL] = f, []*models.File{f}
+	}
+
+	msg := &models.Message{ID: primitive.NewObjectID(), SenderID: sender, MessageType: models.MessageTypeFile}
+	for _, u := range []string{"/clean.png", "/infected.png", "/pending.png", "/error.png", "/someone-else.png", "/legacy.png", "https://evil.test/x.png"} {
+		// metadata client gửi lên không được dùng
+		msg.Attachments = append(msg.Attachments, models.Attachment{URL: u, Mime: "video/mp4", Size: 1 << 40})
+	}
+
+	urls := func(items []MediaItem) []string {
+		var out []string
+		for _, it := range items {
+			if it.Mime != "image/png" || it.Size != 100 || it.Type != string(models.FileTypeImage) || it.FileID == nil {
+				t.Fatalf("item %s does not use file record metadata: %+v", it.URL, it)
+			}
+			out = append(out, it.URL)
+		}
+		return out
+	}
+
+	got := urls(mediaItems(msg, viewer, byID, byURL))
+	want := []string{"/clean.png", "/legacy.png"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("viewer items = %v, want %v", got, want)
+	}
+
+	// người upload vẫn thấy file đang chờ quét / quét lỗi của mình
+	got = urls(mediaItems(msg, sender, byID, byURL))
+	want = []string{"/clean.png", "/pending.png", "/error.png", "/legacy.png"}
+	if len(got) != len(want) {
+		t.Fatalf("sender items = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sender items = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMediaItemsLegacyFileMessage(t *testing.T) {
+	sender := primitive.NewObjectID()
+	f := &models.File{ID: primitive.NewObjectID(), URL: "/a.pdf", OwnerID: &sender, FileType: models.FileTypeDocument, Mime: "application/pdf"}
+	msg := &models.Message{ID: primitive.NewObjectID(), SenderID: sender, MessageType: models.MessageTypeFile, URL: f.URL, FileID: &f.ID}
+
+	items := mediaItems(msg, sender, map[primitive.ObjectID]*models.File{f.ID: f}, map[string][]*models.File{})
+	if len(items) != 1 || items[0].Type != string(models.FileTypeDocument) || *items[0].FileID != f.ID {
+		t.Fatalf("items = %+v", items)
+	}
+}
+
+func TestMediaItemsSharedBlob(t *testing.T) {
+	// hai người upload cùng nội dung: hai bản ghi dùng chung một URL
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+	const url = "/uploads/shared.png"
+	aliceFile := &models.File{ID: primitive.NewObjectID(), URL: url, OwnerID: &alice, FileType: models.FileTypeImage, ScanStatus: models.ScanStatusClean}
+	bobFile := &models.File{ID: primitive.NewObjectID(), URL: url, OwnerID: &bob, FileType: models.FileTypeImage, ScanStatus: models.ScanStatusClean}
+	byURL := map[string][]*models.File{url: {aliceFile, bobFile}}
+
+	for _, tt := range []struct {
+		sender primitive.ObjectID
+		want   *models.File
+	}{{alice, aliceFile}, {bob, bobFile}} {
+		msg := &models.Message{ID: primitive.NewObjectID(), SenderID: tt.sender, Attachments: []models.Attachment{{URL: url}}}
+		items := mediaItems(msg, primitive.NewObjectID(), nil, byURL)
+		if len(items) != 1 || *items[0].FileID != tt.want.ID {
+			t.Fatalf("sender %s: items = %+v, want file %s", tt.sender.Hex(), items, tt.want.ID.Hex())
+		}
+	}
+
+	// người thứ ba dán URL vào tin nhắn của mình: không khớp bản ghi nào
+	msg := &models.Message{ID: primitive.NewObjectID(), SenderID: primitive.NewObjectID(), Attachments: []models.Attachment{{URL: url}}}
+	if items := mediaItems(msg, msg.SenderID, nil, byURL); len(items) != 0 {
+		t.Fatalf("items = %+v, want none", items)
+	}
+}
+
+func TestMediaCursorFilter(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got := mediaCursorFilter(ts, nil); got["timestamp"].(bson.M)["$lt"] != ts {
+		t.Fatalf("filter without id = %v", got)
+	}
+
+	id := primitive.NewObjectID()
+	or, ok := mediaCursorFilter(ts, &id)["$or"].([]bson.M)
+	if !ok || len(or) != 2 {
+		t.Fatalf("filter with id = %v", or)
+	}
+	if or[1]["timestamp"] != ts || or[1]["_id"].(bson.M)["$lt"] != id {
+		t.Fatalf("same-timestamp branch = %v", or[1])
+	}
+}
@@ -2,14 +2,20 @@ package services
 
 import (
 	"chat-app-backend/config"
+	"chat-app-backend/interfaces"
 	"chat-app-backend/models"
+	"chat-app-backend/search"
 	"context"
 	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
+	"os"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -18,6 +24,12 @@ type MessageService struct {
 	ChannelService     *ChannelService
 	UserChannelService *UserChannelService
 	ChatHistoryService *ChatHistoryService
+	LinkPreviewService *LinkPreviewService
+	StickerService     *StickerService
+	QuotaService       *StorageQuotaService
+	SearchIndex        search.SearchIndex
+	// Notifier dùng để báo "draft_updated" cho người gửi (gán trong main, có thể nil)
+	Notifier interfaces.WebRTCNotifier
 }
 
 func NewMessageService() *MessageService {
@@ -26,6 +38,10 @@ func NewMessageService() *MessageService {
 		ChannelService:     NewChannelService(),
 		UserChannelService: NewUserChannelService(),
 		ChatHistoryService: NewChatHistoryService(),
+		LinkPreviewService: NewLinkPreviewService(),
+		StickerService:     NewStickerService(),
+		QuotaService:       NewStorageQuotaService(),
+		SearchIndex:        GetDefaultSearchIndex(),
 	}
 }
 
@@ -48,26 +64,37 @@ func (ms *MessageService) SendMessage(
 	if !ms.ChannelService.IsMember(channel, senderID) {
 		return nil, errors.New("Sender is not a member of the channel")
 	}
+	// Tin nhắn hệ thống chỉ do server sinh ra
+	if messageType == models.MessageTypeSystem {
+		return nil, errors.New("System messages cannot be sent by clients")
+	}
+	if messageType == models.MessageTypePoll {
+		return nil, errors.New("Use the poll API to create polls")
+	}
+
+	attachments, err = ms.enrichAttachments(senderID, attachments)
+	if err != nil {
+		return nil, err
+	}
 
 	var message *models.Message
 	now := time.Now()
-	// recall window 2 phút (như hiện tại)
-	recallDeadline := now.Add(DefaultRecallWindow)
+	// recall window theo cài đặt kênh (mặc định cấu hình ở server)
+	recallDeadline := now.Add(ms.ChannelService.RecallWindow(channel))
 	switch messageType {
 	case models.MessageTypeFile, models.MessageTypeVoice:
-		// Tạo file và lưu vào collection files
-		file := &models.File{
-			ID:         primitive.NewObjectID(),
-			FileName:   content,                 // giả định `content` là tên tệp
-			FileType:   models.FileTypeDocument, // Loại file mặc định
-			FileSize:   0,                       // Giá trị giả định, cần bổ sung logic để lấy kích thước file
-			UploadTime: time.Now(),
-			URL:        content, // giả định `content` là URL file
-		}
-		_, err := ms.DB.Collection("files").InsertOne(context.Background(), file)
+		// content là ID (hoặc URL) file đã upload qua /uploads
+		file, err := ms.resolveMessageFile(senderID, content)
 		if err != nil {
 			return nil, err
 		}
+		if messageType == models.MessageTypeVoice && file.FileType != models.FileTypeAudio {
+			return nil, errors.New("Voice messages must be audio files")
+		}
+		// Metadata của tin nhắn thoại do server đo, không lấy từ client
+		if messageType == models.MessageTypeVoice || len(attachments) == 0 {
+			attachments = []models.Attachment{fileAttachment(file)}
+		}
 
 		// Tạo tin nhắn
 		message = &models.Message{
@@ -87,7 +114,11 @@ func (ms *MessageService) SendMessage(
 		}
 
 	case models.MessageTypeSticker:
-		// Tạo tin nhắn cho Voice hoặc Sticker
+		// content là ID sticker; URL lấy từ bộ sticker chứ không tin URL client gửi lên
+		sticker, err := ms.StickerService.ResolveSticker(channel, content)
+		if err != nil {
+			return nil, err
+		}
 		message = &models.Message{
 			ID:             primitive.NewObjectID(),
 			ChannelID:      channelID,
@@ -97,8 +128,9 @@ func (ms *MessageService) SendMessage(
 			SenderID:       senderID,
 			Status:         models.MessageStatusSending,
 			Recalled:       false,
-			URL:            content, // Lưu URL
+			URL:            sticker.URL,
 			FileID:         nil,
+			StickerID:      &sticker.ID,
 			ReplyTo:        replyTo,
 			RecallDeadline: &recallDeadline,
 			Attachments:    attachments,
@@ -123,10 +155,46 @@ func (ms *MessageService) SendMessage(
 		}
 	}
 
+	// Mentions: chỉ áp dụng cho tin nhắn có nội dung văn bản
+	if message.Content != "" {
+		mentions, mentionAll, err := ms.parseMentions(channel, senderID, message.Content)
+		if err != nil {
+			return nil, err
+		}
+		message.Mentions = mentions
+		message.MentionAll = mentionAll
+	}
+
+	// File đính kèm chưa quét xong: giữ tin nhắn lại (chỉ người gửi thấy) tới khi quét sạch
+	pending, err := ms.attachmentScanStatus(message)
+	if err != nil {
+		return nil, err
+	}
+	message.Withheld = pending
+
+	// Tin nhắn tự hủy theo cài đặt của kênh
+	if ttl := ms.ChannelService.MessageTTL(channel); ttl > 0 {
+		expiresAt := now.Add(ttl)
+		message.ExpiresAt = &expiresAt
+	}
+
+	// Quota kênh tính trên mọi tin nhắn có file đính kèm, theo dung lượng server đã đo (enrichAttachments)
+	if err := ms.QuotaService.ReserveChannel(channel, AttachmentsSize(message.Attachments)); err != nil {
+		return nil, err
+	}
+
+	if err := ms.persistMessage(message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// persistMessage lưu tin nhắn rồi publishMessage (tin nhắn bị giữ chờ quét file thì chỉ lưu)
+func (ms *MessageService) persistMessage(message *models.Message) error {
 	// Lưu tin nhắn vào collection "messages"
 	log.Printf("[SendMessage] Message to insert: %+v", message)
 	collection := ms.DB.Collection("messages")
-	_, err = collection.InsertOne(context.Background(), message)
+	_, err := collection.InsertOne(context.Background(), message)
 	if message.ReplyTo != nil {
 		var parent models.Message
 		if err := collection.FindOne(context.Background(), bson.M{"_id": *message.ReplyTo}).Decode(&parent); err == nil {
@@ -135,9 +203,22 @@ func (ms *MessageService) SendMessage(
 	}
 	if err != nil {
 		log.Printf("[SendMessage] Insert message error: %v", err)
-		return nil, err
+		// trả lại quota kênh đã giữ chỗ trong SendMessage
+		ms.QuotaService.ReleaseChannel(message.ChannelID, AttachmentsSize(message.Attachments))
+		return err
 	}
 	log.Printf("[SendMessage] Insert message success")
+	if message.Withheld {
+		// chưa cập nhật preview/search: làm khi tin nhắn được nhả (ReleaseWithheld)
+		return nil
+	}
+	return ms.publishMessage(message)
+}
+
+// publishMessage đưa tin nhắn đã lưu vào search index, preview hội thoại và lastActive
+func (ms *MessageService) publishMessage(message *models.Message) error {
+	channelID, senderID := message.ChannelID, message.SenderID
+	ms.indexMessage(message)
 
 	// Cập nhật lịch sử chat
 	chatHistoryCollection := ms.DB.Collection("chathistory")
@@ -145,12 +226,14 @@ func (ms *MessageService) SendMessage(
 
 	// Preview: nếu có attachments → ghi nhãn thay vì content trống
 	previewContent := message.Content
-	if len(message.Attachments) > 0 {
+	if message.MessageType == models.MessageTypePoll && message.Poll != nil {
+		previewContent = "[Bình chọn] " + message.Poll.Question
+	} else if len(message.Attachments) > 0 {
 		switch message.MessageType {
 		case models.MessageTypeFile:
 			previewContent = "[Tệp]"
 		case models.MessageTypeVoice:
-			previewContent = "[Tin nhắn thoại]"
+			previewContent = VoicePreview(message.Attachments)
 		case models.MessageTypeSticker:
 			previewContent = "Sticker"
 		default:
@@ -174,24 +257,85 @@ func (ms *MessageService) SendMessage(
 	}
 
 	opts := options.Update().SetUpsert(true)
-	_, err = chatHistoryCollection.UpdateOne(context.Background(), filter, update, opts)
+	_, err := chatHistoryCollection.UpdateOne(context.Background(), filter, update, opts)
 	if err != nil {
 		log.Printf("[SendMessage] Update chat history error: %v", err)
-		return nil, err
+		return err
 	}
 	log.Printf("[SendMessage] Update chat history success")
 
 	err = ms.ChatHistoryService.UpdateLastActive(channelID, message.Timestamp)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	err = ms.UserChannelService.UpdateLastActive(senderID, channelID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return message, nil
+	if err := ms.UserChannelService.UnarchiveOnNewMessage(channelID); err != nil {
+		log.Printf("[SendMessage] warn: unarchive channel %s: %v", channelID.Hex(), err)
+	}
+
+	// Gửi xong thì bản nháp của kênh không còn giá trị
+	cleared, err := ms.UserChannelService.ClearDraft(senderID, channelID)
+	if err != nil {
+		log.Printf("[SendMessage] warn: clear draft: %v", err)
+	} else if cleared && ms.Notifier != nil {
+		ms.Notifier.NotifyUser(senderID.Hex(), DraftPayload(channelID, nil))
+	}
+
+	// Thông báo riêng cho người được nhắc tên (mọi đường gửi: WebSocket, REST, tin nhắn vừa được nhả)
+	ms.notifyMentions(message)
+	return nil
+}
+
+// notifyMentions gửi sự kiện "mentioned" tới từng user được nhắc (hoặc cả kênh nếu @all)
+func (ms *MessageService) notifyMentions(message *models.Message) {
+	if ms.Notifier == nil || (len(message.Mentions) == 0 && !message.MentionAll) {
+		return
+	}
+
+	recipients := message.Mentions
+	if message.MentionAll {
+		channel, err := ms.ChannelService.GetChannel(message.ChannelID)
+		if err != nil {
+			log.Printf("[notifyMentions] GetChannel error: %v", err)
+			return
+		}
+		recipients = nil
+		for _, m := range channel.Members {
+			recipients = append(recipients, m.MemberID)
+		}
+	}
+
+	// người đã tắt thông báo kênh không nhận "mentioned"
+	muted, err := ms.UserChannelService.MutedUserIDs(message.ChannelID, recipients)
+	if err != nil {
+		log.Printf("[notifyMentions] MutedUserIDs error: %v", err)
+	}
+
+	var sender struct {
+		Name string `bson:"name"`
+	}
+	_ = ms.DB.Collection("users").FindOne(context.Background(), bson.M{"_id": message.SenderID}).Decode(&sender)
+
+	for _, userID := range recipients {
+		if userID == message.SenderID || muted[userID] {
+			continue
+		}
+		ms.Notifier.NotifyUser(userID.Hex(), map[string]interface{}{
+			"type":       "mentioned",
+			"channelId":  message.ChannelID.Hex(),
+			"messageId":  message.ID.Hex(),
+			"senderId":   message.SenderID.Hex(),
+			"senderName": sender.Name,
+			"content":    message.Content,
+			"mentionAll": message.MentionAll,
+			"timestamp":  message.Timestamp,
+		})
+	}
 }
 
 // Đã sửa
@@ -268,6 +412,9 @@ func (ms *MessageService) HideMessage(messageID, userID primitive.ObjectID) (pri
 	if res.MatchedCount == 0 {
 		return primitive.NilObjectID, errors.New("Message not found")
 	}
+	if err := ms.SearchIndex.HideMessage(messageID, userID); err != nil {
+		log.Printf("[HideMessage] warn: search index: %v", err)
+	}
 
 	// tìm channelID để FE biết đang ẩn trong kênh nào (phục vụ NotifyUser)
 	chID, err := ms.findChannelIDByMessage(messageID)
@@ -278,47 +425,142 @@ func (ms *MessageService) HideMessage(messageID, userID primitive.ObjectID) (pri
 	return chID, nil
 }
 
-const DefaultRecallWindow = 2 * time.Minute
+// Giới hạn reaction
+const (
+	MaxDistinctReactions  = 20 // số emoji khác nhau tối đa trên một tin nhắn
+	MaxReactionEmojiBytes = 64
+)
+
+// Cửa sổ thu hồi / chỉnh sửa mặc định; ghi đè ở server bằng env
+// MESSAGE_RECALL_WINDOW / MESSAGE_EDIT_WINDOW (ví dụ "5m", "1h") và theo kênh qua ExtraData
+const (
+	DefaultRecallWindow = 2 * time.Minute
+	DefaultEditWindow   = 15 * time.Minute
+)
+
+// ServerRecallWindow trả về cửa sổ thu hồi cấp server
+func ServerRecallWindow() time.Duration {
+	return durationFromEnv("MESSAGE_RECALL_WINDOW", DefaultRecallWindow)
+}
+
+// ServerEditWindow trả về cửa sổ chỉnh sửa cấp server
+func ServerEditWindow() time.Duration {
+	return durationFromEnv("MESSAGE_EDIT_WINDOW", DefaultEditWindow)
+}
 
-// Thu hồi message (toàn cục) — chỉ người gửi, trong khoảng thời gian cho phép
-func (ms *MessageService) RecallMessage(messageID, requesterID primitive.ObjectID, window time.Duration) (primitive.ObjectID, error) {
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Printf("[%s] giá trị không hợp lệ %q, dùng mặc định %s", key, raw, def)
+		return def
+	}
+	return d
+}
+
+// Thu hồi message (toàn cục):
+//   - người gửi: trong cửa sổ thu hồi của kênh
+//   - Leader/Deputy của nhóm: gỡ bất kỳ lúc nào (ghi nhận là moderator removal)
+//
+// Trả kèm tên người thu hồi để broadcast.
+func (ms *MessageService) RecallMessage(messageID, requesterID primitive.ObjectID) (*models.Message, string, error) {
+	coll := ms.DB.Collection("messages")
 	var msg models.Message
-	if err := ms.DB.Collection("messages").FindOne(context.Background(), bson.M{"_id": messageID}).Decode(&msg); err != nil {
-		return primitive.NilObjectID, errors.New("Message not found")
+	if err := coll.FindOne(context.Background(), bson.M{"_id": messageID}).Decode(&msg); err != nil {
+		return nil, "", errors.New("Message not found")
+	}
+	if msg.Recalled {
+		return nil, "", errors.New("Message already recalled")
 	}
-	if msg.SenderID != requesterID {
-		return primitive.NilObjectID, errors.New("Only sender can recall this message")
+	if msg.MessageType == models.MessageTypeSystem {
+		return nil, "", errors.New("System messages cannot be recalled")
 	}
-	if time.Since(msg.Timestamp) > window {
-		return primitive.NilObjectID, errors.New("Recall window has expired")
+	if msg.ChannelID == primitive.NilObjectID {
+		// dữ liệu cũ thiếu channelID: tra qua chathistory
+		chID, err := ms.findChannelIDByMessage(messageID)
+		if err != nil {
+			log.Printf("[RecallMessage] warn: cannot find channelID for message %s: %v", messageID.Hex(), err)
+			return nil, "", err
+		}
+		msg.ChannelID = chID
+	}
+
+	channel, err := ms.ChannelService.GetChannel(msg.ChannelID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	kind := models.RecallKindSelf
+	if msg.SenderID == requesterID {
+		if time.Since(msg.Timestamp) > ms.ChannelService.RecallWindow(channel) {
+			return nil, "", errors.New("Recall window has expired")
+		}
+	} else {
+		if channel.ChannelType != models.ChannelTypeGroup {
+			return nil, "", errors.New("Only sender can recall this message")
+		}
+		requesterRole := ms.ChannelService.roleOf(channel, requesterID)
+		if !ms.ChannelService.IsMember(channel, requesterID) ||
+			(requesterRole != models.RoleLeader && requesterRole != models.RoleDeputy) {
+			return nil, "", errors.New("Only sender, leader or deputy can remove this message")
+		}
+		// Deputy không được gỡ tin nhắn của Leader
+		if requesterRole == models.RoleDeputy && ms.ChannelService.roleOf(channel, msg.SenderID) == models.RoleLeader {
+			return nil, "", errors.New("Deputy cannot remove the leader's message")
+		}
+		kind = models.RecallKindModerator
 	}
 
 	// set recalled = true (không xóa nội dung để dễ audit; FE sẽ hiển thị 'đã thu hồi')
-	_, err := ms.DB.Collection("messages").UpdateOne(
+	// điều kiện recalled/senderId trong filter: hai request thu hồi cùng lúc thì chỉ một bên thành công
+	now := time.Now()
+	res, err := coll.UpdateOne(
 		context.Background(),
-		bson.M{"_id": messageID},
-		bson.M{"$set": bson.M{"recalled": true}},
+		bson.M{"_id": messageID, "recalled": bson.M{"$ne": true}, "senderId": msg.SenderID},
+		bson.M{"$set": bson.M{
+			"recalled":   true,
+			"recalledBy": requesterID,
+			"recallKind": kind,
+			"recalledAt": now,
+		}},
 	)
 	if err != nil {
-		return primitive.NilObjectID, err
+		return nil, "", err
+	}
+	if res.MatchedCount == 0 {
+		return nil, "", errors.New("Message already recalled")
+	}
+	ms.QuotaService.ReleaseChannel(msg.ChannelID, AttachmentsSize(msg.Attachments))
+	msg.Recalled = true
+	msg.RecalledBy = &requesterID
+	msg.RecallKind = kind
+	msg.RecalledAt = &now
+	if err := ms.SearchIndex.DeleteMessage(messageID); err != nil {
+		log.Printf("[RecallMessage] warn: search index: %v", err)
 	}
 
-	// Nếu message vừa thu hồi là lastMessage, cập nhật preview thành “Tin nhắn đã bị thu hồi”
-	chID, err := ms.findChannelIDByMessage(messageID)
-	if err == nil {
-		_, _ = ms.DB.Collection("chathistory").UpdateOne(
-			context.Background(),
-			bson.M{"channelID": chID, "lastMessage.id": messageID},
-			bson.M{"$set": bson.M{"lastMessage.content": "Tin nhắn đã bị thu hồi"}},
-		)
-	} else {
-		log.Printf("[RecallMessage] warn: cannot find channelID for message %s: %v", messageID.Hex(), err)
+	// Nếu message vừa thu hồi là lastMessage, cập nhật preview
+	preview := "Tin nhắn đã bị thu hồi"
+	if kind == models.RecallKindModerator {
+		preview = "Tin nhắn đã bị quản trị viên gỡ"
 	}
+	_, _ = ms.DB.Collection("chathistory").UpdateOne(
+		context.Background(),
+		bson.M{"channelID": msg.ChannelID, "lastMessage.id": messageID},
+		bson.M{"$set": bson.M{"lastMessage.content": preview}},
+	)
 
-	return chID, nil
-}
+	// tên người thu hồi cho sự kiện realtime (FE hiển thị "X đã gỡ tin nhắn")
+	var remover struct {
+		Name string `bson:"name"`
+	}
+	_ = ms.DB.Collection("users").FindOne(context.Background(), bson.M{"_id": requesterID}).Decode(&remover)
 
-const EditWindow = 15 * time.Minute
+	return &msg, remover.Name, nil
+}
 
 func (ms *MessageService) EditMessage(messageID, editorID primitive.ObjectID, newContent string) (*models.Message, error) {
 	coll := ms.DB.Collection("messages")
@@ -327,91 +569,752 @@ func (ms *MessageService) EditMessage(messageID, editorID primitive.ObjectID, ne
 		return nil, err
 	}
 
-	// chỉ cho phép owner + trong khung 15'
+	if msg.MessageType == models.MessageTypeSystem || msg.MessageType == models.MessageTypePoll {
+		return nil, fmt.Errorf("%s messages cannot be edited", msg.MessageType)
+	}
+
+	// chỉ cho phép owner + trong cửa sổ chỉnh sửa của kênh
 	if msg.SenderID != editorID {
 		return nil, errors.New("not your message")
 	}
-	if time.Since(msg.Timestamp) > EditWindow {
+	// tin nhắn đang giữ chờ quét file: sửa sẽ phát nội dung ra kênh và index trước khi quét xong
+	if msg.Withheld {
+		return nil, errors.New("message is still being scanned")
+	}
+	channel, err := ms.ChannelService.GetChannel(msg.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(msg.Timestamp) > ms.ChannelService.EditWindow(channel) {
 		return nil, errors.New("edit window expired")
 	}
 
-	now := time.Now()
-	_, err := coll.UpdateOne(context.TODO(),
-		bson.M{"_id": messageID},
-		bson.M{"$set": bson.M{
-			"content":  newContent,
-			"edited":   true,
-			"editedAt": now,
-		}},
-	)
+	// nội dung mới có thể thêm/bớt <@id>: tách lại mentions
+	mentions, mentionAll, err := ms.parseMentions(channel, editorID, newContent)
 	if err != nil {
 		return nil, err
 	}
+	set := bson.M{
+		"content":  newContent,
+		"edited":   true,
+		"editedAt": time.Now(),
+	}
+	// nội dung đổi → preview cũ không còn đúng, controller sẽ unfurl lại
+	unset := bson.M{"linkPreview": ""}
+	if len(mentions) > 0 {
+		set["mentions"] = mentions
+	} else {
+		unset["mentions"] = ""
+	}
+	if mentionAll {
+		set["mentionAll"] = true
+	} else {
+		unset["mentionAll"] = ""
+	}
+	if _, err = coll.UpdateOne(context.TODO(), bson.M{"_id": messageID}, bson.M{"$set": set, "$unset": unset}); err != nil {
+		return nil, err
+	}
 
+	previous := msg
 	if err := coll.FindOne(context.TODO(), bson.M{"_id": messageID}).Decode(&msg); err != nil {
 		return nil, err
 	}
+	ms.indexMessage(&msg)
+
+	// chỉ báo "mentioned" cho người mới được nhắc trong lần sửa này
+	added := msg
+	added.Mentions = addedMentions(previous.Mentions, msg.Mentions)
+	added.MentionAll = msg.MentionAll && !previous.MentionAll
+	ms.notifyMentions(&added)
 	return &msg, nil
 }
 
+// addedMentions trả các user có trong after mà chưa có trong before
+func addedMentions(before, after []primitive.ObjectID) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool, len(before))
+	for _, id := range before {
+		seen[id] = true
+	}
+	var added []primitive.ObjectID
+	for _, id := range after {
+		if !seen[id] {
+			added = append(added, id)
+		}
+	}
+	return added
+}
+
 func (ms *MessageService) ToggleReaction(messageID, userID primitive.ObjectID, emoji string) (*models.Message, error) {
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" || len(emoji) > MaxReactionEmojiBytes {
+		return nil, errors.New("invalid emoji")
+	}
+
 	coll := ms.DB.Collection("messages")
 	var msg models.Message
 	if err := coll.FindOne(context.TODO(), bson.M{"_id": messageID}).Decode(&msg); err != nil {
 		return nil, err
 	}
+	if msg.MessageType == models.MessageTypeSystem {
+		return nil, errors.New("System messages cannot be reacted to")
+	}
+	if msg.Recalled {
+		return nil, errors.New("Message has been recalled")
+	}
+	channel, err := ms.ChannelService.GetChannel(msg.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if !ms.ChannelService.IsMember(channel, userID) {
+		return nil, errors.New("You are not a member of the channel")
+	}
+	// Emoji tuỳ chỉnh dạng ":shortcode:" phải tồn tại (dùng chung hoặc của kênh này)
+	if shortcode, ok := CustomEmojiShortcode(emoji); ok {
+		if _, err := ms.StickerService.FindEmoji(channel.ID, shortcode); err != nil {
+			return nil, err
+		}
+	}
+
+	// Điều kiện giới hạn số emoji khác nhau nằm ngay trong filter để không bị race giữa đọc và ghi
+	filter := bson.M{
+		"_id": messageID,
+		"$or": []bson.M{
+			{"reactions.emoji": emoji},
+			{"$expr": bson.M{"$lt": bson.A{
+				bson.M{"$size": bson.M{"$ifNull": bson.A{"$reactions", bson.A{}}}},
+				MaxDistinctReactions,
+			}}},
+		},
+	}
+	res, err := coll.UpdateOne(context.TODO(), filter, reactionTogglePipeline(userID, emoji, ms.ChannelService.SingleReaction(channel)))
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, fmt.Errorf("a message can have at most %d different reactions", MaxDistinctReactions)
+	}
+
+	if err := coll.FindOne(context.TODO(), bson.M{"_id": messageID}).Decode(&msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
 
-	// tìm reaction theo emoji
-	idx := -1
-	for i, r := range msg.Reactions {
-		if r.Emoji == emoji {
-			idx = i
-			break
+// reactionTogglePipeline bật/tắt reaction của user trong một lệnh update duy nhất (pipeline),
+// nên các reaction đồng thời trên cùng tin nhắn không ghi đè nhau:
+//   - đã có (emoji, user) → bỏ user khỏi emoji đó
+//   - chưa có → thêm user vào emoji (tạo mới nếu chưa tồn tại); chế độ single thì bỏ user khỏi các emoji khác
+//   - emoji không còn ai thì xoá khỏi mảng
+func reactionTogglePipeline(userID primitive.ObjectID, emoji string, single bool) mongo.Pipeline {
+	users := bson.M{"$ifNull": bson.A{"$$r.userIDs", bson.A{}}}
+	without := bson.M{"$filter": bson.M{"input": users, "as": "u", "cond": bson.M{"$ne": bson.A{"$$u", userID}}}}
+	with := bson.M{"$concatArrays": bson.A{users, bson.A{userID}}}
+
+	var others interface{} = "$$r"
+	if single {
+		others = bson.M{"$cond": bson.A{"$_had", "$$r", bson.M{"emoji": "$$r.emoji", "userIDs": without}}}
+	}
+
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"reactions": bson.M{"$ifNull": bson.A{"$reactions", bson.A{}}},
+			"_had": bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$reactions", bson.A{}}},
+				"as":    "r",
+				"in": bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$$r.emoji", emoji}},
+					bson.M{"$in": bson.A{userID, users}},
+				}},
+			}}}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"reactions": bson.M{"$map": bson.M{
+				"input": "$reactions",
+				"as":    "r",
+				"in": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{"$$r.emoji", emoji}},
+					bson.M{"emoji": "$$r.emoji", "userIDs": bson.M{"$cond": bson.A{"$_had", without, with}}},
+					others,
+				}},
+			}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"reactions": bson.M{"$cond": bson.A{
+				bson.M{"$or": bson.A{"$_had", bson.M{"$in": bson.A{emoji, "$reactions.emoji"}}}},
+				"$reactions",
+				bson.M{"$concatArrays": bson.A{"$reactions", bson.A{bson.M{"emoji": emoji, "userIDs": bson.A{userID}}}}},
+			}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"reactions": bson.M{"$filter": bson.M{
+				"input": "$reactions",
+				"as":    "r",
+				"cond":  bson.M{"$gt": bson.A{bson.M{"$size": users}, 0}},
+			}},
+		}}},
+		{{Key: "$unset", Value: "_had"}},
+	}
+}
+
+// GetReactionUsers liệt kê người đã thả reaction (lọc theo emoji nếu có), phân trang offset/limit
+func (ms *MessageService) GetReactionUsers(messageID, viewerID primitive.ObjectID, emoji string, offset, limit int) (map[string]interface{}, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var msg models.Message
+	if err := ms.DB.Collection("messages").FindOne(context.TODO(), bson.M{"_id": messageID}).Decode(&msg); err != nil {
+		return nil, errors.New("Message not found")
+	}
+	channel, err := ms.ChannelService.GetChannel(msg.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if !ms.ChannelService.IsMember(channel, viewerID) {
+		return nil, errors.New("You are not a member of the channel")
+	}
+
+	type entry struct {
+		emoji  string
+		userID primitive.ObjectID
+	}
+	var all []entry
+	for _, r := range msg.Reactions {
+		if emoji != "" && r.Emoji != emoji {
+			continue
+		}
+		for _, uid := range r.UserIDs {
+			all = append(all, entry{emoji: r.Emoji, userID: uid})
 		}
 	}
 
-	changed := false
-	if idx == -1 {
-		// chưa có emoji này → thêm mới
-		msg.Reactions = append(msg.Reactions, models.Reaction{
-			Emoji:   emoji,
-			UserIDs: []primitive.ObjectID{userID},
+	total := len(all)
+	page := []entry{}
+	if offset < total {
+		page = all[offset:min(offset+limit, total)]
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(page))
+	for _, e := range page {
+		ids = append(ids, e.userID)
+	}
+	users, err := usersByID(ms.DB, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]map[string]interface{}, 0, len(page))
+	for _, e := range page {
+		u := users[e.userID]
+		items = append(items, map[string]interface{}{
+			"userId": e.userID.Hex(),
+			"name":   u.Name,
+			"avatar": FullAvatarURL(u.Avatar),
+			"emoji":  e.emoji,
 		})
-		changed = true
-	} else {
-		// đã có → toggle user
-		found := false
-		users := msg.Reactions[idx].UserIDs
-		for i, uid := range users {
-			if uid == userID {
-				// bỏ reaction
-				msg.Reactions[idx].UserIDs = append(users[:i], users[i+1:]...)
-				found = true
-				changed = true
-				break
+	}
+
+	result := map[string]interface{}{
+		"messageId": messageID.Hex(),
+		"emoji":     emoji,
+		"users":     items,
+		"total":     total,
+	}
+	if offset+len(page) < total {
+		result["nextOffset"] = offset + len(page)
+	}
+	return result, nil
+}
+
+// StartExpirySweeper chạy nền, định kỳ dọn các tin nhắn tự hủy đã hết hạn
+func (ms *MessageService) StartExpirySweeper(notifier interfaces.WebRTCNotifier, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := ms.SweepExpiredMessages(notifier); err != nil {
+				log.Printf("[SweepExpiredMessages] error: %v", err)
 			}
 		}
-		if !found {
-			msg.Reactions[idx].UserIDs = append(users, userID)
-			changed = true
+	}()
+}
+
+// SweepExpiredMessages xoá tin nhắn đã quá expiresAt cùng file đính kèm không còn được dùng ở nơi khác,
+// rồi broadcast "message_expired" theo từng kênh để FE gỡ khỏi UI.
+// Không dùng TTL index của Mongo vì cần cập nhật chathistory, search index và thông báo realtime.
+func (ms *MessageService) SweepExpiredMessages(notifier interfaces.WebRTCNotifier) error {
+	ctx := context.Background()
+	coll := ms.DB.Collection("messages")
+
+	cur, err := coll.Find(ctx,
+		bson.M{"expiresAt": bson.M{"$lte": time.Now()}},
+		options.Find().SetLimit(500),
+	)
+	if err != nil {
+		return err
+	}
+	var expired []models.Message
+	if err := cur.All(ctx, &expired); err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	var ids []primitive.ObjectID
+	byChannel := make(map[primitive.ObjectID][]string)
+	freed := make(map[primitive.ObjectID]int64)
+	for _, msg := range expired {
+		if err := ms.SearchIndex.DeleteMessage(msg.ID); err != nil {
+			log.Printf("[SweepExpiredMessages] warn: search index: %v", err)
 		}
-		// nếu rỗng thì xoá hẳn reaction đó
-		if len(msg.Reactions[idx].UserIDs) == 0 {
-			msg.Reactions = append(msg.Reactions[:idx], msg.Reactions[idx+1:]...)
+		ids = append(ids, msg.ID)
+		byChannel[msg.ChannelID] = append(byChannel[msg.ChannelID], msg.ID.Hex())
+		if !msg.Recalled {
+			freed[msg.ChannelID] += AttachmentsSize(msg.Attachments)
 		}
 	}
 
-	if changed {
-		if _, err := coll.UpdateOne(context.TODO(),
-			bson.M{"_id": messageID},
-			bson.M{"$set": bson.M{"reactions": msg.Reactions}},
-		); err != nil {
-			return nil, err
+	if _, err := coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return err
+	}
+	for chID, size := range freed {
+		ms.QuotaService.ReleaseChannel(chID, size)
+	}
+
+	// tin nhắn tự huỷ: xoá luôn file đính kèm thay vì chờ FileGC hết thời gian ân hạn;
+	// file còn được tin nhắn/hồ sơ khác dùng thì giữ lại
+	if fs, err := GetDefaultFileService(); err != nil {
+		log.Printf("[SweepExpiredMessages] warn: file service unavailable: %v", err)
+	} else if _, err := fs.ReleaseMessageFiles(expired); err != nil {
+		log.Printf("[SweepExpiredMessages] warn: release files: %v", err)
+	}
+
+	// Bỏ preview nếu lastMessage đã hết hạn → GetChatHistoryByUserID sẽ fallback sang tin mới nhất
+	_, _ = ms.DB.Collection("chathistory").UpdateMany(ctx,
+		bson.M{"lastMessage.id": bson.M{"$in": ids}},
+		bson.M{"$unset": bson.M{"lastMessage": ""}},
+	)
+
+	for chID, msgIDs := range byChannel {
+		notifier.BroadcastMessage(chID, map[string]interface{}{
+			"type":       "message_expired",
+			"channelId":  chID.Hex(),
+			"messageIds": msgIDs,
+		})
+	}
+	log.Printf("[SweepExpiredMessages] removed %d expired messages", len(ids))
+	return nil
+}
+
+// GenerateLinkPreview unfurl link đầu tiên trong tin nhắn văn bản và lưu preview vào message.
+// Trả về nil nếu tin nhắn không có link. Gọi bất đồng bộ sau khi gửi/sửa tin nhắn.
+func (ms *MessageService) GenerateLinkPreview(message *models.Message) (*models.LinkPreview, error) {
+	if message.MessageType != models.MessageTypeText && message.MessageType != models.MessageTypeLink {
+		return nil, nil
+	}
+	link := ExtractFirstURL(message.Content)
+	if link == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*linkPreviewTimeout)
+	defer cancel()
+	preview, err := ms.LinkPreviewService.Preview(ctx, link)
+	if preview == nil {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("[GenerateLinkPreview] warn: %v", err)
+	}
+
+	// chỉ gắn nếu nội dung chưa bị sửa sang link khác trong lúc fetch
+	res, err := ms.DB.Collection("messages").UpdateOne(ctx,
+		bson.M{"_id": message.ID, "content": message.Content, "recalled": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"linkPreview": preview}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, nil
+	}
+	message.LinkPreview = preview
+	return preview, nil
+}
+
+// Client chèn mention dưới dạng token "<@USER_ID>" hoặc "<@all>"
+var mentionPattern = regexp.MustCompile(`<@([0-9a-fA-F]{24}|all)>`)
+
+// Nhóm có nhiều hơn số thành viên này thì chỉ Leader/Deputy được dùng @all
+const MentionAllMemberThreshold = 20
+
+// parseMentions tách mentions từ nội dung, kiểm tra người được nhắc là thành viên kênh
+// và quyền dùng @all trong nhóm lớn. Bỏ qua việc tự nhắc chính mình.
+func (ms *MessageService) parseMentions(channel *models.Channel, senderID primitive.ObjectID, content string) ([]primitive.ObjectID, bool, error) {
+	var mentions []primitive.ObjectID
+	mentionAll := false
+	seen := make(map[primitive.ObjectID]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if match[1] == "all" {
+			mentionAll = true
+			continue
+		}
+		userID, err := primitive.ObjectIDFromHex(match[1])
+		if err != nil || userID == senderID || seen[userID] {
+			continue
 		}
+		if !ms.ChannelService.IsMember(channel, userID) {
+			return nil, false, fmt.Errorf("Mentioned user %s is not a member of the channel", userID.Hex())
+		}
+		seen[userID] = true
+		mentions = append(mentions, userID)
 	}
 
-	if err := coll.FindOne(context.TODO(), bson.M{"_id": messageID}).Decode(&msg); err != nil {
+	if mentionAll && channel.ChannelType == models.ChannelTypeGroup && len(channel.Members) > MentionAllMemberThreshold {
+		role := ms.ChannelService.roleOf(channel, senderID)
+		if role != models.RoleLeader && role != models.RoleDeputy {
+			return nil, false, errors.New("Only leader or deputy can mention @all in large groups")
+		}
+	}
+	return mentions, mentionAll, nil
+}
+
+// usersByID lấy tên/avatar của nhiều user trong một truy vấn; user không tồn tại thì không có trong map
+func usersByID(db *mongo.Database, ids []primitive.ObjectID) (map[primitive.ObjectID]models.User, error) {
+	users := make(map[primitive.ObjectID]models.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+	cur, err := db.Collection("users").Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"name": 1, "avatar": 1}))
+	if err != nil {
 		return nil, err
 	}
-	return &msg, nil
+	var list []models.User
+	if err := cur.All(context.Background(), &list); err != nil {
+		return nil, err
+	}
+	for _, u := range list {
+		users[u.ID] = u
+	}
+	return users, nil
+}
+
+// GetMentions liệt kê các tin nhắn gần đây nhắc tới user (trực tiếp hoặc @all)
+// trong các kênh user đang tham gia. beforeTS == zero => mới nhất; limit (1..100), mặc định 50
+func (ms *MessageService) GetMentions(userID primitive.ObjectID, beforeTS time.Time, limit int64) ([]map[string]interface{}, error) {
+	ctx := context.Background()
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	channels, err := ms.ChannelService.GetChannelsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	channelByID := make(map[primitive.ObjectID]models.Channel)
+	var channelIDs []primitive.ObjectID
+	for _, ch := range channels {
+		if !ms.ChannelService.IsMember(&ch, userID) {
+			continue
+		}
+		channelByID[ch.ID] = ch
+		channelIDs = append(channelIDs, ch.ID)
+	}
+	if len(channelIDs) == 0 {
+		return []map[string]interface{}{}, nil
+	}
+
+	cleared, err := ms.ChatHistoryService.clearedAtByChannel(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"channelID": bson.M{"$in": channelIDs},
+		"senderId":  bson.M{"$ne": userID},
+		"recalled":  bson.M{"$ne": true},
+		"hiddenBy":  bson.M{"$ne": userID},
+		"withheld":  bson.M{"$ne": true},
+		"$or": []bson.M{
+			{"mentions": userID},
+			{"mentionAll": true},
+		},
+		// bỏ tin hết hạn và tin trước mốc "xoá hội thoại" của user
+		"$nor": append([]bson.M{{"expiresAt": bson.M{"$lte": time.Now()}}}, clearedAtNor(cleared, "channelID", "timestamp")...),
+	}
+	if !beforeTS.IsZero() {
+		filter["timestamp"] = bson.M{"$lt": beforeTS}
+	}
+
+	cur, err := ms.DB.Collection("messages").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []models.Message
+	if err := cur.All(ctx, &msgs); err != nil {
+		return nil, err
+	}
+
+	senderIDs := make([]primitive.ObjectID, 0, len(msgs))
+	for _, msg := range msgs {
+		senderIDs = append(senderIDs, msg.SenderID)
+	}
+	senders, err := usersByID(ms.DB, senderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]map[string]interface{}, 0, len(msgs))
+	for _, msg := range msgs {
+		sender := senders[msg.SenderID]
+		ch := channelByID[msg.ChannelID]
+		out = append(out, map[string]interface{}{
+			"id":           msg.ID.Hex(),
+			"channelId":    msg.ChannelID.Hex(),
+			"channelName":  ch.ChannelName,
+			"channelType":  ch.ChannelType,
+			"content":      msg.Content,
+			"timestamp":    msg.Timestamp,
+			"messageType":  msg.MessageType,
+			"senderId":     msg.SenderID.Hex(),
+			"senderName":   sender.Name,
+			"senderAvatar": FullAvatarURL(sender.Avatar),
+			"mentionAll":   msg.MentionAll,
+		})
+	}
+	return out, nil
+}
+
+// resolveMessageFile tìm file người gửi đã upload qua /uploads, theo ID hoặc URL.
+// File của người khác hoặc URL không có bản ghi (kể cả file dùng chung như ảnh mặc định) đều bị từ chối.
+func (ms *MessageService) resolveMessageFile(senderID primitive.ObjectID, content string) (*models.File, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, errors.New("file is required")
+	}
+	filter := bson.M{"url": content, "ownerId": senderID}
+	if id, err := primitive.ObjectIDFromHex(content); err == nil {
+		filter = bson.M{"_id": id, "ownerId": senderID}
+	}
+	var file models.File
+	err := ms.DB.Collection("files").FindOne(context.Background(), filter).Decode(&file)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errors.New("File not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// enrichAttachments thay metadata client gửi (kích thước, thumbnail, thời lượng...) bằng dữ liệu server đo khi upload.
+// Mỗi attachment phải là file người gửi đã upload; URL khác (file của người khác, link ngoài) bị từ chối.
+func (ms *MessageService) enrichAttachments(senderID primitive.ObjectID, attachments []models.Attachment) ([]models.Attachment, error) {
+	if len(attachments) == 0 {
+		return attachments, nil
+	}
+	urls := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		urls = append(urls, a.URL)
+	}
+	// cùng nội dung (blob dùng chung) thì mỗi user có bản ghi riêng cùng URL: chỉ lấy bản ghi của người gửi
+	cur, err := ms.DB.Collection("files").Find(context.Background(), bson.M{"url": bson.M{"$in": urls}, "ownerId": senderID})
+	if err != nil {
+		return nil, err
+	}
+	var files []models.File
+	if err := cur.All(context.Background(), &files); err != nil {
+		return nil, err
+	}
+	byURL := make(map[string]*models.File, len(files))
+	for i := range files {
+		byURL[files[i].URL] = &files[i]
+	}
+	enriched := make([]models.Attachment, 0, len(attachments))
+	for _, a := range attachments {
+		f, ok := byURL[a.URL]
+		if !ok {
+			return nil, fmt.Errorf("Attachment %s is not a file you uploaded", a.URL)
+		}
+		enriched = append(enriched, fileAttachment(f))
+	}
+	return enriched, nil
+}
+
+func fileAttachment(file *models.File) models.Attachment {
+	att := models.Attachment{
+		URL:      file.URL,
+		Mime:     file.Mime,
+		Size:     file.FileSize,
+		Width:    file.Width,
+		Height:   file.Height,
+		Duration: file.Duration,
+		Waveform: file.Waveform,
+	}
+	if len(file.Thumbnails) > 0 {
+		att.Thumbnail = file.Thumbnails[0].URL
+	}
+	return att
+}
+
+// VoicePreview là nhãn tin nhắn thoại trong danh sách hội thoại, ví dụ "[Tin nhắn thoại] 0:12"
+func VoicePreview(attachments []models.Attachment) string {
+	if len(attachments) == 0 || attachments[0].Duration <= 0 {
+		return "[Tin nhắn thoại]"
+	}
+	d := attachments[0].Duration
+	if d >= 3600 {
+		return fmt.Sprintf("[Tin nhắn thoại] %d:%02d:%02d", d/3600, d/60%60, d%60)
+	}
+	return fmt.Sprintf("[Tin nhắn thoại] %d:%02d", d/60, d%60)
+}
+
+// attachmentScanStatus kiểm tra trạng thái quét của file trong tin nhắn: nhiễm mã độc → ErrFileInfected, quét lỗi → ErrFileScanFailed,
+// còn file đang chờ quét → true
+func (ms *MessageService) attachmentScanStatus(message *models.Message) (bool, error) {
+	var or []bson.M
+	if message.FileID != nil {
+		or = append(or, bson.M{"_id": *message.FileID})
+	}
+	urls := make([]string, 0, len(message.Attachments)+1)
+	if message.URL != "" {
+		urls = append(urls, message.URL)
+	}
+	for _, a := range message.Attachments {
+		urls = append(urls, a.URL)
+	}
+	if len(urls) > 0 {
+		or = append(or, bson.M{"url": bson.M{"$in": urls}})
+	}
+	if len(or) == 0 {
+		return false, nil
+	}
+
+	statuses, err := ms.DB.Collection("files").Distinct(context.Background(), "scanStatus", bson.M{
+		"$or":        or,
+		"scanStatus": bson.M{"$in": []models.ScanStatus{models.ScanStatusPending, models.ScanStatusInfected, models.ScanStatusError}},
+	})
+	if err != nil {
+		return false, err
+	}
+	pending := false
+	for _, v := range statuses {
+		switch models.ScanStatus(fmt.Sprint(v)) {
+		case models.ScanStatusInfected:
+			return false, ErrFileInfected
+		case models.ScanStatusError:
+			return false, ErrFileScanFailed
+		case models.ScanStatusPending:
+			pending = true
+		}
+	}
+	return pending, nil
+}
+
+// ReleaseWithheld chạy khi quét xong các file (FileService.OnScanComplete): tin nhắn đang bị giữ
+// mà mọi file đã sạch thì được lưu vào hội thoại và broadcast; có file nhiễm mã độc thì bị xoá và báo người gửi
+func (ms *MessageService) ReleaseWithheld(files []models.File) {
+	if len(files) == 0 {
+		return
+	}
+	ctx := context.Background()
+	ids := make([]primitive.ObjectID, 0, len(files))
+	urls := make([]string, 0, len(files))
+	for _, f := range files {
+		ids = append(ids, f.ID)
+		urls = append(urls, f.URL)
+	}
+	coll := ms.DB.Collection("messages")
+	cur, err := coll.Find(ctx, bson.M{
+		"withheld": true,
+		"$or": []bson.M{
+			{"fileId": bson.M{"$in": ids}},
+			{"url": bson.M{"$in": urls}},
+			{"attachments.url": bson.M{"$in": urls}},
+		},
+	})
+	if err != nil {
+		log.Printf("[ReleaseWithheld] find messages: %v", err)
+		return
+	}
+	var messages []models.Message
+	if err := cur.All(ctx, &messages); err != nil {
+		log.Printf("[ReleaseWithheld] decode messages: %v", err)
+		return
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		pending, err := ms.attachmentScanStatus(msg)
+		switch {
+		case errors.Is(err, ErrFileInfected), errors.Is(err, ErrFileScanFailed):
+			reason := err.Error()
+			res, err := coll.DeleteOne(ctx, bson.M{"_id": msg.ID, "withheld": true})
+			if err != nil || res.DeletedCount == 0 {
+				continue
+			}
+			ms.QuotaService.ReleaseChannel(msg.ChannelID, AttachmentsSize(msg.Attachments))
+			if ms.Notifier != nil {
+				ms.Notifier.NotifyUser(msg.SenderID.Hex(), map[string]interface{}{
+					"type":      "message_rejected",
+					"id":        msg.ID.Hex(),
+					"channelId": msg.ChannelID.Hex(),
+					"reason":    reason,
+				})
+			}
+		case err != nil:
+			log.Printf("[ReleaseWithheld] message %s: %v", msg.ID.Hex(), err)
+		case pending:
+			// còn file khác trong tin nhắn chưa quét xong
+		default:
+			res, err := coll.UpdateOne(ctx, bson.M{"_id": msg.ID, "withheld": true}, bson.M{"$unset": bson.M{"withheld": ""}})
+			if err != nil || res.ModifiedCount == 0 {
+				continue
+			}
+			msg.Withheld = false
+			if err := ms.publishMessage(msg); err != nil {
+				log.Printf("[ReleaseWithheld] publish message %s: %v", msg.ID.Hex(), err)
+			}
+			if ms.Notifier != nil {
+				ms.Notifier.BroadcastMessage(msg.ChannelID, ms.releasedMessagePayload(msg))
+			}
+		}
+	}
+}
+
+// releasedMessagePayload là sự kiện "message_new" cho tin nhắn vừa được nhả, cùng dạng với tin gửi qua WebSocket
+func (ms *MessageService) releasedMessagePayload(message *models.Message) map[string]interface{} {
+	var sender struct {
+		Name   string `bson:"name"`
+		Avatar string `bson:"avatar"`
+	}
+	_ = ms.DB.Collection("users").FindOne(context.Background(), bson.M{"_id": message.SenderID}).Decode(&sender)
+	return map[string]interface{}{
+		"type":         "message_new",
+		"id":           message.ID.Hex(),
+		"content":      message.Content,
+		"timestamp":    message.Timestamp,
+		"messageType":  message.MessageType,
+		"senderId":     message.SenderID.Hex(),
+		"senderName":   sender.Name,
+		"senderAvatar": FullAvatarURL(sender.Avatar),
+		"status":       message.Status,
+		"recalled":     message.Recalled,
+		"url":          message.URL,
+		"fileId":       message.FileID,
+		"channelId":    message.ChannelID.Hex(),
+		"replyTo":      nil,
+		"attachments":  message.Attachments,
+		"expiresAt":    message.ExpiresAt,
+		"mentions":     message.Mentions,
+		"mentionAll":   message.MentionAll,
+	}
 }
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAddedMentions(t *testing.T) {
+	a, b, c := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	tests := []struct {
+		name          string
+		before, after []primitive.ObjectID
+		want          []primitive.ObjectID
+	}{
+		{"first mention", nil, []primitive.ObjectID{a}, []primitive.ObjectID{a}},
+		{"unchanged", []primitive.ObjectID{a, b}, []primitive.ObjectID{b, a}, nil},
+		{"added one", []primitive.ObjectID{a}, []primitive.ObjectID{a, c}, []primitive.ObjectID{c}},
+		{"removed", []primitive.ObjectID{a, b}, []primitive.ObjectID{a}, nil},
+	}
+	for _, tt := range tests {
+		if got := addedMentions(tt.before, tt.after); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: addedMentions = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
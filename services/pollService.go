@@ -0,0 +1,311 @@
+package services
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Giới hạn của bình chọn
+const (
+	PollMinOptions     = 2
+	PollMaxOptions     = 10
+	PollMaxQuestionLen = 300
+	PollMaxOptionLen   = 100
+)
+
+type PollService struct {
+	DB             *mongo.Database
+	MessageService *MessageService
+}
+
+func NewPollService(ms *MessageService) *PollService {
+	return &PollService{DB: config.DB, MessageService: ms}
+}
+
+// PollInput là dữ liệu tạo bình chọn từ client
+type PollInput struct {
+	Question    string     `json:"question"`
+	Options     []string   `json:"options"`
+	MultiChoice bool       `json:"multiChoice"`
+	Anonymous   bool       `json:"anonymous"`
+	ClosesAt    *time.Time `json:"closesAt"`
+}
+
+// CreatePoll tạo tin nhắn bình chọn trong kênh
+func (ps *PollService) CreatePoll(channelID, creatorID primitive.ObjectID, input PollInput) (*models.Message, error) {
+	cs := ps.MessageService.ChannelService
+	channel, err := cs.GetChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if !cs.IsMember(channel, creatorID) {
+		return nil, errors.New("Sender is not a member of the channel")
+	}
+
+	question := strings.TrimSpace(input.Question)
+	if question == "" || utf8.RuneCountInString(question) > PollMaxQuestionLen {
+		return nil, fmt.Errorf("question is required (max %d characters)", PollMaxQuestionLen)
+	}
+	if len(input.Options) < PollMinOptions || len(input.Options) > PollMaxOptions {
+		return nil, fmt.Errorf("poll needs between %d and %d options", PollMinOptions, PollMaxOptions)
+	}
+	seen := make(map[string]bool)
+	var options []models.PollOption
+	for _, text := range input.Options {
+		text = strings.TrimSpace(text)
+		if text == "" || utf8.RuneCountInString(text) > PollMaxOptionLen {
+			return nil, fmt.Errorf("option text is required (max %d characters)", PollMaxOptionLen)
+		}
+		if seen[strings.ToLower(text)] {
+			return nil, errors.New("duplicate poll option")
+		}
+		seen[strings.ToLower(text)] = true
+		options = append(options, models.PollOption{
+			ID:     primitive.NewObjectID().Hex(),
+			Text:   text,
+			Voters: []primitive.ObjectID{},
+		})
+	}
+	now := time.Now()
+	if input.ClosesAt != nil && !input.ClosesAt.After(now) {
+		return nil, errors.New("closesAt must be in the future")
+	}
+
+	recallDeadline := now.Add(cs.RecallWindow(channel))
+	message := &models.Message{
+		ID:             primitive.NewObjectID(),
+		ChannelID:      channelID,
+		Content:        question,
+		Timestamp:      now,
+		MessageType:    models.MessageTypePoll,
+		SenderID:       creatorID,
+		Status:         models.MessageStatusSent,
+		RecallDeadline: &recallDeadline,
+		Poll: &models.Poll{
+			Question:    question,
+			Options:     options,
+			MultiChoice: input.MultiChoice,
+			Anonymous:   input.Anonymous,
+			ClosesAt:    input.ClosesAt,
+		},
+	}
+	if ttl := cs.MessageTTL(channel); ttl > 0 {
+		expiresAt := now.Add(ttl)
+		message.ExpiresAt = &expiresAt
+	}
+
+	if err := ps.MessageService.persistMessage(message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Vote bỏ phiếu. Cập nhật nguyên tử trên Mongo để các phiếu đồng thời không ghi đè nhau:
+//   - chọn một: pipeline update bỏ user khỏi mọi lựa chọn rồi thêm vào lựa chọn mới trong cùng 1 lệnh
+//   - chọn nhiều: $addToSet với arrayFilters
+func (ps *PollService) Vote(messageID, userID primitive.ObjectID, optionIDs []string) (*models.Message, error) {
+	if len(optionIDs) == 0 {
+		return nil, errors.New("optionIds required")
+	}
+	msg, err := ps.loadPollForMember(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !msg.Poll.MultiChoice && len(optionIDs) != 1 {
+		return nil, errors.New("this poll allows only one choice")
+	}
+
+	filter := ps.openPollFilter(messageID)
+	filter["poll.options.id"] = bson.M{"$all": optionIDs}
+
+	var res *mongo.UpdateResult
+	if msg.Poll.MultiChoice {
+		res, err = ps.DB.Collection("messages").UpdateOne(context.Background(),
+			filter,
+			bson.M{"$addToSet": bson.M{"poll.options.$[opt].voters": userID}},
+			options.Update().SetArrayFilters(options.ArrayFilters{
+				Filters: []interface{}{bson.M{"opt.id": bson.M{"$in": optionIDs}}},
+			}),
+		)
+	} else {
+		voters := bson.M{"$ifNull": bson.A{"$$opt.voters", bson.A{}}}
+		res, err = ps.DB.Collection("messages").UpdateOne(context.Background(),
+			filter,
+			mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{
+					"poll.options": bson.M{"$map": bson.M{
+						"input": "$poll.options",
+						"as":    "opt",
+						"in": bson.M{"$mergeObjects": bson.A{"$$opt", bson.M{
+							"voters": bson.M{"$cond": bson.A{
+								bson.M{"$eq": bson.A{"$$opt.id", optionIDs[0]}},
+								bson.M{"$setUnion": bson.A{voters, bson.A{userID}}},
+								bson.M{"$setDifference": bson.A{voters, bson.A{userID}}},
+							}},
+						}}},
+					}},
+				}}},
+			},
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("Poll is closed or option not found")
+	}
+	return ps.getPoll(messageID)
+}
+
+// Retract rút phiếu: optionID rỗng = rút khỏi mọi lựa chọn
+func (ps *PollService) Retract(messageID, userID primitive.ObjectID, optionID string) (*models.Message, error) {
+	if _, err := ps.loadPollForMember(messageID, userID); err != nil {
+		return nil, err
+	}
+
+	update := bson.M{"$pull": bson.M{"poll.options.$[].voters": userID}}
+	opts := options.Update()
+	if optionID != "" {
+		update = bson.M{"$pull": bson.M{"poll.options.$[opt].voters": userID}}
+		opts.SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"opt.id": optionID}},
+		})
+	}
+
+	res, err := ps.DB.Collection("messages").UpdateOne(context.Background(), ps.openPollFilter(messageID), update, opts)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("Poll is closed")
+	}
+	return ps.getPoll(messageID)
+}
+
+// Close đóng bình chọn: người tạo hoặc Leader/Deputy của nhóm
+func (ps *PollService) Close(messageID, userID primitive.ObjectID) (*models.Message, error) {
+	msg, err := ps.loadPollForMember(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != userID {
+		channel, err := ps.MessageService.ChannelService.GetChannel(msg.ChannelID)
+		if err != nil {
+			return nil, err
+		}
+		role := ps.MessageService.ChannelService.roleOf(channel, userID)
+		if channel.ChannelType != models.ChannelTypeGroup || (role != models.RoleLeader && role != models.RoleDeputy) {
+			return nil, errors.New("Only the creator, leader or deputy can close this poll")
+		}
+	}
+
+	now := time.Now()
+	res, err := ps.DB.Collection("messages").UpdateOne(context.Background(),
+		bson.M{"_id": messageID, "messageType": models.MessageTypePoll, "poll.closed": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"poll.closed": true, "poll.closedAt": now, "poll.closedBy": userID}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("Poll is already closed")
+	}
+	return ps.getPoll(messageID)
+}
+
+// openPollFilter: chỉ khớp bình chọn chưa đóng và chưa quá closesAt (kiểm tra ngay trong lệnh update)
+func (ps *PollService) openPollFilter(messageID primitive.ObjectID) bson.M {
+	return bson.M{
+		"_id":         messageID,
+		"messageType": models.MessageTypePoll,
+		"recalled":    bson.M{"$ne": true},
+		"poll.closed": bson.M{"$ne": true},
+		"$or": []bson.M{
+			{"poll.closesAt": bson.M{"$exists": false}},
+			{"poll.closesAt": nil},
+			{"poll.closesAt": bson.M{"$gt": time.Now()}},
+		},
+	}
+}
+
+func (ps *PollService) getPoll(messageID primitive.ObjectID) (*models.Message, error) {
+	var msg models.Message
+	if err := ps.DB.Collection("messages").FindOne(context.Background(), bson.M{"_id": messageID}).Decode(&msg); err != nil {
+		return nil, errors.New("Poll not found")
+	}
+	if msg.MessageType != models.MessageTypePoll || msg.Poll == nil {
+		return nil, errors.New("Message is not a poll")
+	}
+	return &msg, nil
+}
+
+func (ps *PollService) loadPollForMember(messageID, userID primitive.ObjectID) (*models.Message, error) {
+	msg, err := ps.getPoll(messageID)
+	if err != nil {
+		return nil, err
+	}
+	channel, err := ps.MessageService.ChannelService.GetChannel(msg.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if !ps.MessageService.ChannelService.IsMember(channel, userID) {
+		return nil, errors.New("You are not a member of the channel")
+	}
+	if msg.Recalled {
+		return nil, errors.New("Poll has been recalled")
+	}
+	return msg, nil
+}
+
+// PollView trả tally của bình chọn; ẩn danh sách người bình chọn nếu anonymous.
+// viewerID != NilObjectID thì kèm "myVotes" (không dùng cho broadcast).
+func PollView(poll *models.Poll, viewerID primitive.ObjectID) map[string]interface{} {
+	if poll == nil {
+		return nil
+	}
+	totalVoters := make(map[primitive.ObjectID]bool)
+	var myVotes []string
+	var opts []map[string]interface{}
+	for _, opt := range poll.Options {
+		item := map[string]interface{}{
+			"id":    opt.ID,
+			"text":  opt.Text,
+			"count": len(opt.Voters),
+		}
+		if !poll.Anonymous {
+			item["voters"] = opt.Voters
+		}
+		for _, v := range opt.Voters {
+			totalVoters[v] = true
+			if v == viewerID {
+				myVotes = append(myVotes, opt.ID)
+			}
+		}
+		opts = append(opts, item)
+	}
+
+	view := map[string]interface{}{
+		"question":    poll.Question,
+		"options":     opts,
+		"multiChoice": poll.MultiChoice,
+		"anonymous":   poll.Anonymous,
+		"closesAt":    poll.ClosesAt,
+		"closed":      poll.IsClosed(),
+		"closedBy":    poll.ClosedBy,
+		"totalVoters": len(totalVoters),
+	}
+	if viewerID != primitive.NilObjectID {
+		view["myVotes"] = myVotes
+	}
+	return view
+}
@@ -0,0 +1,371 @@
+package services
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"chat-app-backend/search"
+	"chat-app-backend/utils"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Giới hạn tìm kiếm
+const (
+	SearchMaxTerms      = 10
+	SearchSnippetRadius = 60 // số ký tự lấy quanh từ khớp đầu tiên
+)
+
+type SearchService struct {
+	DB                 *mongo.Database
+	ChannelService     *ChannelService
+	ChatHistoryService *ChatHistoryService
+	Index              search.SearchIndex
+}
+
+func NewSearchService() *SearchService {
+	return &SearchService{
+		DB:                 config.DB,
+		ChannelService:     NewChannelService(),
+		ChatHistoryService: NewChatHistoryService(),
+		Index:              GetDefaultSearchIndex(),
+	}
+}
+
+// Search index dùng chung cho MessageService và SearchService (chọn qua SEARCH_BACKEND)
+var (
+	defaultSearchIndex search.SearchIndex
+	searchIndexOnce    sync.Once
+)
+
+// GetDefaultSearchIndex trả index theo env; cấu hình sai thì log và dùng Mongo
+func GetDefaultSearchIndex() search.SearchIndex {
+	searchIndexOnce.Do(func() {
+		idx, err := search.NewIndexFromEnv(config.DB)
+		if err != nil {
+			log.Printf("[SearchIndex] %v, fallback to mongo", err)
+			idx = search.NewMongoIndex(config.DB)
+		}
+		defaultSearchIndex = idx
+	})
+	return defaultSearchIndex
+}
+
+// SearchParams là bộ lọc của GET /api/search/messages
+type SearchParams struct {
+	Query     string
+	ChannelID *primitive.ObjectID
+	From      *primitive.ObjectID
+	Before    *time.Time
+	After     *time.Time
+	Type      models.MessageType
+	Offset    int
+	Limit     int
+}
+
+// Highlight là đoạn khớp trong snippet, tính theo vị trí ký tự (rune), end không bao gồm
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// searchDocument tạo dữ liệu đánh index cho tin nhắn; tin hệ thống và tin đã thu hồi có Text rỗng (không index)
+func searchDocument(message *models.Message) search.Document {
+	text := message.Content
+	if message.Poll != nil {
+		parts := []string{message.Poll.Question}
+		for _, opt := range message.Poll.Options {
+			parts = append(parts, opt.Text)
+		}
+		text = strings.Join(parts, " ")
+	}
+	if message.MessageType == models.MessageTypeSystem || message.Recalled {
+		text = ""
+	}
+	return search.Document{
+		MessageID:   message.ID,
+		ChannelID:   message.ChannelID,
+		SenderID:    message.SenderID,
+		MessageType: string(message.MessageType),
+		Text:        text,
+		Timestamp:   message.Timestamp,
+		ExpiresAt:   message.ExpiresAt,
+		HiddenBy:    message.HiddenBy,
+	}
+}
+
+// indexMessage cập nhật search index sau khi gửi/sửa tin nhắn; lỗi index không làm hỏng thao tác chính
+func (ms *MessageService) indexMessage(message *models.Message) {
+	if err := ms.SearchIndex.IndexMessage(searchDocument(message)); err != nil {
+		log.Printf("[SearchIndex] warn: index message %s: %v", message.ID.Hex(), err)
+	}
+}
+
+// searchTerms tách câu tìm kiếm thành các từ đã fold (bỏ trùng, tối đa SearchMaxTerms)
+func searchTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range search.Tokenize(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		terms = append(terms, t)
+		if len(terms) == SearchMaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// SearchMessages tìm tin nhắn trong các kênh user đang là thành viên (kết quả phải chứa đủ tất cả các từ)
+func (ss *SearchService) SearchMessages(userID primitive.ObjectID, params SearchParams) (map[string]interface{}, error) {
+	ctx := context.Background()
+	if params.Limit <= 0 || params.Limit > 50 {
+		params.Limit = 20
+	}
+	if params.Offset < 0 {
+		params.Offset = 0
+	}
+
+	terms := searchTerms(params.Query)
+	if len(terms) == 0 {
+		return nil, errors.New("query is required")
+	}
+
+	channels, err := ss.ChannelService.GetChannelsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	channelByID := make(map[primitive.ObjectID]models.Channel)
+	var channelIDs []primitive.ObjectID
+	for _, ch := range channels {
+		if !ss.ChannelService.IsMember(&ch, userID) {
+			continue
+		}
+		channelByID[ch.ID] = ch
+		channelIDs = append(channelIDs, ch.ID)
+	}
+	if params.ChannelID != nil {
+		if _, ok := channelByID[*params.ChannelID]; !ok {
+			return nil, errors.New("You are not a member of the channel")
+		}
+		channelIDs = []primitive.ObjectID{*params.ChannelID}
+	}
+	if len(channelIDs) == 0 {
+		return map[string]interface{}{"results": []map[string]interface{}{}, "total": 0}, nil
+	}
+
+	// tin nhắn trước mốc "xoá hội thoại" không hiện trong kết quả, giống lịch sử chat
+	cleared, err := ss.ChatHistoryService.clearedAtByChannel(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	hits, err := ss.Index.Query(search.Query{
+		Terms:      terms,
+		ChannelIDs: channelIDs,
+		ViewerID:   userID,
+		SenderID:   params.From,
+		Type:       string(params.Type),
+		Before:     params.Before,
+		After:      params.After,
+		ClearedAt:  cleared,
+		Offset:     params.Offset,
+		Limit:      params.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Lấy nội dung từ messages; kiểm tra lại recalled/hiddenBy phòng index chưa kịp cập nhật
+	byID := make(map[primitive.ObjectID]models.Message)
+	if len(hits.IDs) > 0 {
+		cur, err := ss.DB.Collection("messages").Find(ctx, bson.M{
+			"_id":      bson.M{"$in": hits.IDs},
+			"recalled": bson.M{"$ne": true},
+			"hiddenBy": bson.M{"$ne": userID},
+			"$nor":     []bson.M{{"withheld": true, "senderId": bson.M{"$ne": userID}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var msgs []models.Message
+		if err := cur.All(ctx, &msgs); err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			byID[m.ID] = m
+		}
+	}
+
+	senderIDs := make([]primitive.ObjectID, 0, len(byID))
+	for _, m := range byID {
+		senderIDs = append(senderIDs, m.SenderID)
+	}
+	senders, err := usersByID(ss.DB, senderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]map[string]interface{}, 0, len(hits.IDs))
+	for _, id := range hits.IDs {
+		msg, ok := byID[id]
+		if !ok {
+			continue
+		}
+		sender := senders[msg.SenderID]
+
+		snippet, highlights := buildSnippet(searchDocument(&msg).Text, terms)
+
+		ch := channelByID[msg.ChannelID]
+		results = append(results, map[string]interface{}{
+			"id":           msg.ID.Hex(),
+			"channelId":    msg.ChannelID.Hex(),
+			"channelName":  ch.ChannelName,
+			"channelType":  ch.ChannelType,
+			"content":      msg.Content,
+			"snippet":      snippet,
+			"highlights":   highlights,
+			"timestamp":    msg.Timestamp,
+			"messageType":  msg.MessageType,
+			"senderId":     msg.SenderID.Hex(),
+			"senderName":   sender.Name,
+			"senderAvatar": FullAvatarURL(sender.Avatar),
+		})
+	}
+
+	result := map[string]interface{}{
+		"results": results,
+		"total":   hits.Total,
+	}
+	if int64(params.Offset+len(hits.IDs)) < hits.Total {
+		result["nextOffset"] = params.Offset + len(hits.IDs)
+	}
+	return result, nil
+}
+
+// buildSnippet cắt đoạn quanh từ khớp đầu tiên và trả vị trí các từ khớp trong đoạn đó.
+// So khớp trên bản đã fold; FoldRune giữ nguyên số ký tự nên vị trí dùng được cho chuỗi gốc.
+func buildSnippet(content string, terms []string) (string, []Highlight) {
+	orig := []rune(content)
+	folded := []rune(utils.FoldText(content))
+
+	var all []Highlight
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(folded); i++ {
+			if string(folded[i:i+len(t)]) == term {
+				all = append(all, Highlight{Start: i, End: i + len(t)})
+				i += len(t) - 1
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Start < all[j].Start })
+
+	start, width := 0, 2*SearchSnippetRadius
+	if len(all) > 0 {
+		start = max(all[0].Start-SearchSnippetRadius, 0)
+		width += all[0].End - all[0].Start
+	}
+	end := min(start+width, len(orig))
+
+	// gộp các đoạn chồng nhau và chỉ giữ đoạn nằm trong snippet
+	highlights := []Highlight{}
+	for _, h := range all {
+		if h.Start < start || h.End > end {
+			continue
+		}
+		h.Start -= start
+		h.End -= start
+		if n := len(highlights); n > 0 && h.Start <= highlights[n-1].End {
+			highlights[n-1].End = max(highlights[n-1].End, h.End)
+			continue
+		}
+		highlights = append(highlights, h)
+	}
+
+	snippet := string(orig[start:end])
+	prefix := 0
+	if start > 0 {
+		snippet = "…" + snippet
+		prefix = 1
+	}
+	if end < len(orig) {
+		snippet += "…"
+	}
+	for i := range highlights {
+		highlights[i].Start += prefix
+		highlights[i].End += prefix
+	}
+	return snippet, highlights
+}
+
+// Reindex dựng lại index cho một kênh (channelID != nil) hoặc toàn bộ tin nhắn, trả về số tin đã index
+func (ss *SearchService) Reindex(channelID *primitive.ObjectID) (int, error) {
+	// tin nhắn đang bị giữ chờ quét file được index khi nhả (ReleaseWithheld)
+	filter := bson.M{"withheld": bson.M{"$ne": true}}
+	if channelID != nil {
+		if err := ss.Index.DeleteChannel(*channelID); err != nil {
+			return 0, err
+		}
+		filter["channelID"] = *channelID
+	}
+	return ss.reindex(filter)
+}
+
+// Warmup chạy lúc khởi động: index trong bộ nhớ thì dựng lại toàn bộ,
+// index Mongo thì chỉ đánh cho tin nhắn cũ chưa có searchText (tin không có chữ được ghi searchText rỗng nên chỉ xử lý một lần).
+// Tin nhắn đang bị giữ chờ quét file được index khi nhả (ReleaseWithheld).
+func (ss *SearchService) Warmup() {
+	filter := bson.M{"withheld": bson.M{"$ne": true}}
+	if ss.Index.Persistent() {
+		filter["searchText"] = bson.M{"$exists": false}
+		filter["messageType"] = bson.M{"$ne": models.MessageTypeSystem}
+		filter["recalled"] = bson.M{"$ne": true}
+	}
+	count, err := ss.reindex(filter)
+	if err != nil {
+		log.Printf("[SearchIndex] warmup failed: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("[SearchIndex] warmup indexed %d messages", count)
+	}
+}
+
+func (ss *SearchService) reindex(filter bson.M) (int, error) {
+	ctx := context.Background()
+	cur, err := ss.DB.Collection("messages").Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	count := 0
+	for cur.Next(ctx) {
+		var msg models.Message
+		if err := cur.Decode(&msg); err != nil {
+			continue
+		}
+		doc := searchDocument(&msg)
+		if doc.Text == "" {
+			err = ss.Index.DeleteMessage(msg.ID)
+		} else {
+			err = ss.Index.IndexMessage(doc)
+			count++
+		}
+		if err != nil {
+			return count, fmt.Errorf("index message %s: %w", msg.ID.Hex(), err)
+		}
+	}
+	return count, cur.Err()
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// highlighted trả các đoạn được đánh dấu trong snippet (offset tính theo rune)
+func highlighted(snippet string, hs []Highlight) []string {
+	runes := []rune(snippet)
+	out := make([]string, 0, len(hs))
+	for _, h := range hs {
+		out = append(out, string(runes[h.Start:h.End]))
+	}
+	return out
+}
+
+func TestBuildSnippet(t *testing.T) {
+	long := strings.Repeat("a ", 100) + "Mục tiêu quý này" + strings.Repeat(" b", 100)
+	tests := []struct {
+		name       string
+		content    string
+		terms      []string
+		want       string // snippet; rỗng = không kiểm tra toàn bộ
+		prefix     bool   // snippet bắt đầu bằng "…"
+		suffix     bool   // snippet kết thúc bằng "…"
+		runes      int    // độ dài snippet (kể cả "…"); 0 = không kiểm tra
+		highlights []string
+	}{
+		{
+			name: "vietnamese diacritics", content: "Hẹn gặp ở Đà Nẵng nhé", terms: []string{"da", "nang"},
+			want: "Hẹn gặp ở Đà Nẵng nhé", highlights: []string{"Đà", "Nẵng"},
+		},
+		{
+			name: "đ folds to d", content: "đi đâu đó", terms: []string{"dau"},
+			want: "đi đâu đó", highlights: []string{"đâu"},
+		},
+		{
+			name: "overlapping terms merge", content: "xin chào các bạn", terms: []string{"chao", "hao"},
+			want: "xin chào các bạn", highlights: []string{"chào"},
+		},
+		{
+			name: "partially overlapping terms", content: "abcd", terms: []string{"ab", "bc"},
+			want: "abcd", highlights: []string{"abc"},
+		},
+		{
+			name: "repeated term", content: "an an an", terms: []string{"an"},
+			want: "an an an", highlights: []string{"an", "an", "an"},
+		},
+		{
+			name: "truncated both ends", content: long, terms: []string{"muc", "quy"},
+			prefix: true, suffix: true, runes: 1 + 2*SearchSnippetRadius + len([]rune("Mục")) + 1,
+			highlights: []string{"Mục", "quý"},
+		},
+		{
+			name: "match near start", content: "tiêu đề " + strings.Repeat("x", 300), terms: []string{"tieu"},
+			suffix: true, highlights: []string{"tiêu"},
+		},
+		{
+			name: "match near end", content: strings.Repeat("x", 300) + " cuối cùng", terms: []string{"cung"},
+			prefix: true, highlights: []string{"cùng"},
+		},
+		{
+			name: "no match", content: strings.Repeat("y", 300), terms: []string{"zzz"},
+			want: strings.Repeat("y", 2*SearchSnippetRadius) + "…", suffix: true, highlights: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippet, hs := buildSnippet(tt.content, tt.terms)
+			if tt.want != "" && snippet != tt.want {
+				t.Fatalf("snippet = %q, want %q", snippet, tt.want)
+			}
+			if strings.HasPrefix(snippet, "…") != tt.prefix || strings.HasSuffix(snippet, "…") != tt.suffix {
+				t.Fatalf("snippet %q: prefix/suffix ellipsis = %v/%v, want %v/%v", snippet,
+					strings.HasPrefix(snippet, "…"), strings.HasSuffix(snippet, "…"), tt.prefix, tt.suffix)
+			}
+			if n := len([]rune(snippet)); tt.runes > 0 && n != tt.runes {
+				t.Fatalf("snippet has %d runes, want %d", n, tt.runes)
+			}
+			if hs == nil {
+				t.Fatal("highlights must not be nil")
+			}
+			got := highlighted(snippet, hs)
+			if strings.Join(got, "|") != strings.Join(tt.highlights, "|") {
+				t.Fatalf("highlights = %q, want %q", got, tt.highlights)
+			}
+		})
+	}
+}
+
+func TestBuildSnippetDropsHighlightsOutsideWindow(t *testing.T) {
+	content := "mèo " + strings.Repeat("x", 400) + " mèo"
+	snippet, hs := buildSnippet(content, []string{"meo"})
+	if got := highlighted(snippet, hs); len(got) != 1 || got[0] != "mèo" {
+		t.Fatalf("highlights = %q, want only the first match", got)
+	}
+}
@@ -0,0 +1,559 @@
+package services
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"mime/multipart"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Giới hạn sticker / emoji tuỳ chỉnh
+const (
+	StickerPackMaxNameLen   = 64
+	StickerPackMaxStickers  = 120
+	StickerLibraryMaxPacks  = 50
+	StickerMaxFileSize      = 1 << 20   // 1MB
+	CustomEmojiMaxFileSize  = 256 << 10 // 256KB
+	CustomEmojiMaxPerScope  = 200
+	StickerEmojiMaxBytes    = 32
+	customEmojiShortcodeMax = 32
+)
+
+var shortcodePattern = regexp.MustCompile(`^[a-z0-9_]{2,32}$`)
+
+type StickerService struct {
+	DB             *mongo.Database
+	ChannelService *ChannelService
+}
+
+func NewStickerService() *StickerService {
+	return &StickerService{
+		DB:             config.DB,
+		ChannelService: NewChannelService(),
+	}
+}
+
+// CustomEmojiShortcode tách shortcode từ reaction dạng ":ten_emoji:"; ok=false nếu là emoji unicode thường
+func CustomEmojiShortcode(emoji string) (string, bool) {
+	if len(emoji) < 2 || !strings.HasPrefix(emoji, ":") || !strings.HasSuffix(emoji, ":") {
+		return "", false
+	}
+	return emoji[1 : len(emoji)-1], true
+}
+
+// canManage: bộ dùng chung (channelID nil) chỉ admin hệ thống; bộ của kênh chỉ leader kênh
+func (ss *StickerService) canManage(channelID *primitive.ObjectID, userID primitive.ObjectID) error {
+	if channelID == nil {
+		var user models.User
+		if err := ss.DB.Collection("users").FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+			return errors.New("User not found")
+		}
+		if user.Role != models.RoleAdmin {
+			return errors.New("Only administrators can manage global stickers")
+		}
+		return nil
+	}
+	channel, err := ss.ChannelService.GetChannel(*channelID)
+	if err != nil {
+		return err
+	}
+	if !ss.ChannelService.IsMember(channel, userID) {
+		return errors.New("You are not a member of the channel")
+	}
+	return ss.ChannelService.HasPermission(channel, "manageStickers", userID)
+}
+
+// canUse: bộ dùng chung ai cũng dùng được, bộ của kênh chỉ thành viên kênh
+func (ss *StickerService) canUse(channelID *primitive.ObjectID, userID primitive.ObjectID) error {
+	if channelID == nil {
+		return nil
+	}
+	channel, err := ss.ChannelService.GetChannel(*channelID)
+	if err != nil {
+		return err
+	}
+	if !ss.ChannelService.IsMember(channel, userID) {
+		return errors.New("You are not a member of the channel")
+	}
+	return nil
+}
+
+func (ss *StickerService) getPack(packID primitive.ObjectID) (*models.StickerPack, error) {
+	var pack models.StickerPack
+	if err := ss.DB.Collection("stickerPacks").FindOne(context.Background(), bson.M{"_id": packID}).Decode(&pack); err != nil {
+		return nil, errors.New("Sticker pack not found")
+	}
+	return &pack, nil
+}
+
+// loadPackForManager lấy bộ sticker và kiểm tra quyền quản lý
+func (ss *StickerService) loadPackForManager(packID, userID primitive.ObjectID) (*models.StickerPack, error) {
+	pack, err := ss.getPack(packID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ss.canManage(pack.ChannelID, userID); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+func validatePackName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if utf8.RuneCountInString(name) > StickerPackMaxNameLen {
+		return "", fmt.Errorf("name must be at most %d characters", StickerPackMaxNameLen)
+	}
+	return name, nil
+}
+
+// CreatePack tạo bộ sticker rỗng; channelID nil = bộ dùng chung
+func (ss *StickerService) CreatePack(userID primitive.ObjectID, name string, channelID *primitive.ObjectID, order int) (*models.StickerPack, error) {
+	name, err := validatePackName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := ss.canManage(channelID, userID); err != nil {
+		return nil, err
+	}
+
+	pack := &models.StickerPack{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		ChannelID: channelID,
+		Order:     order,
+		Stickers:  []models.Sticker{},
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+	if _, err := ss.DB.Collection("stickerPacks").InsertOne(context.Background(), pack); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// UpdatePack đổi tên và/hoặc thứ tự hiển thị (nil = giữ nguyên)
+func (ss *StickerService) UpdatePack(packID, userID primitive.ObjectID, name *string, order *int) (*models.StickerPack, error) {
+	if _, err := ss.loadPackForManager(packID, userID); err != nil {
+		return nil, err
+	}
+
+	set := bson.M{}
+	if name != nil {
+		n, err := validatePackName(*name)
+		if err != nil {
+			return nil, err
+		}
+		set["name"] = n
+	}
+	if order != nil {
+		set["order"] = *order
+	}
+	if len(set) == 0 {
+		return nil, errors.New("nothing to update")
+	}
+
+	var pack models.StickerPack
+	err := ss.DB.Collection("stickerPacks").FindOneAndUpdate(context.Background(),
+		bson.M{"_id": packID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&pack)
+	if err != nil {
+		return nil, err
+	}
+	return &pack, nil
+}
+
+// DeletePack xoá bộ sticker, gỡ khỏi thư viện của mọi user và dọn file chưa được gửi
+func (ss *StickerService) DeletePack(packID, userID primitive.ObjectID) error {
+	pack, err := ss.loadPackForManager(packID, userID)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if _, err := ss.DB.Collection("stickerPacks").DeleteOne(ctx, bson.M{"_id": packID}); err != nil {
+		return err
+	}
+	if _, err := ss.DB.Collection("stickerLibraries").UpdateMany(ctx,
+		bson.M{"packIDs": packID},
+		bson.M{"$pull": bson.M{"packIDs": packID}},
+	); err != nil {
+		log.Printf("[StickerService] warn: remove pack %s from libraries: %v", packID.Hex(), err)
+	}
+	for _, st := range pack.Stickers {
+		ss.releaseStickerFile(st)
+	}
+	return nil
+}
+
+// saveImage upload ảnh qua FileService, chỉ nhận file ảnh và không vượt quá maxSize
+func (ss *StickerService) saveImage(userID primitive.ObjectID, file multipart.File, fh *multipart.FileHeader, maxSize int64) (*models.File, error) {
+	if fh.Size > maxSize {
+		_ = file.Close()
+		return nil, fmt.Errorf("image too large, max %dKB", maxSize>>10)
+	}
+	fs, err := GetDefaultFileService()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	record, err := fs.SaveUpload(userID, file, fh)
+	if err != nil {
+		return nil, err
+	}
+	if record.FileType != models.FileTypeImage {
+		if err := fs.DeleteByID(record.ID); err != nil {
+			log.Printf("[StickerService] warn: delete rejected upload %s: %v", record.ID.Hex(), err)
+		}
+		return nil, errors.New("only image files are allowed")
+	}
+	return record, nil
+}
+
+// AddSticker upload ảnh và thêm vào cuối bộ sticker
+func (ss *StickerService) AddSticker(packID, userID primitive.ObjectID, file multipart.File, fh *multipart.FileHeader, emoji string) (*models.StickerPack, error) {
+	emoji = strings.TrimSpace(emoji)
+	if len(emoji) > StickerEmojiMaxBytes {
+		_ = file.Close()
+		return nil, errors.New("invalid emoji")
+	}
+	pack, err := ss.loadPackForManager(packID, userID)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if len(pack.Stickers) >= StickerPackMaxStickers {
+		_ = file.Close()
+		return nil, fmt.Errorf("a sticker pack can have at most %d stickers", StickerPackMaxStickers)
+	}
+
+	record, err := ss.saveImage(userID, file, fh, StickerMaxFileSize)
+	if err != nil {
+		return nil, err
+	}
+	sticker := models.Sticker{
+		ID:     primitive.NewObjectID(),
+		FileID: record.ID,
+		URL:    record.URL,
+		Emoji:  emoji,
+	}
+
+	// Kiểm tra giới hạn ngay trong filter để hai lần upload đồng thời không vượt quá
+	var updated models.StickerPack
+	err = ss.DB.Collection("stickerPacks").FindOneAndUpdate(context.Background(),
+		bson.M{
+			"_id":   packID,
+			"$expr": bson.M{"$lt": bson.A{bson.M{"$size": "$stickers"}, StickerPackMaxStickers}},
+		},
+		bson.M{"$push": bson.M{"stickers": sticker}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		ss.releaseStickerFile(sticker)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("a sticker pack can have at most %d stickers", StickerPackMaxStickers)
+		}
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// RemoveSticker gỡ sticker khỏi bộ; tin nhắn đã gửi vẫn giữ ảnh
+func (ss *StickerService) RemoveSticker(packID, stickerID, userID primitive.ObjectID) (*models.StickerPack, error) {
+	pack, err := ss.loadPackForManager(packID, userID)
+	if err != nil {
+		return nil, err
+	}
+	var removed *models.Sticker
+	for i := range pack.Stickers {
+		if pack.Stickers[i].ID == stickerID {
+			removed = &pack.Stickers[i]
+			break
+		}
+	}
+	if removed == nil {
+		return nil, errors.New("Sticker not found")
+	}
+
+	var updated models.StickerPack
+	err = ss.DB.Collection("stickerPacks").FindOneAndUpdate(context.Background(),
+		bson.M{"_id": packID},
+		bson.M{"$pull": bson.M{"stickers": bson.M{"id": stickerID}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, err
+	}
+	ss.releaseStickerFile(*removed)
+	return &updated, nil
+}
+
+// releaseStickerFile xoá file của sticker nếu chưa có tin nhắn nào dùng nó
+func (ss *StickerService) releaseStickerFile(sticker models.Sticker) {
+	used, err := ss.DB.Collection("messages").CountDocuments(context.Background(), bson.M{"stickerId": sticker.ID},
+		options.Count().SetLimit(1))
+	if err != nil || used > 0 {
+		return
+	}
+	fs, err := GetDefaultFileService()
+	if err != nil {
+		return
+	}
+	if err := fs.DeleteByID(sticker.FileID); err != nil {
+		log.Printf("[StickerService] warn: delete sticker file %s: %v", sticker.FileID.Hex(), err)
+	}
+}
+
+// ListPacks trả các bộ user dùng được: bộ dùng chung và (nếu có channelID) bộ của kênh đó
+func (ss *StickerService) ListPacks(userID primitive.ObjectID, channelID *primitive.ObjectID) ([]models.StickerPack, error) {
+	scopes := []bson.M{{"channelID": bson.M{"$exists": false}}}
+	if channelID != nil {
+		if err := ss.canUse(channelID, userID); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, bson.M{"channelID": *channelID})
+	}
+
+	cur, err := ss.DB.Collection("stickerPacks").Find(context.Background(),
+		bson.M{"$or": scopes},
+		options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	packs := []models.StickerPack{}
+	if err := cur.All(context.Background(), &packs); err != nil {
+		return nil, err
+	}
+	return packs, nil
+}
+
+// GetLibrary trả các bộ sticker user đã thêm theo thứ tự thêm; bộ đã xoá hoặc không còn quyền dùng thì bỏ qua
+func (ss *StickerService) GetLibrary(userID primitive.ObjectID) ([]models.StickerPack, error) {
+	ctx := context.Background()
+	var lib models.StickerLibrary
+	err := ss.DB.Collection("stickerLibraries").FindOne(ctx, bson.M{"_id": userID}).Decode(&lib)
+	if errors.Is(err, mongo.ErrNoDocuments) || len(lib.PackIDs) == 0 {
+		return []models.StickerPack{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := ss.DB.Collection("stickerPacks").Find(ctx, bson.M{"_id": bson.M{"$in": lib.PackIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var found []models.StickerPack
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]models.StickerPack, len(found))
+	for _, p := range found {
+		byID[p.ID] = p
+	}
+
+	packs := []models.StickerPack{}
+	for _, id := range lib.PackIDs {
+		p, ok := byID[id]
+		if !ok || ss.canUse(p.ChannelID, userID) != nil {
+			continue
+		}
+		packs = append(packs, p)
+	}
+	return packs, nil
+}
+
+// AddToLibrary thêm bộ sticker vào thư viện của user (đã có thì giữ nguyên vị trí)
+func (ss *StickerService) AddToLibrary(userID, packID primitive.ObjectID) error {
+	pack, err := ss.getPack(packID)
+	if err != nil {
+		return err
+	}
+	if err := ss.canUse(pack.ChannelID, userID); err != nil {
+		return err
+	}
+
+	// Giới hạn số bộ nằm trong filter; user đã có bộ này thì coi như thành công
+	_, err = ss.DB.Collection("stickerLibraries").UpdateOne(context.Background(),
+		bson.M{
+			"_id": userID,
+			"$or": []bson.M{
+				{"packIDs": packID},
+				{"$expr": bson.M{"$lt": bson.A{
+					bson.M{"$size": bson.M{"$ifNull": bson.A{"$packIDs", bson.A{}}}},
+					StickerLibraryMaxPacks,
+				}}},
+			},
+		},
+		bson.M{"$addToSet": bson.M{"packIDs": packID}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// filter không khớp vì đã đủ số bộ → upsert đụng _id của document hiện có
+		return fmt.Errorf("a sticker library can have at most %d packs", StickerLibraryMaxPacks)
+	}
+	return err
+}
+
+// RemoveFromLibrary gỡ bộ sticker khỏi thư viện của user
+func (ss *StickerService) RemoveFromLibrary(userID, packID primitive.ObjectID) error {
+	_, err := ss.DB.Collection("stickerLibraries").UpdateOne(context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"packIDs": packID}},
+	)
+	return err
+}
+
+// ResolveSticker tìm sticker theo ID cho tin nhắn gửi vào kênh: bộ dùng chung hoặc bộ của chính kênh đó
+func (ss *StickerService) ResolveSticker(channel *models.Channel, stickerIDHex string) (*models.Sticker, error) {
+	stickerID, err := primitive.ObjectIDFromHex(strings.TrimSpace(stickerIDHex))
+	if err != nil {
+		return nil, errors.New("invalid sticker id")
+	}
+
+	var pack models.StickerPack
+	err = ss.DB.Collection("stickerPacks").FindOne(context.Background(), bson.M{
+		"stickers.id": stickerID,
+		"$or": []bson.M{
+			{"channelID": bson.M{"$exists": false}},
+			{"channelID": channel.ID},
+		},
+	}).Decode(&pack)
+	if err != nil {
+		return nil, errors.New("Sticker not found")
+	}
+	for i := range pack.Stickers {
+		if pack.Stickers[i].ID == stickerID {
+			return &pack.Stickers[i], nil
+		}
+	}
+	return nil, errors.New("Sticker not found")
+}
+
+// CreateEmoji upload emoji tuỳ chỉnh; channelID nil = dùng chung (admin), có channelID = của kênh (leader)
+func (ss *StickerService) CreateEmoji(userID primitive.ObjectID, shortcode string, channelID *primitive.ObjectID, file multipart.File, fh *multipart.FileHeader) (*models.CustomEmoji, error) {
+	shortcode = strings.ToLower(strings.Trim(strings.TrimSpace(shortcode), ":"))
+	if !shortcodePattern.MatchString(shortcode) {
+		_ = file.Close()
+		return nil, fmt.Errorf("shortcode must be 2-%d characters of a-z, 0-9 or _", customEmojiShortcodeMax)
+	}
+	if err := ss.canManage(channelID, userID); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	ctx := context.Background()
+	scope := bson.M{"channelID": bson.M{"$exists": false}}
+	if channelID != nil {
+		scope = bson.M{"channelID": *channelID}
+	}
+	count, err := ss.DB.Collection("customEmojis").CountDocuments(ctx, scope)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if count >= CustomEmojiMaxPerScope {
+		_ = file.Close()
+		return nil, fmt.Errorf("at most %d custom emoji are allowed", CustomEmojiMaxPerScope)
+	}
+
+	record, err := ss.saveImage(userID, file, fh, CustomEmojiMaxFileSize)
+	if err != nil {
+		return nil, err
+	}
+	emoji := &models.CustomEmoji{
+		ID:        primitive.NewObjectID(),
+		Shortcode: shortcode,
+		ChannelID: channelID,
+		FileID:    record.ID,
+		URL:       record.URL,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+	if _, err := ss.DB.Collection("customEmojis").InsertOne(ctx, emoji); err != nil {
+		if fs, ferr := GetDefaultFileService(); ferr == nil {
+			_ = fs.DeleteByID(record.ID)
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("shortcode :%s: is already in use", shortcode)
+		}
+		return nil, err
+	}
+	return emoji, nil
+}
+
+// DeleteEmoji xoá emoji tuỳ chỉnh; reaction đã thả vẫn giữ shortcode
+func (ss *StickerService) DeleteEmoji(emojiID, userID primitive.ObjectID) error {
+	ctx := context.Background()
+	var emoji models.CustomEmoji
+	if err := ss.DB.Collection("customEmojis").FindOne(ctx, bson.M{"_id": emojiID}).Decode(&emoji); err != nil {
+		return errors.New("Emoji not found")
+	}
+	if err := ss.canManage(emoji.ChannelID, userID); err != nil {
+		return err
+	}
+	if _, err := ss.DB.Collection("customEmojis").DeleteOne(ctx, bson.M{"_id": emojiID}); err != nil {
+		return err
+	}
+	if fs, err := GetDefaultFileService(); err == nil {
+		if err := fs.DeleteByID(emoji.FileID); err != nil {
+			log.Printf("[StickerService] warn: delete emoji file %s: %v", emoji.FileID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// ListEmojis trả emoji dùng chung và (nếu có channelID) emoji của kênh đó, theo shortcode
+func (ss *StickerService) ListEmojis(userID primitive.ObjectID, channelID *primitive.ObjectID) ([]models.CustomEmoji, error) {
+	scopes := []bson.M{{"channelID": bson.M{"$exists": false}}}
+	if channelID != nil {
+		if err := ss.canUse(channelID, userID); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, bson.M{"channelID": *channelID})
+	}
+	cur, err := ss.DB.Collection("customEmojis").Find(context.Background(),
+		bson.M{"$or": scopes},
+		options.Find().SetSort(bson.D{{Key: "shortcode", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	emojis := []models.CustomEmoji{}
+	if err := cur.All(context.Background(), &emojis); err != nil {
+		return nil, err
+	}
+	return emojis, nil
+}
+
+// FindEmoji tìm emoji theo shortcode, ưu tiên emoji của kênh rồi tới emoji dùng chung
+func (ss *StickerService) FindEmoji(channelID primitive.ObjectID, shortcode string) (*models.CustomEmoji, error) {
+	if !shortcodePattern.MatchString(shortcode) {
+		return nil, errors.New("invalid emoji")
+	}
+	coll := ss.DB.Collection("customEmojis")
+	var emoji models.CustomEmoji
+	err := coll.FindOne(context.Background(), bson.M{"shortcode": shortcode, "channelID": channelID}).Decode(&emoji)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = coll.FindOne(context.Background(), bson.M{"shortcode": shortcode, "channelID": bson.M{"$exists": false}}).Decode(&emoji)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown emoji :%s:", shortcode)
+	}
+	return &emoji, nil
+}
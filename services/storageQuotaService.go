@@ -0,0 +1,341 @@
+package services
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Quota mặc định (byte); 0 = không giới hạn. Ghi đè từng user/kênh bằng field storageQuota.
+const (
+	DefaultUserStorageQuota    = 1 << 30 // USER_STORAGE_QUOTA
+	DefaultChannelStorageQuota = 0       // CHANNEL_STORAGE_QUOTA
+)
+
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+// FileTypes là các loại file hiển thị trong thống kê dung lượng
+var FileTypes = []models.FileType{models.FileTypeImage, models.FileTypeVideo, models.FileTypeAudio, models.FileTypeDocument}
+
+type StorageQuotaService struct {
+	DB *mongo.Database
+}
+
+func NewStorageQuotaService() *StorageQuotaService {
+	return &StorageQuotaService{DB: config.DB}
+}
+
+// quotaFromEnv đọc quota (byte) từ env; khác sizeFromEnv ở chỗ cho phép 0 (không giới hạn)
+func quotaFromEnv(key string, def int64) int64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		log.Printf("[%s] giá trị không hợp lệ %q, dùng mặc định %d", key, raw, def)
+		return def
+	}
+	return n
+}
+
+// FormatBytes hiển thị dung lượng dạng "1.5 GB" cho thông báo lỗi
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Usage trả dung lượng user đang dùng. Lần đầu (dữ liệu có từ trước khi có quota) thì tính lại từ collection files.
+func (qs *StorageQuotaService) Usage(userID primitive.ObjectID) (*models.StorageUsage, error) {
+	ctx := context.Background()
+	coll := qs.DB.Collection("storageUsage")
+	var usage models.StorageUsage
+	err := coll.FindOne(ctx, bson.M{"_id": userID}).Decode(&usage)
+	if err == nil {
+		return &usage, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	cur, err := qs.DB.Collection("files").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ownerId": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": "$fileType", "size": bson.M{"$sum": "$fileSize"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		FileType models.FileType `bson:"_id"`
+		Size     int64           `bson:"size"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	usage = models.StorageUsage{UserID: userID, ByType: map[models.FileType]int64{}, UpdatedAt: time.Now()}
+	for _, g := range groups {
+		usage.Used += g.Size
+		usage.ByType[g.FileType] += g.Size
+	}
+	// request khác tính cùng lúc thì giữ bản đã có
+	_, err = coll.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$setOnInsert": bson.M{
+		"used":      usage.Used,
+		"byType":    usage.ByType,
+		"updatedAt": usage.UpdatedAt,
+	}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// UserLimit: storageQuota của user nếu có, không thì USER_STORAGE_QUOTA; 0 = không giới hạn
+func (qs *StorageQuotaService) UserLimit(userID primitive.ObjectID) (int64, error) {
+	var user struct {
+		StorageQuota *int64 `bson:"storageQuota"`
+	}
+	err := qs.DB.Collection("users").FindOne(context.Background(), bson.M{"_id": userID},
+		options.FindOne().SetProjection(bson.M{"storageQuota": 1})).Decode(&user)
+	if err != nil {
+		return 0, errors.New("User not found")
+	}
+	if user.StorageQuota != nil {
+		return *user.StorageQuota, nil
+	}
+	return quotaFromEnv("USER_STORAGE_QUOTA", DefaultUserStorageQuota), nil
+}
+
+// CheckUser báo lỗi nếu thêm size byte sẽ vượt quota của user
+func (qs *StorageQuotaService) CheckUser(userID primitive.ObjectID, size int64) error {
+	limit, err := qs.UserLimit(userID)
+	if err != nil {
+		return err
+	}
+	if limit == 0 {
+		return nil
+	}
+	usage, err := qs.Usage(userID)
+	if err != nil {
+		return err
+	}
+	if usage.Used+size > limit {
+		return fmt.Errorf("%w: đã dùng %s / %s, file cần %s", ErrStorageQuotaExceeded,
+			FormatBytes(usage.Used), FormatBytes(limit), FormatBytes(size))
+	}
+	return nil
+}
+
+// ReserveUser giữ chỗ size byte (loại fileType) trong quota của user trước khi upload.
+// Cộng bằng một lệnh $inc có điều kiện used + size <= limit nên các upload đồng thời không cùng vượt quota.
+func (qs *StorageQuotaService) ReserveUser(userID primitive.ObjectID, fileType models.FileType, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	limit, err := qs.UserLimit(userID)
+	if err != nil {
+		return err
+	}
+	// đảm bảo đã có thống kê để $inc không bị bỏ qua
+	if _, err := qs.Usage(userID); err != nil {
+		return err
+	}
+	ok, err := reserveUsage(qs.DB.Collection("storageUsage"), userID, size, limit,
+		bson.M{"used": size, "byType." + string(fileType): size})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		used := int64(0)
+		if usage, err := qs.Usage(userID); err == nil {
+			used = usage.Used
+		}
+		return fmt.Errorf("%w: đã dùng %s / %s, file cần %s", ErrStorageQuotaExceeded,
+			FormatBytes(used), FormatBytes(limit), FormatBytes(size))
+	}
+	return nil
+}
+
+// ReleaseUser trả lại size byte đã giữ chỗ bằng ReserveUser (upload lỗi, hoặc file lưu thực tế nhỏ hơn)
+func (qs *StorageQuotaService) ReleaseUser(userID primitive.ObjectID, fileType models.FileType, size int64) {
+	if size == 0 {
+		return
+	}
+	_, err := qs.DB.Collection("storageUsage").UpdateOne(context.Background(),
+		bson.M{"_id": userID},
+		bson.M{
+			"$inc": bson.M{"used": -size, "byType." + string(fileType): -size},
+			"$set": bson.M{"updatedAt": time.Now()},
+		})
+	if err != nil {
+		log.Printf("[StorageQuota] release %s: %v", userID.Hex(), err)
+	}
+}
+
+// Track trừ dung lượng file khỏi thống kê của người upload khi file bị xoá/GC (dung lượng đã cộng lúc upload bằng ReserveUser).
+// Chưa có thống kê thì bỏ qua: lần đọc đầu tiên (Usage) sẽ tính lại từ collection files.
+func (qs *StorageQuotaService) Track(file *models.File, sign int64) {
+	if file.OwnerID == nil || file.FileSize == 0 {
+		return
+	}
+	qs.ReleaseUser(*file.OwnerID, file.FileType, -sign*file.FileSize)
+}
+
+// reserveUsage cộng inc vào document id nếu used + size <= limit (limit 0 = không giới hạn); false = vượt quota
+func reserveUsage(coll *mongo.Collection, id primitive.ObjectID, size, limit int64, inc bson.M) (bool, error) {
+	filter := bson.M{"_id": id}
+	if limit > 0 {
+		filter["used"] = bson.M{"$lte": limit - size}
+	}
+	res, err := coll.UpdateOne(context.Background(), filter, bson.M{
+		"$inc": inc,
+		"$set": bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// SetUserLimit đặt quota riêng cho user (admin); nil = quay về mặc định
+func (qs *StorageQuotaService) SetUserLimit(userID primitive.ObjectID, limit *int64) error {
+	return setStorageQuota(qs.DB.Collection("users"), userID, limit, "User not found")
+}
+
+// ChannelUsage là tổng dung lượng file đính kèm trong các tin nhắn chưa thu hồi của kênh, lưu sẵn trong channelStorageUsage.
+// Lần đầu (kênh có từ trước khi có bộ đếm) thì tính lại từ collection messages.
+func (qs *StorageQuotaService) ChannelUsage(channelID primitive.ObjectID) (int64, error) {
+	ctx := context.Background()
+	coll := qs.DB.Collection("channelStorageUsage")
+	var usage struct {
+		Used int64 `bson:"used"`
+	}
+	err := coll.FindOne(ctx, bson.M{"_id": channelID}).Decode(&usage)
+	if err == nil {
+		return usage.Used, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+
+	cur, err := qs.DB.Collection("messages").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"channelID": channelID, "recalled": bson.M{"$ne": true}, "attachments.0": bson.M{"$exists": true}}}},
+		{{Key: "$unwind", Value: "$attachments"}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "size": bson.M{"$sum": "$attachments.size"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var result []struct {
+		Size int64 `bson:"size"`
+	}
+	if err := cur.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	var used int64
+	if len(result) > 0 {
+		used = result[0].Size
+	}
+	// request khác tính cùng lúc thì giữ bản đã có
+	_, err = coll.UpdateOne(ctx, bson.M{"_id": channelID}, bson.M{"$setOnInsert": bson.M{
+		"used":      used,
+		"updatedAt": time.Now(),
+	}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return 0, err
+	}
+	return used, nil
+}
+
+// ChannelLimit: storageQuota của kênh nếu có, không thì CHANNEL_STORAGE_QUOTA; 0 = không giới hạn
+func ChannelLimit(channel *models.Channel) int64 {
+	if channel.StorageQuota != nil {
+		return *channel.StorageQuota
+	}
+	return quotaFromEnv("CHANNEL_STORAGE_QUOTA", DefaultChannelStorageQuota)
+}
+
+// ReserveChannel giữ chỗ size byte file đính kèm trong quota của kênh trước khi lưu tin nhắn (cùng cách với ReserveUser).
+// Kênh không giới hạn vẫn cộng vào bộ đếm nếu đã có, để đặt quota sau này không phải tính lại.
+func (qs *StorageQuotaService) ReserveChannel(channel *models.Channel, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	limit := ChannelLimit(channel)
+	if limit > 0 {
+		if _, err := qs.ChannelUsage(channel.ID); err != nil {
+			return err
+		}
+	}
+	ok, err := reserveUsage(qs.DB.Collection("channelStorageUsage"), channel.ID, size, limit, bson.M{"used": size})
+	if err != nil {
+		return err
+	}
+	if !ok && limit > 0 {
+		used, _ := qs.ChannelUsage(channel.ID)
+		return fmt.Errorf("%w: kênh đã dùng %s / %s", ErrStorageQuotaExceeded, FormatBytes(used), FormatBytes(limit))
+	}
+	return nil
+}
+
+// ReleaseChannel trả lại size byte khi tin nhắn có file đính kèm bị thu hồi, xoá hoặc lưu lỗi
+func (qs *StorageQuotaService) ReleaseChannel(channelID primitive.ObjectID, size int64) {
+	if size == 0 {
+		return
+	}
+	_, err := qs.DB.Collection("channelStorageUsage").UpdateOne(context.Background(),
+		bson.M{"_id": channelID},
+		bson.M{"$inc": bson.M{"used": -size}, "$set": bson.M{"updatedAt": time.Now()}})
+	if err != nil {
+		log.Printf("[StorageQuota] release channel %s: %v", channelID.Hex(), err)
+	}
+}
+
+// AttachmentsSize là tổng dung lượng (do server đo) của các file đính kèm
+func AttachmentsSize(attachments []models.Attachment) int64 {
+	var size int64
+	for _, a := range attachments {
+		size += a.Size
+	}
+	return size
+}
+
+// SetChannelLimit đặt quota riêng cho kênh (admin); nil = quay về mặc định
+func (qs *StorageQuotaService) SetChannelLimit(channelID primitive.ObjectID, limit *int64) error {
+	return setStorageQuota(qs.DB.Collection("channels"), channelID, limit, "Channel not found")
+}
+
+func setStorageQuota(coll *mongo.Collection, id primitive.ObjectID, limit *int64, notFound string) error {
+	update := bson.M{"$unset": bson.M{"storageQuota": ""}}
+	if limit != nil {
+		if *limit < 0 {
+			return errors.New("quota must not be negative")
+		}
+		update = bson.M{"$set": bson.M{"storageQuota": *limit}}
+	}
+	res, err := coll.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New(notFound)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bytes"
+	"chat-app-backend/models"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrFileTypeNotAllowed = errors.New("file type not allowed")
+
+// uploadType: loại file của MIME và các phần mở rộng hợp lệ (phần tử đầu là phần mở rộng chuẩn khi phải đổi tên)
+type uploadType struct {
+	FileType   models.FileType
+	Extensions []string
+}
+
+// knownUploadTypes là các MIME server nhận diện được từ nội dung (magic bytes); allowlist chỉ chọn trong bảng này
+var knownUploadTypes = map[string]uploadType{
+	"image/jpeg": {models.FileTypeImage, []string{".jpg", ".jpeg"}},
+	"image/png":  {models.FileTypeImage, []string{".png"}},
+	"image/gif":  {models.FileTypeImage, []string{".gif"}},
+	"image/webp": {models.FileTypeImage, []string{".webp"}},
+	"image/bmp":  {models.FileTypeImage, []string{".bmp"}},
+
+	"video/mp4":  {models.FileTypeVideo, []string{".mp4", ".m4v"}},
+	"video/webm": {models.FileTypeVideo, []string{".webm"}},
+	"video/avi":  {models.FileTypeVideo, []string{".avi"}},
+
+	"audio/mpeg": {models.FileTypeAudio, []string{".mp3"}},
+	"audio/ogg":  {models.FileTypeAudio, []string{".ogg", ".oga", ".opus"}},
+	"audio/wave": {models.FileTypeAudio, []string{".wav"}},
+	"audio/mp4":  {models.FileTypeAudio, []string{".m4a"}},
+	"audio/aiff": {models.FileTypeAudio, []string{".aiff", ".aif"}},
+
+	"application/pdf":              {models.FileTypeDocument, []string{".pdf"}},
+	"application/zip":              {models.FileTypeDocument, []string{".zip", ".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp"}},
+	"application/x-gzip":           {models.FileTypeDocument, []string{".gz", ".tgz"}},
+	"application/x-rar-compressed": {models.FileTypeDocument, []string{".rar"}},
+	"text/plain":                   {models.FileTypeDocument, []string{".txt", ".csv", ".md", ".log", ".json"}},
+}
+
+// Allowlist mặc định theo FileType; ghi đè bằng UPLOAD_ALLOWED_IMAGE/VIDEO/AUDIO/DOCUMENT
+// (danh sách MIME cách nhau bởi dấu phẩy, "none" = không cho phép loại đó)
+var defaultAllowedUploadTypes = map[models.FileType][]string{
+	models.FileTypeImage:    {"image/jpeg", "image/png", "image/gif", "image/webp"},
+	models.FileTypeVideo:    {"video/mp4", "video/webm"},
+	models.FileTypeAudio:    {"audio/mpeg", "audio/ogg", "audio/wave", "audio/mp4"},
+	models.FileTypeDocument: {"application/pdf", "application/zip", "application/x-gzip", "application/x-rar-compressed", "text/plain"},
+}
+
+// UploadPolicy kiểm tra loại file upload theo nội dung thật, không tin phần mở rộng client gửi
+type UploadPolicy struct {
+	Allowed map[string]bool // MIME được phép
+}
+
+func NewUploadPolicyFromEnv() *UploadPolicy {
+	p := &UploadPolicy{Allowed: map[string]bool{}}
+	for fileType, defaults := range defaultAllowedUploadTypes {
+		list := defaults
+		key := "UPLOAD_ALLOWED_" + strings.ToUpper(string(fileType))
+		if raw, ok := os.LookupEnv(key); ok && strings.TrimSpace(raw) != "" {
+			list = nil
+			if strings.TrimSpace(raw) != "none" {
+				list = strings.Split(raw, ",")
+			}
+		}
+		for _, m := range list {
+			m = strings.ToLower(strings.TrimSpace(m))
+			if t, ok := knownUploadTypes[m]; !ok || t.FileType != fileType {
+				log.Printf("[%s] bỏ qua %q: không phải loại %s server nhận diện được", key, m, fileType)
+				continue
+			}
+			p.Allowed[m] = true
+		}
+	}
+	return p
+}
+
+// AllowedTypes là danh sách MIME được phép, dùng trong thông báo lỗi
+func (p *UploadPolicy) AllowedTypes() []string {
+	list := make([]string, 0, len(p.Allowed))
+	for m := range p.Allowed {
+		list = append(list, m)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// DetectMIME nhận diện MIME từ các byte đầu file (magic bytes), bỏ tham số charset
+func DetectMIME(head []byte) string {
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	switch {
+	case detected == "application/ogg":
+		// DetectContentType trả "application/ogg" cho mọi file Ogg; Opus/Vorbis (ghi âm) là audio
+		return "audio/ogg"
+	case detected == "video/mp4" && len(head) >= 12 && bytes.Equal(head[8:12], []byte("M4A ")):
+		return "audio/mp4"
+	case detected == "application/octet-stream" && len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		// MP3 không có thẻ ID3 bắt đầu thẳng bằng frame sync
+		return "audio/mpeg"
+	}
+	return detected
+}
+
+// Check đối chiếu nội dung (MIME phát hiện từ magic bytes) với allowlist và phần mở rộng của tên file.
+// Trả MIME, phần mở rộng sẽ dùng khi lưu (đổi theo nội dung nếu cần) và FileType.
+// Từ chối khi phần mở rộng là loại khác hẳn nội dung, ví dụ .html chứa byte ảnh.
+func (p *UploadPolicy) Check(filename, detected string) (string, string, models.FileType, error) {
+	t, known := knownUploadTypes[detected]
+	if !known || !p.Allowed[detected] {
+		return "", "", "", fmt.Errorf("%w: %q có nội dung %s, chỉ chấp nhận %s",
+			ErrFileTypeNotAllowed, filename, detected, strings.Join(p.AllowedTypes(), ", "))
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, e := range t.Extensions {
+		if e == ext {
+			return detected, ext, t.FileType, nil
+		}
+	}
+	if claimed := mimeForExtension(ext); claimed != "" {
+		claimedType := models.FileTypeDocument
+		if ct, ok := knownUploadTypes[claimed]; ok {
+			claimedType = ct.FileType
+		} else if major, _, _ := strings.Cut(claimed, "/"); major == "image" || major == "video" || major == "audio" {
+			claimedType = fileTypeOfMajor(major)
+		}
+		if claimedType != t.FileType || isActiveContent(claimed) {
+			return "", "", "", fmt.Errorf("%w: %q có phần mở rộng %s (%s) nhưng nội dung là %s",
+				ErrFileTypeNotAllowed, filename, ext, claimed, detected)
+		}
+	}
+	// không có phần mở rộng, phần mở rộng lạ, hoặc cùng loại nhưng khác định dạng (.jpg chứa PNG): đổi theo nội dung
+	return detected, t.Extensions[0], t.FileType, nil
+}
+
+// mimeForExtension: MIME mà phần mở rộng tự nhận ("" nếu không biết)
+func mimeForExtension(ext string) string {
+	if ext == "" {
+		return ""
+	}
+	for m, t := range knownUploadTypes {
+		for _, e := range t.Extensions {
+			if e == ext {
+				return m
+			}
+		}
+	}
+	m, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	return m
+}
+
+func fileTypeOfMajor(major string) models.FileType {
+	switch major {
+	case "image":
+		return models.FileTypeImage
+	case "video":
+		return models.FileTypeVideo
+	case "audio":
+		return models.FileTypeAudio
+	}
+	return models.FileTypeDocument
+}
+
+// isActiveContent: loại trình duyệt có thể chạy script khi mở (HTML, SVG, XML, JavaScript)
+func isActiveContent(m string) bool {
+	return strings.Contains(m, "html") || strings.Contains(m, "svg") ||
+		strings.Contains(m, "xml") || strings.Contains(m, "javascript")
+}
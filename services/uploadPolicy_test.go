@@ -0,0 +1,107 @@
+package services
+
+import (
+	"chat-app-backend/models"
+	"errors"
+	"testing"
+)
+
+var (
+	pngHead  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	jpegHead = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	mp3Frame = []byte("\xff\xfb\x90\x64\x00\x00\x00\x00\x00\x00\x00\x00")
+)
+
+func TestDetectMIME(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"png", pngHead, "image/png"},
+		{"jpeg", jpegHead, "image/jpeg"},
+		{"mp3 with id3", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "audio/mpeg"},
+		{"mp3 without id3", mp3Frame, "audio/mpeg"},
+		{"ogg", []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00"), "audio/ogg"},
+		{"m4a", []byte("\x00\x00\x00\x18ftypM4A \x00\x00\x00\x00mp42isom"), "audio/mp4"},
+		{"html", []byte("<!DOCTYPE html><html><script>alert(1)</script>"), "text/html"},
+		{"svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`), "text/xml"},
+		{"plain text charset stripped", []byte("xin chào"), "text/plain"},
+		{"unknown binary", []byte{0x00, 0x01, 0x02, 0x03}, "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := DetectMIME(tt.head); got != tt.want {
+			t.Errorf("%s: DetectMIME = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUploadPolicyCheck(t *testing.T) {
+	p := NewUploadPolicyFromEnv()
+	tests := []struct {
+		name     string
+		filename string
+		head     []byte
+		mime     string
+		ext      string
+		fileType models.FileType
+		rejected bool
+	}{
+		{name: "png", filename: "a.png", head: pngHead, mime: "image/png", ext: ".png", fileType: models.FileTypeImage},
+		{name: "jpeg alt extension kept", filename: "a.JPEG", head: jpegHead, mime: "image/jpeg", ext: ".jpeg", fileType: models.FileTypeImage},
+		{name: "jpg containing png renamed", filename: "a.jpg", head: pngHead, mime: "image/png", ext: ".png", fileType: models.FileTypeImage},
+		{name: "no extension", filename: "photo", head: pngHead, mime: "image/png", ext: ".png", fileType: models.FileTypeImage},
+		{name: "unknown extension", filename: "a.xyzzy", head: pngHead, mime: "image/png", ext: ".png", fileType: models.FileTypeImage},
+		{name: "mp3 without id3", filename: "voice.mp3", head: mp3Frame, mime: "audio/mpeg", ext: ".mp3", fileType: models.FileTypeAudio},
+
+		{name: "html with image bytes", filename: "x.html", head: pngHead, rejected: true},
+		{name: "svg with image bytes", filename: "x.svg", head: pngHead, rejected: true},
+		{name: "xml with image bytes", filename: "x.xml", head: pngHead, rejected: true},
+		{name: "pdf extension with image bytes", filename: "x.pdf", head: pngHead, rejected: true},
+		{name: "html content", filename: "x.txt", head: []byte("<html><script>alert(1)</script></html>"), rejected: true},
+		{name: "svg content", filename: "x.png", head: []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`), rejected: true},
+		{name: "unknown content", filename: "x.exe", head: []byte("MZ\x90\x00\x03\x00\x00\x00"), rejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ext, fileType, err := p.Check(tt.filename, DetectMIME(tt.head))
+			if tt.rejected {
+				if !errors.Is(err, ErrFileTypeNotAllowed) {
+					t.Fatalf("err = %v, want ErrFileTypeNotAllowed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if m != tt.mime || ext != tt.ext || fileType != tt.fileType {
+				t.Fatalf("Check = %s %s %s, want %s %s %s", m, ext, fileType, tt.mime, tt.ext, tt.fileType)
+			}
+		})
+	}
+}
+
+func TestUploadPolicyFromEnv(t *testing.T) {
+	t.Setenv("UPLOAD_ALLOWED_IMAGE", "none")
+	t.Setenv("UPLOAD_ALLOWED_AUDIO", "audio/ogg, AUDIO/MPEG, image/png, text/html")
+	p := NewUploadPolicyFromEnv()
+
+	if _, _, _, err := p.Check("a.png", "image/png"); !errors.Is(err, ErrFileTypeNotAllowed) {
+		t.Fatalf("images disabled: err = %v", err)
+	}
+	// MIME khác loại hoặc không nhận diện được trong danh sách audio bị bỏ qua
+	for _, m := range []string{"audio/ogg", "audio/mpeg"} {
+		if !p.Allowed[m] {
+			t.Errorf("%s must be allowed", m)
+		}
+	}
+	for _, m := range []string{"image/png", "text/html", "audio/wave"} {
+		if p.Allowed[m] {
+			t.Errorf("%s must not be allowed", m)
+		}
+	}
+	// loại không ghi đè giữ mặc định
+	if !p.Allowed["application/pdf"] {
+		t.Error("documents must keep the default allowlist")
+	}
+}
@@ -0,0 +1,464 @@
+package services
+
+import (
+	"chat-app-backend/config"
+	"chat-app-backend/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cấu hình upload chia chunk; các giá trị kích thước đọc từ env theo byte
+const (
+	DefaultMaxUploadSize      = 1 << 30 // MAX_UPLOAD_SIZE: dung lượng tối đa một file
+	DefaultUploadChunkSize    = 5 << 20 // UPLOAD_CHUNK_SIZE
+	DefaultPendingUploadQuota = 2 << 30 // UPLOAD_PENDING_QUOTA: tổng dung lượng các lượt upload dang dở của một user
+	DefaultUploadSessionTTL   = 24 * time.Hour
+	MaxActiveUploadSessions   = 5 // số lượt upload dang dở tối đa của một user
+	minUploadChunkSize        = 256 << 10
+)
+
+var (
+	ErrUploadNotFound      = errors.New("Upload session not found")
+	ErrUploadNotActive     = errors.New("Upload session is not accepting chunks")
+	ErrUploadIncomplete    = errors.New("Upload is missing chunks")
+	ErrUploadQuotaExceeded = errors.New("Upload quota exceeded")
+	ErrChunkChecksum       = errors.New("chunk checksum mismatch")
+	ErrFileChecksum        = errors.New("file checksum mismatch")
+)
+
+// UploadSessionService quản lý upload chia chunk: initiate → PUT từng chunk → complete.
+// Chunk lưu ở thư mục tạm trên đĩa của instance nhận request, nên khi chạy nhiều instance
+// cần sticky session cho /api/uploads.
+type UploadSessionService struct {
+	DB          *mongo.Database
+	FileService *FileService
+	TempDir     string
+	MaxSize     int64
+	ChunkSize   int64
+	Quota       int64
+	TTL         time.Duration
+}
+
+func NewUploadSessionService(fs *FileService) *UploadSessionService {
+	tempDir := os.Getenv("UPLOAD_TMP_DIR")
+	if tempDir == "" {
+		tempDir = filepath.Join(os.TempDir(), "chat-uploads")
+	}
+	_ = os.MkdirAll(tempDir, os.ModePerm)
+
+	chunkSize := sizeFromEnv("UPLOAD_CHUNK_SIZE", DefaultUploadChunkSize)
+	if chunkSize < minUploadChunkSize {
+		chunkSize = minUploadChunkSize
+	}
+	return &UploadSessionService{
+		DB:          config.DB,
+		FileService: fs,
+		TempDir:     tempDir,
+		MaxSize:     sizeFromEnv("MAX_UPLOAD_SIZE", DefaultMaxUploadSize),
+		ChunkSize:   chunkSize,
+		Quota:       sizeFromEnv("UPLOAD_PENDING_QUOTA", DefaultPendingUploadQuota),
+		TTL:         durationFromEnv("UPLOAD_SESSION_TTL", DefaultUploadSessionTTL),
+	}
+}
+
+// sizeFromEnv đọc số byte dương từ env
+func sizeFromEnv(key string, def int64) int64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n <= 0 {
+		log.Printf("[%s] giá trị không hợp lệ %q, dùng mặc định %d", key, raw, def)
+		return def
+	}
+	return n
+}
+
+func (us *UploadSessionService) collection() *mongo.Collection {
+	return us.DB.Collection("uploadSessions")
+}
+
+func (us *UploadSessionService) sessionDir(id primitive.ObjectID) string {
+	return filepath.Join(us.TempDir, id.Hex())
+}
+
+func (us *UploadSessionService) chunkPath(id primitive.ObjectID, index int) string {
+	return filepath.Join(us.sessionDir(id), strconv.Itoa(index))
+}
+
+// chunkLength là kích thước đúng của chunk thứ index (chunk cuối có thể nhỏ hơn)
+func chunkLength(s *models.UploadSession, index int) int64 {
+	if index == s.TotalChunks-1 {
+		return s.Size - int64(index)*s.ChunkSize
+	}
+	return s.ChunkSize
+}
+
+func validSHA256(sum string) bool {
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
+
+// Initiate mở lượt upload mới; kiểm tra dung lượng tối đa và quota dang dở của user
+func (us *UploadSessionService) Initiate(userID primitive.ObjectID, fileName string, size int64, checksum string) (*models.UploadSession, error) {
+	fileName = strings.TrimSpace(filepath.Base(fileName))
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if fileName == "" || fileName == "." || fileName == string(filepath.Separator) {
+		return nil, errors.New("fileName is required")
+	}
+	if size <= 0 {
+		return nil, errors.New("size must be positive")
+	}
+	if size > us.MaxSize {
+		return nil, fmt.Errorf("file quá lớn, tối đa %dMB", us.MaxSize>>20)
+	}
+	// file lớn hơn giới hạn của scanner sẽ không bao giờ quét xong: từ chối trước khi client gửi chunk
+	if err := us.FileService.CheckScanSize(size); err != nil {
+		return nil, err
+	}
+	if !validSHA256(checksum) {
+		return nil, errors.New("sha256 must be a hex-encoded SHA-256 checksum")
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	cur, err := us.collection().Find(ctx, bson.M{
+		"userId":    userID,
+		"status":    bson.M{"$ne": models.UploadStatusCompleted},
+		"expiresAt": bson.M{"$gt": now},
+	}, options.Find().SetProjection(bson.M{"size": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var active []models.UploadSession
+	if err := cur.All(ctx, &active); err != nil {
+		return nil, err
+	}
+	pending := size
+	for _, s := range active {
+		pending += s.Size
+	}
+	if len(active) >= MaxActiveUploadSessions || pending > us.Quota {
+		return nil, ErrUploadQuotaExceeded
+	}
+	if err := us.FileService.Quota.CheckUser(userID, size); err != nil {
+		return nil, err
+	}
+
+	session := &models.UploadSession{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		FileName:    fileName,
+		Size:        size,
+		SHA256:      checksum,
+		ChunkSize:   us.ChunkSize,
+		TotalChunks: int((size + us.ChunkSize - 1) / us.ChunkSize),
+		Received:    []int{},
+		Status:      models.UploadStatusUploading,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ExpiresAt:   now.Add(us.TTL),
+	}
+	if err := os.MkdirAll(us.sessionDir(session.ID), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if _, err := us.collection().InsertOne(ctx, session); err != nil {
+		_ = os.RemoveAll(us.sessionDir(session.ID))
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSession trả lượt upload của user (dùng để resume: xem chunk nào đã nhận)
+func (us *UploadSessionService) GetSession(userID, sessionID primitive.ObjectID) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := us.collection().FindOne(context.Background(), bson.M{"_id": sessionID, "userId": userID}).Decode(&session)
+	if err != nil || time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadNotFound
+	}
+	sort.Ints(session.Received)
+	return &session, nil
+}
+
+// PutChunk ghi chunk thứ index sau khi kiểm tra kích thước và SHA-256; gửi lại chunk đã có thì ghi đè
+func (us *UploadSessionService) PutChunk(userID, sessionID primitive.ObjectID, index int, r io.Reader, checksum string) (*models.UploadSession, error) {
+	session, err := us.GetSession(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != models.UploadStatusUploading {
+		return nil, ErrUploadNotActive
+	}
+	if index < 0 || index >= session.TotalChunks {
+		return nil, fmt.Errorf("chunk index must be between 0 and %d", session.TotalChunks-1)
+	}
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if !validSHA256(checksum) {
+		return nil, errors.New("chunk SHA-256 checksum is required")
+	}
+
+	// ghi ra file tạm rồi rename để chunk lỗi giữa chừng không đè chunk tốt đã nhận
+	expected := chunkLength(session, index)
+	tmp, err := os.CreateTemp(us.sessionDir(sessionID), strconv.Itoa(index)+".part*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, expected+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("không thể nhận chunk: %v", err)
+	}
+	if n != expected {
+		return nil, fmt.Errorf("chunk %d must be %d bytes, got %d", index, expected, n)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != checksum {
+		return nil, ErrChunkChecksum
+	}
+	if err := os.Rename(tmp.Name(), us.chunkPath(sessionID, index)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var updated models.UploadSession
+	err = us.collection().FindOneAndUpdate(context.Background(),
+		bson.M{"_id": sessionID, "userId": userID, "status": models.UploadStatusUploading},
+		bson.M{
+			"$addToSet": bson.M{"receivedChunks": index},
+			"$set":      bson.M{"updatedAt": now, "expiresAt": now.Add(us.TTL)},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, ErrUploadNotActive
+	}
+	sort.Ints(updated.Received)
+	return &updated, nil
+}
+
+// Complete ghép các chunk, kiểm tra SHA-256 cả file rồi lưu như upload thường (FileService.store).
+// Gọi lại sau khi đã complete thì trả về file đã tạo.
+func (us *UploadSessionService) Complete(userID, sessionID primitive.ObjectID) (*models.File, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	var session models.UploadSession
+	err := us.collection().FindOneAndUpdate(ctx,
+		bson.M{"_id": sessionID, "userId": userID, "status": models.UploadStatusUploading, "expiresAt": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"status": models.UploadStatusAssembling, "updatedAt": now, "expiresAt": now.Add(us.TTL)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if err != nil {
+		existing, getErr := us.GetSession(userID, sessionID)
+		if getErr != nil {
+			return nil, getErr
+		}
+		if existing.Status == models.UploadStatusCompleted && existing.FileID != nil {
+			return us.completedFile(*existing.FileID)
+		}
+		return nil, ErrUploadNotActive
+	}
+
+	file, err := us.assemble(&session)
+	if err != nil {
+		if unrecoverableAssembleError(err) {
+			// chunk nào cũng đã khớp checksum riêng: sai checksum cả file hoặc nội dung bị từ chối thì không resume được, huỷ lượt upload.
+			// Không dùng Abort: lượt upload vẫn đang Assembling nên Abort không xoá được.
+			us.discardAssembling(sessionID)
+		} else {
+			_, _ = us.collection().UpdateOne(ctx, bson.M{"_id": sessionID},
+				bson.M{"$set": bson.M{"status": models.UploadStatusUploading, "updatedAt": time.Now()}})
+		}
+		return nil, err
+	}
+
+	_, err = us.collection().UpdateOne(ctx, bson.M{"_id": sessionID}, bson.M{"$set": bson.M{
+		"status":    models.UploadStatusCompleted,
+		"fileId":    file.ID,
+		"updatedAt": time.Now(),
+	}})
+	if err != nil {
+		log.Printf("[UploadSession] mark %s completed: %v", sessionID.Hex(), err)
+	}
+	_ = os.RemoveAll(us.sessionDir(sessionID))
+	return file, nil
+}
+
+// unrecoverableAssembleError: lỗi khi ghép mà gửi lại chunk cũng không sửa được
+func unrecoverableAssembleError(err error) bool {
+	return errors.Is(err, ErrFileChecksum) || errors.Is(err, ErrFileTypeNotAllowed) ||
+		errors.Is(err, ErrFileInfected) || errors.Is(err, ErrFileScanFailed) || errors.Is(err, ErrFileTooLargeToScan)
+}
+
+// assemblingFilter chọn lượt upload đang được ghép (chỉ Complete đang giữ nó mới được xoá)
+func assemblingFilter(sessionID primitive.ObjectID) bson.M {
+	return bson.M{"_id": sessionID, "status": models.UploadStatusAssembling}
+}
+
+// discardAssembling xoá lượt upload đang ghép cùng các chunk, trả lại slot và quota dang dở cho user
+func (us *UploadSessionService) discardAssembling(sessionID primitive.ObjectID) {
+	if _, err := us.collection().DeleteOne(context.Background(), assemblingFilter(sessionID)); err != nil {
+		log.Printf("[UploadSession] discard %s: %v", sessionID.Hex(), err)
+		return
+	}
+	if err := os.RemoveAll(us.sessionDir(sessionID)); err != nil {
+		log.Printf("[UploadSession] remove chunks of %s: %v", sessionID.Hex(), err)
+	}
+}
+
+func (us *UploadSessionService) completedFile(fileID primitive.ObjectID) (*models.File, error) {
+	var file models.File
+	if err := us.DB.Collection("files").FindOne(context.Background(), bson.M{"_id": fileID}).Decode(&file); err != nil {
+		return nil, errors.New("File not found")
+	}
+	return &file, nil
+}
+
+// assemble nối các chunk thành một file tạm, kiểm tra checksum rồi upload
+func (us *UploadSessionService) assemble(session *models.UploadSession) (*models.File, error) {
+	if missing := MissingChunks(session); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %d of %d chunks missing", ErrUploadIncomplete, len(missing), session.TotalChunks)
+	}
+
+	out, err := os.CreateTemp(us.sessionDir(session.ID), "assembled*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = out.Close()
+		_ = os.Remove(out.Name())
+	}()
+
+	hash := sha256.New()
+	w := io.MultiWriter(out, hash)
+	for i := 0; i < session.TotalChunks; i++ {
+		chunk, err := os.Open(us.chunkPath(session.ID, i))
+		if err != nil {
+			return nil, fmt.Errorf("%w: chunk %d not found", ErrUploadIncomplete, i)
+		}
+		_, err = io.Copy(w, chunk)
+		_ = chunk.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != session.SHA256 {
+		return nil, ErrFileChecksum
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return us.FileService.store(session.UserID, out, session.FileName, session.Size, session.SHA256)
+}
+
+// Abort huỷ lượt upload và xoá các chunk đã nhận
+func (us *UploadSessionService) Abort(userID, sessionID primitive.ObjectID) error {
+	res, err := us.collection().DeleteOne(context.Background(), bson.M{
+		"_id":    sessionID,
+		"userId": userID,
+		"status": bson.M{"$ne": models.UploadStatusAssembling},
+	})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrUploadNotFound
+	}
+	return os.RemoveAll(us.sessionDir(sessionID))
+}
+
+// MissingChunks trả các chunk chưa nhận, tăng dần
+func MissingChunks(session *models.UploadSession) []int {
+	received := make(map[int]bool, len(session.Received))
+	for _, i := range session.Received {
+		received[i] = true
+	}
+	missing := []int{}
+	for i := 0; i < session.TotalChunks; i++ {
+		if !received[i] {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// ReceivedRanges gộp các chunk đã nhận thành các khoảng byte [start, end) để client resume
+func ReceivedRanges(session *models.UploadSession) [][2]int64 {
+	chunks := append([]int(nil), session.Received...)
+	sort.Ints(chunks)
+	ranges := [][2]int64{}
+	for _, i := range chunks {
+		start := int64(i) * session.ChunkSize
+		end := start + chunkLength(session, i)
+		if n := len(ranges); n > 0 && ranges[n-1][1] >= start {
+			ranges[n-1][1] = max(ranges[n-1][1], end) // liền kề hoặc chunk trùng
+			continue
+		}
+		ranges = append(ranges, [2]int64{start, end})
+	}
+	return ranges
+}
+
+// StartExpirySweeper chạy nền, định kỳ xoá các lượt upload quá hạn cùng chunk trên đĩa
+func (us *UploadSessionService) StartExpirySweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := us.CleanupExpired(); err != nil {
+				log.Printf("[UploadSession] cleanup error: %v", err)
+			} else if n > 0 {
+				log.Printf("[UploadSession] removed %d expired upload sessions", n)
+			}
+		}
+	}()
+}
+
+// CleanupExpired xoá bản ghi và thư mục chunk của các lượt upload đã hết hạn
+func (us *UploadSessionService) CleanupExpired() (int, error) {
+	ctx := context.Background()
+	cur, err := us.collection().Find(ctx, bson.M{"expiresAt": bson.M{"$lte": time.Now()}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var expired []models.UploadSession
+	if err := cur.All(ctx, &expired); err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, s := range expired {
+		if err := os.RemoveAll(us.sessionDir(s.ID)); err != nil {
+			log.Printf("[UploadSession] remove chunks %s: %v", s.ID.Hex(), err)
+			continue
+		}
+		if _, err := us.collection().DeleteOne(ctx, bson.M{"_id": s.ID}); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
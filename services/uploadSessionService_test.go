@@ -0,0 +1,95 @@
+package services
+
+import (
+	"chat-app-backend/models"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUnrecoverableAssembleError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{ErrFileChecksum, true},
+		{fmt.Errorf("%w: .html", ErrFileTypeNotAllowed), true},
+		{ErrFileInfected, true},
+		{ErrFileScanFailed, true},
+		{fmt.Errorf("%w: 1 of 3 chunks missing", ErrUploadIncomplete), false},
+		{errors.New("disk full"), false},
+	}
+	for _, tt := range tests {
+		if got := unrecoverableAssembleError(tt.err); got != tt.want {
+			t.Errorf("unrecoverableAssembleError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAssemblingFilter(t *testing.T) {
+	// Complete huỷ lượt upload khi nó còn ở trạng thái Assembling: bộ lọc phải khớp đúng trạng thái đó
+	// (Abort loại trừ Assembling nên không dùng được ở đây)
+	id := primitive.NewObjectID()
+	want := bson.M{"_id": id, "status": models.UploadStatusAssembling}
+	got := assemblingFilter(id)
+	if len(got) != len(want) || got["_id"] != id || got["status"] != models.UploadStatusAssembling {
+		t.Fatalf("assemblingFilter = %v, want %v", got, want)
+	}
+}
+
+func TestChunkLength(t *testing.T) {
+	tests := []struct {
+		size, chunk int64
+		total       int
+		index       int
+		want        int64
+	}{
+		{size: 10, chunk: 4, total: 3, index: 0, want: 4},
+		{size: 10, chunk: 4, total: 3, index: 2, want: 2}, // chunk cuối nhỏ hơn
+		{size: 12, chunk: 4, total: 3, index: 2, want: 4}, // chia hết: chunk cuối đủ
+		{size: 3, chunk: 4, total: 1, index: 0, want: 3},  // file một chunk
+		{size: 4, chunk: 4, total: 1, index: 0, want: 4},
+	}
+	for _, tt := range tests {
+		s := &models.UploadSession{Size: tt.size, ChunkSize: tt.chunk, TotalChunks: tt.total}
+		if got := chunkLength(s, tt.index); got != tt.want {
+			t.Errorf("chunkLength(size=%d, chunk=%d, index=%d) = %d, want %d", tt.size, tt.chunk, tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestResumeState(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		total    int
+		received []int
+		missing  []int
+		ranges   [][2]int64
+	}{
+		{name: "nothing", size: 10, total: 3, received: []int{}, missing: []int{0, 1, 2}, ranges: [][2]int64{}},
+		{name: "all merged", size: 10, total: 3, received: []int{0, 1, 2}, missing: []int{}, ranges: [][2]int64{{0, 10}}},
+		{name: "out of order", size: 10, total: 3, received: []int{2, 0, 1}, missing: []int{}, ranges: [][2]int64{{0, 10}}},
+		{name: "gap", size: 10, total: 3, received: []int{2, 0}, missing: []int{1}, ranges: [][2]int64{{0, 4}, {8, 10}}},
+		{name: "last chunk only", size: 10, total: 3, received: []int{2}, missing: []int{0, 1}, ranges: [][2]int64{{8, 10}}},
+		{name: "duplicates", size: 10, total: 3, received: []int{1, 1, 0}, missing: []int{2}, ranges: [][2]int64{{0, 8}}},
+		{name: "single chunk", size: 3, total: 1, received: []int{0}, missing: []int{}, ranges: [][2]int64{{0, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &models.UploadSession{Size: tt.size, ChunkSize: 4, TotalChunks: tt.total, Received: tt.received}
+			if got := MissingChunks(s); fmt.Sprint(got) != fmt.Sprint(tt.missing) {
+				t.Errorf("MissingChunks = %v, want %v", got, tt.missing)
+			}
+			if got := ReceivedRanges(s); fmt.Sprint(got) != fmt.Sprint(tt.ranges) {
+				t.Errorf("ReceivedRanges = %v, want %v", got, tt.ranges)
+			}
+			if fmt.Sprint(s.Received) != fmt.Sprint(tt.received) {
+				t.Errorf("ReceivedRanges must not reorder session.Received: %v", s.Received)
+			}
+		})
+	}
+}
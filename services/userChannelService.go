@@ -4,11 +4,15 @@ import (
 	"chat-app-backend/config"
 	"chat-app-backend/models"
 	"context"
+	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type UserChannelService struct {
@@ -52,3 +56,150 @@ func (ucs *UserChannelService) UpdateLastActive(userID, channelID primitive.Obje
 	_, err := collection.UpdateOne(context.Background(), filter, update)
 	return err
 }
+
+// Số hội thoại được ghim tối đa của mỗi user
+const MaxPinnedChannels = 5
+
+// SetMute tắt thông báo kênh: duration > 0 = trong khoảng thời gian, < 0 = vô thời hạn, 0 = bật lại
+func (ucs *UserChannelService) SetMute(userID, channelID primitive.ObjectID, duration time.Duration) (*models.UserChannel, error) {
+	update := bson.M{"$unset": bson.M{"mutedUntil": ""}}
+	if duration != 0 {
+		until := models.MutedForever
+		if duration > 0 {
+			until = time.Now().Add(duration)
+		}
+		update = bson.M{"$set": bson.M{"mutedUntil": until}}
+	}
+	return ucs.updateSettings(userID, channelID, update)
+}
+
+// SetArchived lưu trữ / bỏ lưu trữ hội thoại
+func (ucs *UserChannelService) SetArchived(userID, channelID primitive.ObjectID, archived bool) (*models.UserChannel, error) {
+	return ucs.updateSettings(userID, channelID, bson.M{"$set": bson.M{"archived": archived}})
+}
+
+// SetPinned ghim / bỏ ghim hội thoại lên đầu danh sách
+func (ucs *UserChannelService) SetPinned(userID, channelID primitive.ObjectID, pinned bool) (*models.UserChannel, error) {
+	if !pinned {
+		return ucs.updateSettings(userID, channelID, bson.M{
+			"$set":   bson.M{"pinned": false},
+			"$unset": bson.M{"pinnedAt": ""},
+		})
+	}
+
+	count, err := ucs.DB.Collection("userChannels").CountDocuments(context.Background(),
+		bson.M{"userID": userID, "pinned": true, "channelID": bson.M{"$ne": channelID}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxPinnedChannels {
+		return nil, fmt.Errorf("you can pin at most %d conversations", MaxPinnedChannels)
+	}
+	return ucs.updateSettings(userID, channelID, bson.M{"$set": bson.M{"pinned": true, "pinnedAt": time.Now()}})
+}
+
+func (ucs *UserChannelService) updateSettings(userID, channelID primitive.ObjectID, update bson.M) (*models.UserChannel, error) {
+	var uc models.UserChannel
+	err := ucs.DB.Collection("userChannels").FindOneAndUpdate(context.Background(),
+		bson.M{"userID": userID, "channelID": channelID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&uc)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("You are not a member of the channel")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &uc, nil
+}
+
+// ClearHistory xoá hội thoại phía user: chỉ đặt mốc clearedAt, tin nhắn của thành viên khác không bị ảnh hưởng
+func (ucs *UserChannelService) ClearHistory(userID, channelID primitive.ObjectID) (*models.UserChannel, error) {
+	return ucs.updateSettings(userID, channelID, bson.M{"$set": bson.M{"clearedAt": time.Now()}})
+}
+
+// Độ dài tối đa của bản nháp
+const MaxDraftLength = 5000
+
+// SaveDraft lưu bản nháp; nội dung rỗng và không trả lời tin nào thì xoá bản nháp
+func (ucs *UserChannelService) SaveDraft(userID, channelID primitive.ObjectID, content string, replyTo *primitive.ObjectID) (*models.UserChannel, error) {
+	if utf8.RuneCountInString(content) > MaxDraftLength {
+		return nil, fmt.Errorf("draft must be at most %d characters", MaxDraftLength)
+	}
+	if strings.TrimSpace(content) == "" && replyTo == nil {
+		return ucs.updateSettings(userID, channelID, bson.M{"$unset": bson.M{"draft": ""}})
+	}
+	if replyTo != nil {
+		count, err := ucs.DB.Collection("messages").CountDocuments(context.Background(),
+			bson.M{"_id": *replyTo, "channelID": channelID},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, errors.New("Reply target not found in this channel")
+		}
+	}
+	return ucs.updateSettings(userID, channelID, bson.M{"$set": bson.M{"draft": models.Draft{
+		Content:   content,
+		ReplyTo:   replyTo,
+		UpdatedAt: time.Now(),
+	}}})
+}
+
+// ClearDraft xoá bản nháp sau khi user gửi tin nhắn; trả true nếu thực sự có bản nháp bị xoá
+func (ucs *UserChannelService) ClearDraft(userID, channelID primitive.ObjectID) (bool, error) {
+	res, err := ucs.DB.Collection("userChannels").UpdateOne(context.Background(),
+		bson.M{"userID": userID, "channelID": channelID, "draft": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"draft": ""}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// UnarchiveOnNewMessage: có tin nhắn mới thì hội thoại đã lưu trữ hiện lại, trừ khi user đang tắt thông báo
+func (ucs *UserChannelService) UnarchiveOnNewMessage(channelID primitive.ObjectID) error {
+	_, err := ucs.DB.Collection("userChannels").UpdateMany(context.Background(),
+		bson.M{
+			"channelID": channelID,
+			"archived":  true,
+			"$nor":      []bson.M{{"mutedUntil": bson.M{"$gt": time.Now()}}},
+		},
+		bson.M{"$set": bson.M{"archived": false}},
+	)
+	return err
+}
+
+// MutedUserIDs trả tập user (trong userIDs) đang tắt thông báo kênh
+func (ucs *UserChannelService) MutedUserIDs(channelID primitive.ObjectID, userIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	cur, err := ucs.DB.Collection("userChannels").Find(context.Background(), bson.M{
+		"channelID":  channelID,
+		"userID":     bson.M{"$in": userIDs},
+		"mutedUntil": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list []models.UserChannel
+	if err := cur.All(context.Background(), &list); err != nil {
+		return nil, err
+	}
+	muted := make(map[primitive.ObjectID]bool, len(list))
+	for _, uc := range list {
+		muted[uc.UserID] = true
+	}
+	return muted, nil
+}
+
+// DraftPayload là sự kiện "draft_updated" gửi tới các kết nối của chính user; draft nil = đã xoá
+func DraftPayload(channelID primitive.ObjectID, draft *models.Draft) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "draft_updated",
+		"channelId": channelID.Hex(),
+		"draft":     draft,
+	}
+}
@@ -57,6 +57,10 @@ func (us *UserService) Register(user models.User) (*models.User, error) {
 	// Thêm thông tin ngày tạo tài khoản và mặc định trạng thái
 	user.AccountCreatedDate = time.Now()
 	user.Status = models.StatusOffline
+	// Không cho tự đăng ký quyền quản trị (role admin chỉ gán trực tiếp trong DB)
+	if user.Role == "" || user.Role == models.RoleAdmin {
+		user.Role = models.RoleUser
+	}
 
 	// Gán ảnh đại diện mặc định nếu không có
 	defaultAvatar := os.Getenv("DEFAULT_AVATAR_URL")
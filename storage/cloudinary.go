@@ -6,6 +6,7 @@ import (
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
@@ -29,7 +30,12 @@ func NewCloudinaryProviderFromURL(cloudinaryURL string) (*CloudinaryProvider, er
 	return &CloudinaryProvider{cld: cld}, nil
 }
 
-func (p *CloudinaryProvider) Upload(file multipart.File, filename string) (string, error) {
+func (p *CloudinaryProvider) Name() string {
+	return "cloudinary"
+}
+
+// Upload trả key dạng "<resource_type>/<public_id>" vì API xoá của Cloudinary cần cả hai
+func (p *CloudinaryProvider) Upload(file multipart.File, filename string) (*Object, error) {
 	defer file.Close()
 	ctx := context.Background()
 	publicID := filenameWithoutExt(filename)
@@ -41,15 +47,20 @@ func (p *CloudinaryProvider) Upload(file multipart.File, filename string) (strin
 		Overwrite: &overwrite,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if resp.SecureURL != "" {
-		return resp.SecureURL, nil
+	url := resp.SecureURL
+	if url == "" {
+		url = resp.URL
 	}
-	if resp.URL != "" {
-		return resp.URL, nil
+	if url == "" {
+		return nil, fmt.Errorf("cloudinary upload returned empty url")
 	}
-	return "", fmt.Errorf("cloudinary upload returned empty url")
+	resourceType := resp.ResourceType
+	if resourceType == "" {
+		resourceType = "image"
+	}
+	return &Object{URL: url, Key: resourceType + "/" + resp.PublicID}, nil
 }
 
 func (p *CloudinaryProvider) UploadFromPath(path string) (string, error) {
@@ -67,11 +78,48 @@ func (p *CloudinaryProvider) UploadFromPath(path string) (string, error) {
 	return "", fmt.Errorf("cloudinary upload returned empty url")
 }
 
-func (p *CloudinaryProvider) Delete(url string) error {
-	// optional: if you store public_id, you can delete via p.cld.Upload.Destroy
+func (p *CloudinaryProvider) Delete(key string) error {
+	resourceType, publicID, ok := strings.Cut(key, "/")
+	if !ok || publicID == "" {
+		return fmt.Errorf("invalid cloudinary key: %q", key)
+	}
+	invalidate := true
+	resp, err := p.cld.Upload.Destroy(context.Background(), uploader.DestroyParams{
+		PublicID:     publicID,
+		ResourceType: resourceType,
+		Invalidate:   &invalidate,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Result != "ok" && resp.Result != "not found" {
+		return fmt.Errorf("cloudinary destroy %s: %s %s", key, resp.Result, resp.Error.Message)
+	}
 	return nil
 }
 
+// KeyFromURL: https://res.cloudinary.com/<cloud>/<resource_type>/upload/[v<version>/]<public_id>.<ext>
+func (p *CloudinaryProvider) KeyFromURL(url string) string {
+	_, rest, ok := strings.Cut(url, "res.cloudinary.com/")
+	if !ok {
+		return ""
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) < 5 || parts[2] != "upload" {
+		return ""
+	}
+	path := parts[3:]
+	if v := path[0]; len(v) > 1 && v[0] == 'v' && strings.Trim(v[1:], "0123456789") == "" {
+		path = path[1:]
+	}
+	publicID := strings.Join(path, "/")
+	// file raw giữ đuôi trong public_id, ảnh/video thì không
+	if parts[1] != "raw" {
+		publicID = filenameWithoutExt(publicID)
+	}
+	return parts[1] + "/" + publicID
+}
+
 func filenameWithoutExt(fn string) string {
 	ext := filepath.Ext(fn)
 	if ext == "" {
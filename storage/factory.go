@@ -5,7 +5,7 @@ import (
 )
 
 func NewProviderFromEnv() (Provider, error) {
-	prov := os.Getenv("STORAGE_PROVIDER") // "local" hoặc "cloudinary"
+	prov := os.Getenv("STORAGE_PROVIDER") // "local", "cloudinary" hoặc "s3"
 	if prov == "" || prov == "local" {
 		publicBase := os.Getenv("PUBLIC_BASE_URL")
 		if publicBase == "" {
@@ -15,6 +15,9 @@ func NewProviderFromEnv() (Provider, error) {
 		publicRoute := "/uploads"
 		return NewLocalProvider(uploadDir, publicBase, publicRoute), nil
 	}
+	if prov == "s3" {
+		return NewS3ProviderFromEnv()
+	}
 	// cloudinary
 	cloudinaryURL := os.Getenv("CLOUDINARY_URL")
 	return NewCloudinaryProviderFromURL(cloudinaryURL)
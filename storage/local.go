@@ -2,9 +2,12 @@ package storage
 
 import (
 	"fmt"
+	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 type LocalProvider struct {
@@ -23,12 +26,16 @@ func NewLocalProvider(uploadDir, publicBase, publicRoute string) *LocalProvider
 	}
 }
 
-func (p *LocalProvider) Upload(file multipart.File, filename string) (string, error) {
+func (p *LocalProvider) Name() string {
+	return "local"
+}
+
+func (p *LocalProvider) Upload(file multipart.File, filename string) (*Object, error) {
 	dstPath := filepath.Join(p.UploadDir, filename)
 
 	dst, err := os.Create(dstPath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer dst.Close()
 
@@ -37,9 +44,13 @@ func (p *LocalProvider) Upload(file multipart.File, filename string) (string, er
 		// ignore seek error, continue
 	}
 	if _, err := dst.ReadFrom(file); err != nil {
-		return "", err
+		return nil, err
 	}
 
+	return &Object{URL: p.publicURL(filename), Key: filename}, nil
+}
+
+func (p *LocalProvider) publicURL(filename string) string {
 	base := p.PublicBase
 	if base == "" {
 		base = "http://localhost:8080"
@@ -49,7 +60,7 @@ func (p *LocalProvider) Upload(file multipart.File, filename string) (string, er
 	if route == "" {
 		route = "/uploads"
 	}
-	return base + route + "/" + filename, nil
+	return base + route + "/" + filename
 }
 
 func (p *LocalProvider) UploadFromPath(path string) (string, error) {
@@ -68,7 +79,44 @@ func (p *LocalProvider) UploadFromPath(path string) (string, error) {
 	return base + route + "/" + filename, nil
 }
 
-func (p *LocalProvider) Delete(url string) error {
-	// optional: parse filename from url and delete from disk
+// Open mở file trong UploadDir để phục vụ download, trả kèm thời gian sửa đổi
+func (p *LocalProvider) Open(key string) (io.ReadSeekCloser, time.Time, error) {
+	f, err := os.Open(filepath.Join(p.UploadDir, filepath.Base(key)))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, time.Time{}, fmt.Errorf("not a file: %s", key)
+	}
+	return f, info.ModTime(), nil
+}
+
+// Delete xoá file trong UploadDir; key chỉ là tên file nên không thể thoát ra ngoài thư mục upload
+func (p *LocalProvider) Delete(key string) error {
+	name := filepath.Base(key)
+	if name == "." || name == "/" || name == "" {
+		return fmt.Errorf("invalid key: %q", key)
+	}
+	err := os.Remove(filepath.Join(p.UploadDir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
+
+// KeyFromURL: URL dạng <PublicBase><PublicRoute>/<filename> (chấp nhận cả đường dẫn tương đối /uploads/<filename>)
+func (p *LocalProvider) KeyFromURL(url string) string {
+	prefix := strings.TrimSuffix(p.publicURL(""), "/")
+	route := p.PublicRoute
+	if route == "" {
+		route = "/uploads"
+	}
+	for _, pre := range []string{prefix + "/", route + "/"} {
+		if name, ok := strings.CutPrefix(url, pre); ok && name != "" && !strings.Contains(name, "/") {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Thời hạn mặc định của presigned URL
+const DefaultS3PresignTTL = time.Hour
+
+// Presigner là provider có thể tạo URL tạm thời cho object trong bucket private
+type Presigner interface {
+	PresignGet(key string, ttl time.Duration) (string, error)
+}
+
+// S3Provider lưu file trên S3 hoặc dịch vụ tương thích (MinIO, R2...).
+// PublicBase rỗng = bucket private: URL lưu trong DB trỏ về server (RedirectBase + "/files/<key>"),
+// server kiểm tra rồi redirect sang presigned URL.
+type S3Provider struct {
+	client       *minio.Client
+	Bucket       string
+	Prefix       string
+	PublicBase   string
+	RedirectBase string
+	PresignTTL   time.Duration
+}
+
+type S3Config struct {
+	Endpoint     string // host[:port], không kèm scheme
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	Bucket       string
+	Prefix       string // ví dụ "chat/uploads/"
+	UseSSL       bool
+	PathStyle    bool // MinIO thường cần path-style
+	PublicBase   string
+	RedirectBase string
+	PresignTTL   time.Duration
+}
+
+func NewS3Provider(cfg S3Config) (*S3Provider, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET required")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "s3.amazonaws.com"
+	}
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       cfg.UseSSL,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PresignTTL <= 0 {
+		cfg.PresignTTL = DefaultS3PresignTTL
+	}
+	prefix := strings.TrimPrefix(cfg.Prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3Provider{
+		client:       client,
+		Bucket:       cfg.Bucket,
+		Prefix:       prefix,
+		PublicBase:   strings.TrimSuffix(cfg.PublicBase, "/"),
+		RedirectBase: strings.TrimSuffix(cfg.RedirectBase, "/"),
+		PresignTTL:   cfg.PresignTTL,
+	}, nil
+}
+
+// NewS3ProviderFromEnv đọc cấu hình S3_* (credentials fallback về AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY)
+func NewS3ProviderFromEnv() (*S3Provider, error) {
+	cfg := S3Config{
+		Endpoint:     os.Getenv("S3_ENDPOINT"),
+		Region:       os.Getenv("S3_REGION"),
+		AccessKey:    firstEnv("S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"),
+		SecretKey:    firstEnv("S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"),
+		Bucket:       os.Getenv("S3_BUCKET"),
+		Prefix:       os.Getenv("S3_PREFIX"),
+		UseSSL:       os.Getenv("S3_USE_SSL") != "false",
+		PathStyle:    os.Getenv("S3_PATH_STYLE") == "true",
+		PublicBase:   os.Getenv("S3_PUBLIC_BASE_URL"),
+		RedirectBase: os.Getenv("PUBLIC_BASE_URL"),
+	}
+	if cfg.RedirectBase == "" {
+		cfg.RedirectBase = "http://localhost:8080"
+	}
+	if raw := os.Getenv("S3_PRESIGN_TTL"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PRESIGN_TTL %q: %v", raw, err)
+		}
+		cfg.PresignTTL = ttl
+	}
+	return NewS3Provider(cfg)
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (p *S3Provider) Name() string {
+	return "s3"
+}
+
+// Upload stream file lên bucket (SDK tự chia multipart với file lớn)
+func (p *S3Provider) Upload(file multipart.File, filename string) (*Object, error) {
+	defer file.Close()
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return p.put(file, size, filename)
+}
+
+func (p *S3Provider) UploadFromPath(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	obj, err := p.put(f, info.Size(), filepath.Base(filePath))
+	if err != nil {
+		return "", err
+	}
+	return obj.URL, nil
+}
+
+func (p *S3Provider) put(r io.Reader, size int64, filename string) (*Object, error) {
+	key := p.Prefix + path.Base(filename)
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	opts := minio.PutObjectOptions{ContentType: contentType}
+	if !IsInlineMedia(contentType) {
+		// URL công khai/presigned trỏ thẳng vào bucket: file không phải media luôn tải về, không mở trong trình duyệt
+		opts.ContentDisposition = "attachment"
+	}
+	_, err := p.client.PutObject(context.Background(), p.Bucket, key, r, size, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{URL: p.objectURL(key), Key: key}, nil
+}
+
+// objectURL: bucket public thì trỏ thẳng vào bucket/CDN, private thì trỏ về route redirect của server
+func (p *S3Provider) objectURL(key string) string {
+	if p.PublicBase != "" {
+		return p.PublicBase + "/" + key
+	}
+	return p.RedirectBase + "/files/" + key
+}
+
+// Delete: S3 trả thành công cả khi object không tồn tại
+func (p *S3Provider) Delete(key string) error {
+	if key == "" {
+		return fmt.Errorf("invalid key")
+	}
+	return p.client.RemoveObject(context.Background(), p.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (p *S3Provider) KeyFromURL(url string) string {
+	for _, base := range []string{p.PublicBase, p.RedirectBase + "/files"} {
+		if base == "" {
+			continue
+		}
+		if key, ok := strings.CutPrefix(url, base+"/"); ok && strings.HasPrefix(key, p.Prefix) && key != p.Prefix {
+			return key
+		}
+	}
+	return ""
+}
+
+// PresignGet tạo URL GET tạm thời; ttl <= 0 dùng PresignTTL
+func (p *S3Provider) PresignGet(key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = p.PresignTTL
+	}
+	u, err := p.client.PresignedGetObject(context.Background(), p.Bucket, key, ttl, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
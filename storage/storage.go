@@ -1,13 +1,58 @@
 package storage
 
-import "mime/multipart"
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"strings"
+	"time"
+)
 
 // Provider là interface chung cho storage (local hoặc cloud)
 type Provider interface {
-	// Upload upload từ multipart.File, trả về public URL
-	Upload(file multipart.File, filename string) (string, error)
+	// Name là tên provider, lưu vào File.Provider để biết file nằm ở đâu khi xoá
+	Name() string
+	// Upload upload từ multipart.File, trả về public URL và key của object
+	Upload(file multipart.File, filename string) (*Object, error)
 	// UploadFromPath upload từ path (nếu cần)
 	UploadFromPath(path string) (string, error)
-	// Delete xóa file (tuỳ chọn)
-	Delete(url string) error
+	// Delete xoá object theo key trả về từ Upload; object không tồn tại thì không lỗi
+	Delete(key string) error
+	// KeyFromURL suy ra key từ URL cho các bản ghi cũ chưa lưu key ("" nếu URL không thuộc provider)
+	KeyFromURL(url string) string
+}
+
+// Opener là provider đọc được object trực tiếp (local): server tự phục vụ file, hỗ trợ Range
+type Opener interface {
+	Open(key string) (io.ReadSeekCloser, time.Time, error)
+}
+
+// IsInlineMedia: ảnh/video/audio được hiển thị thẳng trong trình duyệt; loại khác (và SVG, có thể chứa script)
+// phải trả kèm Content-Disposition: attachment để không bị mở như một trang web
+func IsInlineMedia(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.Contains(contentType, "svg") || strings.Contains(contentType, "xml") {
+		return false
+	}
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/") ||
+		strings.HasPrefix(contentType, "audio/")
+}
+
+// Object là kết quả upload: URL công khai và key dùng để xoá sau này
+type Object struct {
+	URL string
+	Key string
+}
+
+// BytesFile bọc dữ liệu trong bộ nhớ thành multipart.File, dùng để upload file do server tạo (thumbnail, ảnh đã xử lý)
+type BytesFile struct {
+	*bytes.Reader
+}
+
+func NewBytesFile(data []byte) *BytesFile {
+	return &BytesFile{Reader: bytes.NewReader(data)}
+}
+
+func (f *BytesFile) Close() error {
+	return nil
 }
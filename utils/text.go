@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FoldRune đưa một ký tự về dạng thường, bỏ dấu (ví dụ "Ế" → "e", "đ" → "d").
+// Luôn trả về đúng một rune để vị trí ký tự của chuỗi gốc và chuỗi đã fold khớp nhau.
+func FoldRune(r rune) rune {
+	switch r {
+	case 'đ', 'Đ':
+		return 'd'
+	}
+	if r < 0x80 {
+		return unicode.ToLower(r)
+	}
+	for _, base := range norm.NFD.String(string(r)) {
+		return unicode.ToLower(base) // rune đầu tiên là chữ gốc, phần sau là dấu
+	}
+	return r
+}
+
+// FoldText bỏ dấu tiếng Việt và chuyển chữ thường, dùng cho tìm kiếm không phân biệt dấu
+func FoldText(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		b.WriteRune(FoldRune(r))
+	}
+	return b.String()
+}